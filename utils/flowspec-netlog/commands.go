@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
+)
+
+// command is a flowspec-netlog subcommand
+type command struct {
+	args string // argument synopsis shown in usage
+	help string
+	run  func(args []string) error
+}
+
+// commands maps subcommand names to their implementations
+var commands = map[string]command{
+	"ca": {
+		args: "(info [-json] [-generate] | renew [-keep-key]) [log-dir]",
+		help: "Inspect or renew the CA certificate",
+		run:  runCA,
+	},
+	"convert": {
+		args: "-in <log-file> [-out <file>]",
+		help: "Convert a log file, e.g. a gob capture, to JSONL",
+		run:  runConvert,
+	},
+	"diff": {
+		args: "[-key method,path] [-json] -a <log-file> -b <log-file>",
+		help: "Compare the requests of two captures",
+		run:  runDiff,
+	},
+	"export-curl": {
+		args: "-in <log-file> [-out <file>]",
+		help: "Write the captured requests as a shell script of curl commands",
+		run:  runExportCurl,
+	},
+	"extract": {
+		args: "-in <log-file> (-id <request-id> | -n <entry>) [-out <file>]",
+		help: "Write a captured request as a raw .http file",
+		run:  runExtract,
+	},
+	"print-ca": {
+		args: "[log-dir]",
+		help: "Print CA certificate installation instructions",
+		run:  runPrintCA,
+	},
+	"replay": {
+		args: "[-cookies=false] -in <log-file>",
+		help: "Send the captured requests again, keeping cookies across them",
+		run:  runReplay,
+	},
+	"schema": {
+		args: "",
+		help: "Print the JSON Schema of a log line",
+		run:  runSchema,
+	},
+	"summarize": {
+		args: "[-json] <log-file>...",
+		help: "Summarize captured log files",
+		run:  runSummarize,
+	},
+	"tail": {
+		args: "[-host h] [-method m] [-status 5xx] [-json] [log-file|log-dir]",
+		help: "Follow a live capture, printing new entries",
+		run:  runTail,
+	},
+	"version": {
+		args: "",
+		help: "Print version information",
+		run:  runVersion,
+	},
+}
+
+// runCommand runs the named subcommand and reports whether one was found
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false
+	}
+
+	if err := cmd.run(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "flowspec-netlog %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// logDirArg returns the log directory from a positional argument, LOG_DIR, or the default
+func logDirArg(fs *flag.FlagSet) string {
+	if fs.NArg() > 0 {
+		return fs.Arg(0)
+	}
+	if dir := os.Getenv("LOG_DIR"); dir != "" {
+		return dir
+	}
+	return ".logs"
+}
+
+// runPrintCA prints the CA installation instructions, generating the CA if needed
+func runPrintCA(args []string) error {
+	fs := flag.NewFlagSet("print-ca", flag.ExitOnError)
+	fs.Parse(args)
+
+	opts, err := proxy.OptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	opts.LogDir = logDirArg(fs)
+
+	certMgr, err := proxy.NewCertManagerFromOptions(opts)
+	if err != nil {
+		return err
+	}
+	certMgr.PrintInstallInstructions()
+	return nil
+}
+
+// caCommands are the subcommands of "ca"
+var caCommands = map[string]func(args []string) error{
+	"info":  runCAInfo,
+	"renew": runCARenew,
+}
+
+// runCA runs a "ca" subcommand
+func runCA(args []string) error {
+	if len(args) == 0 || caCommands[args[0]] == nil {
+		return errors.New("usage: flowspec-netlog ca (info [-json] [-generate] | renew [-keep-key]) [log-dir]")
+	}
+	return caCommands[args[0]](args[1:])
+}
+
+// runCAInfo prints the subject, validity, key, and fingerprint of the CA
+func runCAInfo(args []string) error {
+	fs := flag.NewFlagSet("ca info", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the details as JSON")
+	generate := fs.Bool("generate", false, "Generate the CA if there is none yet")
+	fs.Parse(args)
+
+	opts, err := proxy.OptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	opts.LogDir = logDirArg(fs)
+
+	certMgr, err := proxy.LoadExistingCA(opts)
+	if errors.Is(err, proxy.ErrNoCA) && *generate {
+		certMgr, err = proxy.NewCertManagerFromOptions(opts)
+	} else if errors.Is(err, proxy.ErrNoCA) {
+		fmt.Fprintf(os.Stderr, "No CA certificate in %s yet; generate one with:\n", opts.LogDir)
+		fmt.Fprintf(os.Stderr, "  flowspec-netlog ca info -generate %s\n", opts.LogDir)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	info := certMgr.Info()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+	info.Print(os.Stdout)
+	return nil
+}
+
+// runCARenew replaces the CA certificate in place and prints how to install it
+func runCARenew(args []string) error {
+	fs := flag.NewFlagSet("ca renew", flag.ExitOnError)
+	keepKey := fs.Bool("keep-key", false, "Keep the CA key, so clients need not trust the CA again")
+	fs.Parse(args)
+
+	opts, err := proxy.OptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	opts.LogDir = logDirArg(fs)
+
+	certMgr, err := proxy.RenewCA(opts, *keepKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Renewed the CA certificate:")
+	certMgr.Info().Print(os.Stdout)
+	if *keepKey {
+		fmt.Println("\nThe key was kept, so clients that trust the previous certificate accept the renewed")
+		fmt.Println("CA until the previous one expires. Install the new certificate before then.")
+	} else {
+		fmt.Println("\nWarning: the CA has a new key. Clients must trust the new certificate, since the")
+		fmt.Println("previous one no longer verifies intercepted connections.")
+	}
+	fmt.Println("Restart a running flowspec-netlog to use the renewed CA.")
+	certMgr.PrintInstallInstructions()
+	return nil
+}
+
+// runDiff compares two captures, failing when they differ
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	a := fs.String("a", "", "Known-good log file")
+	b := fs.String("b", "", "Log file to compare")
+	key := fs.String("key", strings.Join(proxy.DefaultDiffKey, ","), "Correlation key: comma-separated method, host, path, query, body")
+	asJSON := fs.Bool("json", false, "Print the differences as JSON")
+	fs.Parse(args)
+
+	if *a == "" || *b == "" {
+		return errors.New("usage: flowspec-netlog diff [-key method,path] [-json] -a <log-file> -b <log-file>")
+	}
+
+	report, err := proxy.DiffFiles(*a, *b, strings.Split(*key, ","))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		report.Print(os.Stdout)
+	}
+	if n := len(report.Differences); n > 0 {
+		return fmt.Errorf("%d difference(s)", n)
+	}
+	return nil
+}
+
+// runConvert writes a log file of any format as JSONL
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	in := fs.String("in", "", "Log file to read")
+	out := fs.String("out", "", "File to write (default stdout)")
+	fs.Parse(args)
+
+	if *in == "" {
+		return errors.New("usage: flowspec-netlog convert -in <log-file> [-out <file>]")
+	}
+
+	if *out == "" {
+		return proxy.ConvertToJSONL(os.Stdout, *in)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := proxy.ConvertToJSONL(file, *in); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// runExportCurl writes a log file's requests as a runnable curl script
+func runExportCurl(args []string) error {
+	fs := flag.NewFlagSet("export-curl", flag.ExitOnError)
+	in := fs.String("in", "", "Log file to read")
+	out := fs.String("out", "", "Script to write (default stdout)")
+	fs.Parse(args)
+
+	if *in == "" {
+		return errors.New("usage: flowspec-netlog export-curl -in <log-file> [-out <file>]")
+	}
+
+	if *out == "" {
+		_, err := proxy.ExportCurl(os.Stdout, *in)
+		return err
+	}
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	n, err := proxy.ExportCurl(file, *in)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d requests to %s\n", n, *out)
+	return file.Close()
+}
+
+// runReplay sends a log file's requests again
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	in := fs.String("in", "", "Log file to read")
+	cookies := fs.Bool("cookies", true, "Send cookies set by replayed responses on later requests")
+	fs.Parse(args)
+
+	if *in == "" {
+		return errors.New("usage: flowspec-netlog replay [-cookies=false] -in <log-file>")
+	}
+
+	n, err := proxy.Replay(os.Stdout, *in, proxy.ReplayOptions{Cookies: *cookies})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Replayed %d requests\n", n)
+	return nil
+}
+
+// runExtract writes one captured entry as a raw HTTP request and response
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	in := fs.String("in", "", "Log file to read")
+	id := fs.String("id", "", "X-Request-ID of the entry to extract")
+	n := fs.Int("n", 0, "1-based position of the entry in the log file")
+	out := fs.String("out", "", "File to write (default stdout)")
+	fs.Parse(args)
+
+	if *in == "" || (*id == "") == (*n == 0) {
+		return errors.New("usage: flowspec-netlog extract -in <log-file> (-id <request-id> | -n <entry>) [-out <file>]")
+	}
+
+	entry, err := proxy.FindEntry(*in, func(i int, log *proxy.RequestLog) bool {
+		if *id != "" {
+			return log.Headers["X-Request-ID"] == *id
+		}
+		return i == *n
+	})
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		return proxy.DumpHTTP(os.Stdout, entry)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := proxy.DumpHTTP(file, entry); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// runSummarize prints the summary of one or more log files
+func runSummarize(args []string) error {
+	fs := flag.NewFlagSet("summarize", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the summary as JSON")
+	hosts := fs.Int("hosts", 10, "Hosts to list before rolling the rest up as others")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("usage: flowspec-netlog summarize [-json] [-hosts n] <log-file>...")
+	}
+
+	summary, err := proxy.SummarizeFiles(fs.Args()...)
+	if err != nil {
+		return err
+	}
+	summary.HostLimit = *hosts
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summary)
+	}
+	summary.Print()
+	return nil
+}
+
+// runTail follows a log file, or the newest one in the log directory, until interrupted
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	var filter proxy.TailFilter
+	fs.StringVar(&filter.Host, "host", "", "Only entries for this host (.example.com for subdomains)")
+	fs.StringVar(&filter.Method, "method", "", "Only entries with this method")
+	fs.StringVar(&filter.Status, "status", "", "Only entries with this status code or class (e.g. 404, 5xx)")
+	raw := fs.Bool("json", false, "Print entries as raw JSON lines")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return proxy.Tail(ctx, logDirArg(fs), filter, *raw, os.Stdout)
+}
+
+// runSchema prints the JSON Schema describing log lines
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.Parse(args)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(proxy.LogSchema())
+}
+
+// runVersion prints the version, commit, and build date
+func runVersion(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Parse(args)
+
+	printVersion()
+	return nil
+}
@@ -16,4 +16,8 @@ require (
 	// Used for: Build tasks, cross-platform compilation, dependency management
 	// Using tagged release v1.15.0 for stability and reproducibility
 	github.com/magefile/mage v1.15.0
+
+	// x/net: public suffix list for wildcard leaf certificates
+	// Using tagged release v0.19.0 for stability and reproducibility
+	golang.org/x/net v0.19.0
 )
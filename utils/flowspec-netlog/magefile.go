@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/magefile/mage/mg"
 	"github.com/magefile/mage/sh"
@@ -16,10 +17,19 @@ const (
 	binary = "flowspec-netlog"
 )
 
+// ldflags stamps the git commit and build date into the binary
+func ldflags() string {
+	commit, err := sh.Output("git", "rev-parse", "--short", "HEAD")
+	if err != nil {
+		commit = ""
+	}
+	return fmt.Sprintf("-X main.commit=%s -X main.buildDate=%s", commit, time.Now().UTC().Format(time.RFC3339))
+}
+
 // Build compiles the flowspec-netlog binary
 func Build() error {
 	fmt.Println("Building flowspec-netlog...")
-	return sh.Run("go", "build", "-o", binary, ".")
+	return sh.Run("go", "build", "-ldflags", ldflags(), "-o", binary, ".")
 }
 
 // Install installs the binary to /usr/local/bin (requires sudo)
@@ -91,7 +101,7 @@ func Dist() error {
 			"GOARCH": p.arch,
 		}
 
-		if err := sh.RunWith(env, "go", "build", "-o", output, "."); err != nil {
+		if err := sh.RunWith(env, "go", "build", "-ldflags", ldflags(), "-o", output, "."); err != nil {
 			return err
 		}
 	}
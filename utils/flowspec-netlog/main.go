@@ -2,82 +2,154 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"syscall"
-	"time"
+	"text/tabwriter"
 
 	"github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
 )
 
-const (
-	defaultPort = "8080"
-	version     = "0.1.0"
-)
+// exitFailOn is the exit status when a FLOWSPEC_FAIL_ON condition occurred
+const exitFailOn = 3
 
 func main() {
+	// Dispatch subcommands before the capture check so they work standalone
+	if runCommand(os.Args[1:]) {
+		return
+	}
+
+	quiet := flag.Bool("quiet", false, "Don't print CA installation instructions on startup")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		printVersion()
+		return
+	}
+
 	// Check if network capture is enabled
 	if os.Getenv("FLOWSPEC_CAPTURE_NETWORK") != "true" {
 		fmt.Println("flowspec-netlog: FLOWSPEC_CAPTURE_NETWORK not set to 'true', exiting")
 		os.Exit(0)
 	}
 
-	// Get log directory
-	logDir := os.Getenv("LOG_DIR")
-	if logDir == "" {
-		logDir = ".logs"
-	}
-
-	// Create log directory if it doesn't exist
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		log.Fatalf("Failed to create log directory: %v", err)
+	opts, err := proxy.OptionsFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
+	// Machine-readable startup replaces the prose banner and instructions
+	jsonStartup := os.Getenv("FLOWSPEC_JSON_STARTUP") == "true"
+	opts.PrintCAInstructions = printCAInstructions(opts.PrintCAInstructions, *quiet, jsonStartup)
 
-	port := os.Getenv("FLOWSPEC_NETLOG_PORT")
-	if port == "" {
-		port = defaultPort
+	// Use the socket passed by systemd when socket-activated
+	opts.Listener, err = systemdListener()
+	if err != nil {
+		log.Fatalf("Failed to set up socket activation: %v", err)
 	}
 
 	// Initialize proxy with logging
-	p, err := proxy.NewProxy(logDir)
+	p, err := proxy.NewProxy(opts)
 	if err != nil {
 		log.Fatalf("Failed to create proxy: %v", err)
 	}
-	defer p.Close()
+	defer p.Stop()
 
 	// Set up graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	// Start proxy server
-	addr := ":" + port
-	server := &http.Server{
-		Addr:    addr,
-		Handler: p,
+	if err := p.Start(context.Background()); err != nil {
+		p.Close()
+		log.Fatalf("Failed to start proxy: %v", err)
+	}
+
+	info := newStartupInfo(p)
+	if jsonStartup {
+		if err := printStartupJSON(os.Stdout, info); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	} else {
+		printStartupBanner(os.Stdout, info, opts)
 	}
 
+	if err := sdNotify("READY=1"); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Reload the host rules on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 	go func() {
-		fmt.Printf("flowspec-netlog v%s starting on %s\n", version, addr)
-		fmt.Printf("Logging to: %s/network.*.jsonl\n", logDir)
-		fmt.Printf("Press Ctrl+C to stop\n")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Proxy server error: %v", err)
+		for range hupChan {
+			if err := p.Reload(); err != nil {
+				log.Printf("Warning: reload failed: %v", err)
+			} else {
+				fmt.Println("Reloaded host rules")
+			}
 		}
 	}()
 
+	notifyPauseSignals(p)
+
 	// Wait for shutdown signal
 	<-sigChan
 	fmt.Println("\nShutting down flowspec-netlog...")
+	sdNotify("STOPPING=1")
+	p.Stop()
 
-	// Create shutdown context with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer shutdownCancel()
+	// Fail CI runs on the FLOWSPEC_FAIL_ON conditions seen during the capture
+	if status := exitStatus(os.Stderr, p.Summary()); status != 0 {
+		os.Exit(status)
+	}
+}
 
-	// Gracefully shutdown server
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+// exitStatus returns the exit status for a finished capture: exitFailOn,
+// after listing them to w, when FLOWSPEC_FAIL_ON conditions occurred
+func exitStatus(w io.Writer, summary *proxy.SessionSummary) int {
+	if summary == nil || len(summary.Failures) == 0 {
+		return 0
+	}
+	failures := make([]string, 0, len(summary.Failures))
+	for condition, count := range summary.Failures {
+		failures = append(failures, fmt.Sprintf("%s=%d", condition, count))
+	}
+	sort.Strings(failures)
+	fmt.Fprintf(w, "flowspec-netlog: FLOWSPEC_FAIL_ON conditions occurred (%s), exiting with status %d\n",
+		strings.Join(failures, " "), exitFailOn)
+	return exitFailOn
+}
+
+// printCAInstructions reports whether to print the CA instructions the
+// options ask for: -quiet and the JSON startup line both suppress them
+func printCAInstructions(configured, quiet, jsonStartup bool) bool {
+	return configured && !quiet && !jsonStartup
+}
+
+// usage prints the command-line help
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: flowspec-netlog [flags]\n")
+	fmt.Fprintf(out, "       flowspec-netlog <command> [args]\n\nFlags:\n")
+	flag.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(out, "\nCommands:\n")
+	tw := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", name, commands[name].args, commands[name].help)
 	}
+	tw.Flush()
 }
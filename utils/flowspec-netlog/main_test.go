@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
+)
+
+func TestPrintCAInstructions(t *testing.T) {
+	for _, tc := range []struct {
+		configured, quiet, jsonStartup bool
+		want                           bool
+	}{
+		{true, false, false, true},
+		{true, true, false, false},
+		{true, false, true, false},
+		{false, false, false, false},
+		{false, true, false, false},
+	} {
+		if got := printCAInstructions(tc.configured, tc.quiet, tc.jsonStartup); got != tc.want {
+			t.Errorf("printCAInstructions(configured %v, quiet %v, json %v) = %v, want %v",
+				tc.configured, tc.quiet, tc.jsonStartup, got, tc.want)
+		}
+	}
+}
+
+func TestExitStatusFailOnErrors(t *testing.T) {
+	// A port nothing listens on makes the upstream request fail
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := "http://" + l.Addr().String() + "/"
+	l.Close()
+
+	for _, tc := range []struct {
+		failOn []string
+		want   int
+	}{
+		{nil, 0},
+		{[]string{"5xx"}, 0},
+		{[]string{"errors"}, exitFailOn},
+	} {
+		p, err := proxy.NewProxy(proxy.Options{LogDir: t.TempDir(), Addr: "127.0.0.1:0", FailOn: tc.failOn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: p.Addr()})}}
+		if resp, err := client.Get(upstream); err == nil {
+			resp.Body.Close()
+		}
+		p.Stop()
+
+		var stderr bytes.Buffer
+		if got := exitStatus(&stderr, p.Summary()); got != tc.want {
+			t.Errorf("FLOWSPEC_FAIL_ON=%s: exit status %d, want %d", strings.Join(tc.failOn, ","), got, tc.want)
+		}
+		if tc.want != 0 && !strings.Contains(stderr.String(), "errors=1") {
+			t.Errorf("FLOWSPEC_FAIL_ON=%s: output %q does not report errors=1", strings.Join(tc.failOn, ","), stderr.String())
+		}
+	}
+}
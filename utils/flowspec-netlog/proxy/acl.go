@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/elazarl/goproxy"
+)
+
+// parseCIDRs parses CIDR ranges; a bare IP address is a single-address range
+func parseCIDRs(items []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// clientAllowed reports whether a client may use the proxy. With no
+// AllowCIDRs configured every client is allowed.
+func (p *Proxy) clientAllowed(remoteAddr string) bool {
+	if len(p.opts.AllowCIDRs) == 0 {
+		return true
+	}
+
+	host := clientIP(remoteAddr)
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i] // IPv6 zone
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range p.opts.AllowCIDRs {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forbiddenResponse rejects a client outside the allowed ranges
+func forbiddenResponse(req *http.Request) *http.Response {
+	return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusForbidden,
+		"flowspec-netlog: client address not allowed\n")
+}
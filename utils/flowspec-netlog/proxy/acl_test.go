@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestClientAllowed(t *testing.T) {
+	allow, err := parseCIDRs([]string{"10.0.0.0/8", "192.168.1.5", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{opts: Options{AllowCIDRs: allow}}
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3:5555", true},
+		{"11.0.0.1:5555", false},
+		{"192.168.1.5:80", true},
+		{"192.168.1.6:80", false},
+		{"[fd12::1]:443", true},
+		{"[fd12::1%eth0]:443", true},
+		{"[fe80::1]:443", false},
+		{"not-an-ip:80", false},
+	} {
+		if got := p.clientAllowed(tc.addr); got != tc.want {
+			t.Errorf("clientAllowed(%q) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestAllowCIDRs(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer upstream.Close()
+
+	// Test clients connect from 127.0.0.1
+	for _, tc := range []struct {
+		allow  string
+		status int
+	}{
+		{"127.0.0.0/8", http.StatusOK},
+		{"10.0.0.0/8", http.StatusForbidden},
+	} {
+		allow, err := parseCIDRs([]string{tc.allow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hits.Store(0)
+		p, addr := startTestProxy(t, Options{AllowCIDRs: allow})
+
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}}
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("allow %s: GET status %d, want %d", tc.allow, resp.StatusCode, tc.status)
+		}
+		if forwarded := hits.Load() == 1; forwarded != (tc.status == http.StatusOK) {
+			t.Errorf("allow %s: forwarded %v", tc.allow, forwarded)
+		}
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 1 {
+			t.Fatalf("allow %s: got %d entries, want 1", tc.allow, len(entries))
+		}
+		blocked := entries[0].ErrorKind == "forbidden" && entries[0].Disposition == dispositionBlock
+		if blocked != (tc.status == http.StatusForbidden) {
+			t.Errorf("allow %s: entry error kind %q, disposition %q", tc.allow, entries[0].ErrorKind, entries[0].Disposition)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// AdminHandler returns the HTTP handler for the admin endpoints
+func (p *Proxy) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/recent", p.handleRecent)
+	mux.HandleFunc("/reload", p.handleReload)
+	mux.HandleFunc("/pause", p.handlePause)
+	mux.HandleFunc("/resume", p.handlePause)
+	mux.HandleFunc("/healthz", p.handleHealth)
+	mux.HandleFunc("/stats", p.handleStats)
+	mux.HandleFunc("/ui", p.handleUI)
+	return mux
+}
+
+// handleHealth reports that the proxy is serving, with the number of panics
+// recovered in capture code and the capture features they disabled
+func (p *Proxy) handleHealth(w http.ResponseWriter, r *http.Request) {
+	panics, disabled := p.logger.breaker.stats()
+	status := "ok"
+	if len(disabled) > 0 {
+		status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   status,
+		"panics":   panics,
+		"disabled": disabled,
+	})
+}
+
+// handleStats serves counters of the entries logged since start, or since
+// the last ?reset=true, which zeroes them after answering
+func (p *Proxy) handleStats(w http.ResponseWriter, r *http.Request) {
+	reset := r.URL.Query().Get("reset") == "true"
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.logger.stats.snapshot(reset))
+}
+
+// handleReload re-reads the host rules on POST
+func (p *Proxy) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := p.Reload(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePause pauses or resumes capture on POST /pause or /resume,
+// answering with whether capture is now running
+func (p *Proxy) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == "/pause" {
+		p.Pause()
+	} else {
+		p.Resume()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"capturing": !p.logger.Paused()})
+}
+
+// handleRecent serves the most recent log entries, newest first.
+// Optional ?host= and ?status= query parameters filter the result.
+func (p *Proxy) handleRecent(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("host")
+	status := 0
+	if s := r.URL.Query().Get("status"); s != "" {
+		var err error
+		if status, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "invalid status filter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := p.logger.Recent(func(log *RequestLog) bool {
+		if host != "" && log.Host != host {
+			// Allow filtering by hostname without the port
+			if hostname, _, err := net.SplitHostPort(log.Host); err != nil || hostname != host {
+				return false
+			}
+		}
+		return status == 0 || log.StatusCode == status
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
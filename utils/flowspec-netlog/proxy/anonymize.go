@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// scrubRule replaces matches of a pattern with <name_N> placeholders
+type scrubRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// defaultScrubRules cover common PII and credentials. Tokens run first so a
+// JWT or API key is not partially rewritten by the broader patterns.
+var defaultScrubRules = []scrubRule{
+	{Name: "jwt", Pattern: `eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`},
+	{Name: "token", Pattern: `\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bgh[pousr]_[A-Za-z0-9]{20,}|\bxox[abprs]-[A-Za-z0-9-]{10,}|\bAKIA[0-9A-Z]{16}\b`},
+	{Name: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	{Name: "ip", Pattern: `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`},
+}
+
+// anonymizer scrubs PII from captured entries. Each distinct value maps to
+// the same placeholder for the whole session, so correlations survive.
+type anonymizer struct {
+	rules []scrubRule
+
+	mu           sync.Mutex
+	placeholders map[string]string // rule name + "\x00" + value -> placeholder
+	counts       map[string]int
+}
+
+// newAnonymizer compiles the default rules plus any from patternsFile, a
+// JSON array of {"name": ..., "pattern": ...}
+func newAnonymizer(patternsFile string) (*anonymizer, error) {
+	rules := append([]scrubRule(nil), defaultScrubRules...)
+
+	if patternsFile != "" {
+		data, err := os.ReadFile(patternsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read anonymize patterns: %w", err)
+		}
+		var extra []scrubRule
+		if err := json.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("failed to parse anonymize patterns: %w", err)
+		}
+		for i, rule := range extra {
+			if rule.Name == "" || rule.Pattern == "" {
+				return nil, fmt.Errorf("anonymize pattern %d: name and pattern are required", i)
+			}
+		}
+		rules = append(rules, extra...)
+	}
+
+	for i := range rules {
+		re, err := regexp.Compile(rules[i].Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("anonymize pattern %q: %w", rules[i].Name, err)
+		}
+		rules[i].re = re
+	}
+
+	return &anonymizer{
+		rules:        rules,
+		placeholders: make(map[string]string),
+		counts:       make(map[string]int),
+	}, nil
+}
+
+// scrub replaces every match in s with its stable placeholder
+func (a *anonymizer) scrub(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, rule := range a.rules {
+		name := rule.Name
+		s = rule.re.ReplaceAllStringFunc(s, func(value string) string {
+			return a.placeholder(name, value)
+		})
+	}
+	return s
+}
+
+// placeholder returns the placeholder for value, assigning the next number
+// for its rule on first sight
+func (a *anonymizer) placeholder(name, value string) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := name + "\x00" + value
+	if p, ok := a.placeholders[key]; ok {
+		return p
+	}
+	a.counts[name]++
+	p := fmt.Sprintf("<%s_%d>", name, a.counts[name])
+	a.placeholders[key] = p
+	return p
+}
+
+// apply scrubs the bodies, header values, and client addresses of an entry
+// in place
+func (a *anonymizer) apply(log *RequestLog) {
+	for name, value := range log.Headers {
+		log.Headers[name] = a.scrub(value)
+	}
+	for name, value := range log.ResponseHeaders {
+		log.ResponseHeaders[name] = a.scrub(value)
+	}
+	for i, node := range log.ForwardedFor {
+		log.ForwardedFor[i] = a.scrub(node)
+	}
+	log.OriginClientIP = a.scrub(log.OriginClientIP)
+	for i, node := range log.Via {
+		log.Via[i] = a.scrub(node)
+	}
+	log.Filename = a.scrub(log.Filename)
+	if log.Cache != nil {
+		log.Cache.ETag = a.scrub(log.Cache.ETag)
+		log.Cache.XCache = a.scrub(log.Cache.XCache)
+	}
+	log.RequestBody = a.scrub(log.RequestBody)
+	for _, values := range log.FormFields {
+		for i, value := range values {
+			values[i] = a.scrub(value)
+		}
+	}
+	log.ResponseBody = a.scrub(log.ResponseBody)
+	for i, event := range log.Events {
+		log.Events[i] = a.scrub(event)
+	}
+	for _, overflow := range []*BodyOverflow{log.RequestBodyOverflow, log.ResponseBodyOverflow} {
+		if overflow != nil {
+			overflow.BodyPreview = a.scrub(overflow.BodyPreview)
+			overflow.BodyHead = a.scrub(overflow.BodyHead)
+			overflow.BodyTail = a.scrub(overflow.BodyTail)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{Anonymize: true})
+	for _, body := range []string{
+		`{"email":"ada@example.com","ip":"203.0.113.7"}`,
+		`{"email":"bob@example.org","ip":"203.0.113.7","cc":"ada@example.com"}`,
+	} {
+		resp, err := client.Post(upstream.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	// The same value gets the same placeholder across entries
+	for i, want := range []string{
+		`{"email":"<email_1>","ip":"<ip_1>"}`,
+		`{"email":"<email_2>","ip":"<ip_1>","cc":"<email_1>"}`,
+	} {
+		if got := entries[i].RequestBody; got != want {
+			t.Errorf("entry %d body = %s, want %s", i, got, want)
+		}
+	}
+}
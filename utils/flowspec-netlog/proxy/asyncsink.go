@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWriteBuffer = 1024 // entries queued by FLOWSPEC_ASYNC_WRITES
+	asyncFlushInterval = time.Second
+
+	// What Write does when the queue is full, see FLOWSPEC_WRITE_BUFFER_FULL
+	writeBufferBlock = "block"
+	writeBufferDrop  = "drop"
+)
+
+// asyncFileSink takes log file writes off the capture path: Write queues
+// the entry, and a single goroutine encodes it into the file's buffer,
+// flushed every asyncFlushInterval and on Close. A full queue blocks the
+// writer, or with drop set discards the entry and counts it.
+type asyncFileSink struct {
+	mu      sync.Mutex // held by the writer goroutine while it uses file
+	file    *FileSink
+	queue   chan asyncItem
+	drop    bool
+	dropped atomic.Int64
+	err     error // first write error, returned by Close
+	done    chan struct{}
+}
+
+// asyncItem is a queued entry, or a rotation when rotate is set
+type asyncItem struct {
+	log    *RequestLog
+	rotate string
+	result chan error
+}
+
+// newAsyncFileSink starts the writer goroutine for file, which must buffer
+// its writes
+func newAsyncFileSink(file *FileSink, size int, drop bool) *asyncFileSink {
+	s := &asyncFileSink{
+		file:  file,
+		queue: make(chan asyncItem, size),
+		drop:  drop,
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// run writes queued entries in order until the queue is closed
+func (s *asyncFileSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(asyncFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case item, ok := <-s.queue:
+			s.mu.Lock()
+			if !ok {
+				s.fail(s.file.flush())
+				s.mu.Unlock()
+				return
+			}
+			if item.result != nil {
+				item.result <- s.file.rotate(item.rotate)
+			} else {
+				s.fail(s.file.Write(item.log))
+			}
+			s.mu.Unlock()
+		case <-ticker.C:
+			s.mu.Lock()
+			s.fail(s.file.flush())
+			s.mu.Unlock()
+		}
+	}
+}
+
+// fail records the first write error, warning about it since Write has
+// already returned
+func (s *asyncFileSink) fail(err error) {
+	if err != nil && s.err == nil {
+		s.err = err
+		fmt.Printf("Warning: failed to write log file: %v\n", err)
+	}
+}
+
+// Write queues log for the writer goroutine
+func (s *asyncFileSink) Write(log *RequestLog) error {
+	item := asyncItem{log: log}
+	if !s.drop {
+		s.queue <- item
+		return nil
+	}
+
+	select {
+	case s.queue <- item:
+	default:
+		if s.dropped.Add(1) == 1 {
+			fmt.Println("Warning: log write buffer full, dropping entries (see FLOWSPEC_WRITE_BUFFER)")
+		}
+	}
+	return nil
+}
+
+// Close writes the queued entries, flushes, and closes the file
+func (s *asyncFileSink) Close() error {
+	close(s.queue)
+	<-s.done
+	if err := s.file.Close(); err != nil && s.err == nil {
+		s.err = err
+	}
+	return s.err
+}
+
+// rotate switches files once the entries queued before it are written
+func (s *asyncFileSink) rotate(timestamp string) error {
+	result := make(chan error, 1)
+	s.queue <- asyncItem{rotate: timestamp, result: result}
+	return <-result
+}
+
+// Path returns the path of the active file
+func (s *asyncFileSink) Path() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Path()
+}
+
+// files returns every file written, including those closed by rotation
+func (s *asyncFileSink) files() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.files()
+}
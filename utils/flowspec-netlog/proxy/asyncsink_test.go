@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// burstEntries is how many entries a burst writes into a one-entry queue
+const burstEntries = 200
+
+// newTestAsyncSink returns an async sink with a one-entry queue, writing
+// to a log file in a temporary directory, and that file's path
+func newTestAsyncSink(t *testing.T, drop bool) (*asyncFileSink, string) {
+	t.Helper()
+	file, err := newFileSink(t.TempDir(), "t1", &SessionRecord{Type: sessionRecordType}, 0, 0, false, logFormatJSONL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAsyncFileSink(file, 1, drop), file.Path()
+}
+
+// writeBurst writes burstEntries entries to s, each with its own URL
+func writeBurst(t *testing.T, s *asyncFileSink) {
+	t.Helper()
+	for i := 0; i < burstEntries; i++ {
+		if err := s.Write(&RequestLog{Method: "GET", URL: fmt.Sprintf("http://example.com/%d", i), Host: "example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAsyncWritesBlockLosesNothing(t *testing.T) {
+	s, path := newTestAsyncSink(t, false)
+
+	// Stall the writer so the burst finds the queue full
+	s.mu.Lock()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s.mu.Unlock()
+	}()
+	writeBurst(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readEntries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != burstEntries {
+		t.Fatalf("got %d entries, want %d", len(entries), burstEntries)
+	}
+	for i, entry := range entries {
+		if want := fmt.Sprintf("http://example.com/%d", i); entry.URL != want {
+			t.Fatalf("entry %d url = %q, want %q", i, entry.URL, want)
+		}
+	}
+	if dropped := s.dropped.Load(); dropped != 0 {
+		t.Errorf("dropped = %d, want 0", dropped)
+	}
+}
+
+func TestAsyncWritesDropCounts(t *testing.T) {
+	s, path := newTestAsyncSink(t, true)
+
+	// Stall the writer so the burst finds the queue full
+	s.mu.Lock()
+	out := captureStdout(t, func() { writeBurst(t, s) })
+	s.mu.Unlock()
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dropped := s.dropped.Load()
+	if dropped == 0 {
+		t.Fatal("dropped = 0, want entries dropped")
+	}
+	entries, err := readEntries(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(entries))+dropped != burstEntries {
+		t.Errorf("%d entries written and %d dropped, want %d in all", len(entries), dropped, burstEntries)
+	}
+	if want := "log write buffer full"; !strings.Contains(out, want) {
+		t.Errorf("output %q does not warn %q", out, want)
+	}
+}
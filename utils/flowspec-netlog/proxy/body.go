@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultBodyPreviewBytes = 4 * 1024 // 4KB preview of bodies over the capture limit
+)
+
+// FLOWSPEC_JSON_BODY modes
+const (
+	jsonBodyRaw    = "raw"
+	jsonBodyPretty = "pretty"
+	jsonBodyMinify = "minify"
+)
+
+// BodyOverflow summarizes a body that exceeded the capture limit.
+// BodyPreview holds its first bytes. With FLOWSPEC_BODY_TAIL_BYTES=N,
+// BodyHead holds its first N bytes and BodyTail up to N bytes from its end,
+// where APIs often put the error; the tail starts after the head.
+type BodyOverflow struct {
+	BodyPreview string `json:"body_preview"`
+	BodyHead    string `json:"body_head,omitempty"`
+	BodyTail    string `json:"body_tail,omitempty"`
+	BodyHash    string `json:"body_hash"`
+	BodyLength  int64  `json:"body_length"`
+}
+
+// shouldCaptureBody reports whether a body with this content type should be
+// stored. With an empty allowlist any json, text, or xml type is captured;
+// otherwise the media type must start with one of the allowed prefixes.
+func shouldCaptureBody(contentType string, allow []string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if len(allow) == 0 {
+		return strings.Contains(contentType, "json") ||
+			strings.Contains(contentType, "text") ||
+			strings.Contains(contentType, "xml")
+	}
+
+	for _, prefix := range allow {
+		if strings.HasPrefix(contentType, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBody returns the logged form of a captured body. Valid JSON is
+// re-indented or compacted according to mode; anything else is kept as-is.
+// Only the logged copy is affected, never the forwarded bytes.
+func formatBody(body []byte, mode string) string {
+	if mode != jsonBodyPretty && mode != jsonBodyMinify || !json.Valid(body) {
+		return string(body)
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if mode == jsonBodyPretty {
+		err = json.Indent(&buf, body, "", "  ")
+	} else {
+		err = json.Compact(&buf, body)
+	}
+	if err != nil {
+		return string(body)
+	}
+	return buf.String()
+}
+
+// bodyHash returns the hex SHA-256 of body
+func bodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// bodyTap wraps a body that cannot be buffered up front (too large or of
+// unknown length). It forwards every byte unchanged while keeping the first
+// keep bytes, optionally the first and last tail bytes, and a running
+// SHA-256 of the stream.
+type bodyTap struct {
+	mu      sync.Mutex
+	body    io.ReadCloser
+	hash    hash.Hash
+	buf     []byte
+	keep    int
+	preview int
+	head    int       // FLOWSPEC_BODY_TAIL_BYTES, kept from the start of buf
+	tail    *tailRing // nil unless FLOWSPEC_BODY_TAIL_BYTES is set
+	length  int64
+	done    bool
+	eof     bool  // read to the end, not just closed
+	err     error // the body failed partway
+	onDone  func(*bodyTap)
+}
+
+// newBodyTap wraps body, retaining up to keep bytes from the start and tail
+// bytes from each end. onDone (optional) runs once when the body reaches EOF
+// or is closed.
+func newBodyTap(body io.ReadCloser, keep, preview, tail int, onDone func(*bodyTap)) *bodyTap {
+	if keep < preview {
+		keep = preview
+	}
+	if keep < tail {
+		keep = tail
+	}
+	t := &bodyTap{
+		body:    body,
+		hash:    sha256.New(),
+		keep:    keep,
+		preview: preview,
+		onDone:  onDone,
+	}
+	if tail > 0 {
+		t.head = tail
+		t.tail = newTailRing(tail)
+	}
+	return t
+}
+
+// Read implements io.Reader
+func (t *bodyTap) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+
+	t.mu.Lock()
+	t.hash.Write(p[:n])
+	t.length += int64(n)
+	if room := t.keep - len(t.buf); room > 0 {
+		if room > n {
+			room = n
+		}
+		t.buf = append(t.buf, p[:room]...)
+	}
+	if t.tail != nil {
+		t.tail.Write(p[:n])
+	}
+	t.eof = t.eof || err == io.EOF
+	if err != nil && err != io.EOF && t.err == nil {
+		t.err = err
+	}
+	t.mu.Unlock()
+
+	if err == io.EOF {
+		t.finish()
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (t *bodyTap) Close() error {
+	err := t.body.Close()
+	t.finish()
+	return err
+}
+
+// finish runs the completion callback exactly once
+func (t *bodyTap) finish() {
+	t.mu.Lock()
+	if t.done {
+		t.mu.Unlock()
+		return
+	}
+	t.done = true
+	t.mu.Unlock()
+
+	if t.onDone != nil {
+		t.onDone(t)
+	}
+}
+
+// sum returns the hex SHA-256 of the body, or "" when it was closed before
+// being read to the end
+func (t *bodyTap) sum() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.eof {
+		return ""
+	}
+	return hex.EncodeToString(t.hash.Sum(nil))
+}
+
+// readErr returns the error the body failed with, if any. A body closed
+// before its end, such as by a client that went away, fails with
+// errBodyClosedEarly.
+func (t *bodyTap) readErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil && t.done && !t.eof {
+		return errBodyClosedEarly
+	}
+	return t.err
+}
+
+// result returns the full body when the stream completed within limit bytes,
+// otherwise a preview/hash summary of the bytes read so far
+func (t *bodyTap) result(limit int) ([]byte, *BodyOverflow) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done && t.length <= int64(limit) {
+		return t.buf, nil
+	}
+
+	preview := t.buf
+	if len(preview) > t.preview {
+		preview = preview[:t.preview]
+	}
+	overflow := &BodyOverflow{
+		BodyPreview: string(preview),
+		BodyHash:    hex.EncodeToString(t.hash.Sum(nil)),
+		BodyLength:  t.length,
+	}
+	if t.tail != nil {
+		head := t.buf
+		if len(head) > t.head {
+			head = head[:t.head]
+		}
+		overflow.BodyHead = string(head)
+		// The tail holds only bytes after the head, so a body shorter than
+		// twice the tail size is not repeated
+		tail := t.tail.bytes()
+		if after := t.length - int64(len(head)); after < int64(len(tail)) {
+			tail = tail[int64(len(tail))-after:]
+		}
+		overflow.BodyTail = string(tail)
+	}
+	return nil, overflow
+}
+
+// tailRing keeps the last bytes written to it in a fixed buffer, so the end
+// of a body of any size is kept without buffering the rest
+type tailRing struct {
+	buf  []byte
+	next int  // where the next byte goes
+	full bool // buf has wrapped at least once
+}
+
+func newTailRing(size int) *tailRing {
+	return &tailRing{buf: make([]byte, size)}
+}
+
+// Write implements io.Writer
+func (r *tailRing) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= len(r.buf) {
+		// Only the end of p survives
+		copy(r.buf, p[n-len(r.buf):])
+		r.next, r.full = 0, true
+		return n, nil
+	}
+	copied := copy(r.buf[r.next:], p)
+	if copied < n {
+		copy(r.buf, p[copied:])
+		r.full = true
+	}
+	r.next = (r.next + n) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+	return n, nil
+}
+
+// bytes returns the kept bytes, oldest first
+func (r *tailRing) bytes() []byte {
+	if !r.full {
+		return append([]byte(nil), r.buf[:r.next]...)
+	}
+	return append(append([]byte(nil), r.buf[r.next:]...), r.buf[:r.next]...)
+}
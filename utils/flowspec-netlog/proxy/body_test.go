@@ -0,0 +1,301 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyTapClosedEarly(t *testing.T) {
+	tap := newBodyTap(io.NopCloser(strings.NewReader("hello world")), 64, 16, 0, nil)
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(tap, buf); err != nil {
+		t.Fatal(err)
+	}
+	tap.Close()
+
+	if err := tap.readErr(); !errors.Is(err, errBodyClosedEarly) {
+		t.Errorf("readErr() = %v, want errBodyClosedEarly", err)
+	}
+	if tap.sum() != "" {
+		t.Error("sum() of a partial body should be empty")
+	}
+}
+
+func TestBodyTapReadToEnd(t *testing.T) {
+	tap := newBodyTap(io.NopCloser(strings.NewReader("hello world")), 64, 16, 0, nil)
+	if _, err := io.ReadAll(tap); err != nil {
+		t.Fatal(err)
+	}
+	tap.Close()
+
+	if err := tap.readErr(); err != nil {
+		t.Errorf("readErr() = %v, want nil", err)
+	}
+	body, overflow := tap.result(64)
+	if string(body) != "hello world" || overflow != nil {
+		t.Errorf("result() = %q, %v", body, overflow)
+	}
+}
+
+func TestBodyTapHeadAndTail(t *testing.T) {
+	var b strings.Builder
+	for i := 0; b.Len() < 10000; i++ {
+		fmt.Fprintf(&b, "%d,", i)
+	}
+	body := b.String() + `{"error":"quota exceeded"}`
+
+	for _, tc := range []struct {
+		name      string
+		length    int
+		head, end int // expected slices of the body
+	}{
+		{"large", len(body), 64, len(body) - 64},
+		{"under twice the tail", 100, 64, 64}, // tail starts after the head
+		{"within the head", 40, 40, 40},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			full := body[:tc.length]
+			tap := newBodyTap(io.NopCloser(strings.NewReader(full)), 16, 16, 64, nil)
+			if _, err := io.Copy(io.Discard, tap); err != nil {
+				t.Fatal(err)
+			}
+			_, overflow := tap.result(20)
+			if overflow == nil {
+				t.Fatal("no overflow for a body over the limit")
+			}
+			if overflow.BodyHead != full[:tc.head] {
+				t.Errorf("head = %q, want %q", overflow.BodyHead, full[:tc.head])
+			}
+			if overflow.BodyTail != full[tc.end:] {
+				t.Errorf("tail = %q, want %q", overflow.BodyTail, full[tc.end:])
+			}
+			if overflow.BodyPreview != full[:16] {
+				t.Errorf("preview = %q, want %q", overflow.BodyPreview, full[:16])
+			}
+		})
+	}
+}
+
+func TestShouldCaptureBody(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		allow       []string
+		want        bool
+	}{
+		{"application/json", nil, true},
+		{"application/problem+json; charset=utf-8", nil, true},
+		{"text/html", nil, true},
+		{"application/xml", nil, true},
+		{"image/png", nil, false},
+		{"application/octet-stream", nil, false},
+		{"", nil, false},
+		{"application/json", []string{"text/"}, false},
+		{"text/csv", []string{"text/"}, true},
+		{" Text/CSV ", []string{"text/"}, true},
+		{"image/png", []string{"application/json", "image/"}, true},
+		{"application/grpc", []string{"application/json", "image/"}, false},
+		{"application/x-ndjson", []string{"Application/X-NDJSON"}, true},
+	} {
+		if got := shouldCaptureBody(tc.contentType, tc.allow); got != tc.want {
+			t.Errorf("shouldCaptureBody(%q, %q) = %v, want %v", tc.contentType, tc.allow, got, tc.want)
+		}
+	}
+}
+
+func TestFormatBody(t *testing.T) {
+	const spaced = `{ "user": {"id": 42,  "tags": ["a", "b"]} }`
+	for _, tc := range []struct {
+		mode string
+		body string
+		want string
+	}{
+		{jsonBodyRaw, spaced, spaced},
+		{"", spaced, spaced},
+		{jsonBodyMinify, spaced, `{"user":{"id":42,"tags":["a","b"]}}`},
+		{jsonBodyPretty, spaced, "{\n  \"user\": {\n    \"id\": 42,\n    \"tags\": [\n      \"a\",\n      \"b\"\n    ]\n  }\n}"},
+		// Anything that is not valid JSON is kept as it was
+		{jsonBodyPretty, `{"user": 42`, `{"user": 42`},
+		{jsonBodyMinify, "plain  text", "plain  text"},
+		{jsonBodyMinify, "", ""},
+	} {
+		if got := formatBody([]byte(tc.body), tc.mode); got != tc.want {
+			t.Errorf("formatBody(%q, %q) = %q, want %q", tc.body, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestCaptureHeader(t *testing.T) {
+	forwarded := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded <- r.Header.Get(CaptureHeader)
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("response"))
+	}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		noBodies bool
+		value    string
+		want     bool
+	}{
+		{false, "", true},
+		{false, "bodies", true},
+		{false, "none", false},
+		{false, " None ", false},
+		{false, "unknown", true},
+		{true, "", false},
+		{true, "bodies", true},
+		{true, "BODIES", true},
+		{true, "none", false},
+		{true, "unknown", false},
+	} {
+		p, client := newTestProxy(t, Options{NoBodies: tc.noBodies})
+		req, err := http.NewRequest(http.MethodPost, upstream.URL, strings.NewReader("request"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.value != "" {
+			req.Header.Set(CaptureHeader, tc.value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := <-forwarded; got != "" {
+			t.Errorf("NoBodies %v, %q: %s forwarded as %q", tc.noBodies, tc.value, CaptureHeader, got)
+		}
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 1 {
+			t.Fatalf("got %d entries, want 1", len(entries))
+		}
+		captured := entries[0].RequestBody == "request" && entries[0].ResponseBody == "response"
+		empty := entries[0].RequestBody == "" && entries[0].ResponseBody == ""
+		if captured != tc.want || !captured && !empty {
+			t.Errorf("NoBodies %v, %q: bodies %q and %q, want captured %v",
+				tc.noBodies, tc.value, entries[0].RequestBody, entries[0].ResponseBody, tc.want)
+		}
+	}
+}
+
+func TestBodyHashes(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write([]byte(`{"compressed":true}`))
+	zw.Close()
+	responses := map[string]struct {
+		contentType, encoding string
+		body                  []byte
+	}{
+		"/json":   {"application/json", "", []byte(`{"b":1,  "a":[2]}`)},
+		"/gzip":   {"application/json", "gzip", gzipped.Bytes()},
+		"/binary": {"application/octet-stream", "", []byte{0x00, 0xff, 0x10, 0x80}},
+		"/large":  {"text/plain", "", bytes.Repeat([]byte("0123456789abcdef"), maxBodySize/16+100)},
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		resp := responses[r.URL.Path]
+		w.Header().Set("Content-Type", resp.contentType)
+		if resp.encoding != "" {
+			w.Header().Set("Content-Encoding", resp.encoding)
+		}
+		w.Write(resp.body)
+	}))
+	defer upstream.Close()
+
+	const reqBody = `{"name": "ada"}`
+	p, client := newTestProxy(t, Options{BodyHashes: true, JSONBody: "pretty"})
+	paths := []string{"/json", "/gzip", "/binary", "/large"}
+	received := make(map[string][]byte)
+	for _, path := range paths {
+		resp, err := client.Post(upstream.URL+path, "application/json", strings.NewReader(reqBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		received[path], err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != len(paths) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(paths))
+	}
+	// The hashes are of the bytes as relayed, before pretty-printing, and of
+	// the whole body even when only part is stored. goproxy's transport
+	// decodes gzip on the way in, so the client gets the plain body.
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+	if got := string(received["/gzip"]); got != `{"compressed":true}` {
+		t.Errorf("client got %q for the gzipped response, want it decoded", got)
+	}
+	for i, path := range paths {
+		entry := entries[i]
+		if path != "/gzip" && !bytes.Equal(received[path], responses[path].body) {
+			t.Errorf("%s: client got a different body than the upstream sent", path)
+		}
+		if want := digest([]byte(reqBody)); entry.RequestBodyHash != want {
+			t.Errorf("%s: request body hash %s, want %s", path, entry.RequestBodyHash, want)
+		}
+		if want := digest(received[path]); entry.ResponseBodyHash != want {
+			t.Errorf("%s: response body hash %s, want %s", path, entry.ResponseBodyHash, want)
+		}
+	}
+}
+
+func TestBodiesOnErrorOnly(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "internal failure")
+			return
+		}
+		io.WriteString(w, "all good")
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{BodiesOnErrorOnly: true})
+	for _, path := range []string{"/fail", "/ok"} {
+		resp, err := client.Post(upstream.URL+path, "text/plain", strings.NewReader("request payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, tc := range []struct {
+		entry        *RequestLog
+		status       int
+		requestBody  string
+		responseBody string
+	}{
+		{entries[0], http.StatusInternalServerError, "request payload", "internal failure"},
+		{entries[1], http.StatusOK, "", ""},
+	} {
+		entry := tc.entry
+		if entry.StatusCode != tc.status || entry.RequestBody != tc.requestBody || entry.ResponseBody != tc.responseBody {
+			t.Errorf("entry status %d, request body %q, response body %q; want %d, %q, %q",
+				entry.StatusCode, entry.RequestBody, entry.ResponseBody, tc.status, tc.requestBody, tc.responseBody)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hostBodyLimits maps upstream hosts, with or without a port, to the body
+// capture limit used for them instead of maxBodySize
+// (FLOWSPEC_HOST_BODY_LIMITS)
+type hostBodyLimits map[string]int
+
+// parseHostBodyLimits parses host=size items, sizes as for
+// FLOWSPEC_DISK_BUDGET (100000, 64KB, 10MB)
+func parseHostBodyLimits(items []string) (map[string]int, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	limits := make(map[string]int, len(items))
+	for _, item := range items {
+		host, value, ok := strings.Cut(item, "=")
+		host, value = strings.TrimSpace(host), strings.TrimSpace(value)
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid host body limit %q: want host=size", item)
+		}
+		size, err := parseSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host body limit %q: %w", item, err)
+		}
+		limits[strings.ToLower(host)] = int(size)
+	}
+	return limits, nil
+}
+
+// limit returns the limit for addr, a host:port, matching the mapping with
+// the port first and then the bare host, or def when neither is mapped
+func (h hostBodyLimits) limit(addr string, def int) int {
+	if len(h) == 0 {
+		return def
+	}
+	addr = strings.ToLower(addr)
+	if limit, ok := h[addr]; ok {
+		return limit
+	}
+	if limit, ok := h[hostOnly(addr)]; ok {
+		return limit
+	}
+	return def
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHostBodyLimit(t *testing.T) {
+	limits, err := parseHostBodyLimits([]string{"API.example.com=64KB", "api.example.com:8443=100", " cdn.example.com = 2MB "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		addr string
+		want int
+	}{
+		{"api.example.com:443", 64 * 1024},
+		{"api.example.com:8443", 100},
+		{"cdn.example.com:443", 2 * 1024 * 1024},
+		{"other.example.com:443", maxBodySize},
+	} {
+		if got := hostBodyLimits(limits).limit(tc.addr, maxBodySize); got != tc.want {
+			t.Errorf("limit(%q) = %d, want %d", tc.addr, got, tc.want)
+		}
+	}
+
+	for _, items := range [][]string{{"api.example.com"}, {"=10"}, {"api.example.com=lots"}} {
+		if _, err := parseHostBodyLimits(items); err == nil {
+			t.Errorf("parseHostBodyLimits(%q) succeeded, want an error", items)
+		}
+	}
+}
+
+func TestHostBodyLimitsTruncate(t *testing.T) {
+	// The body is as long as the size query asks
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		io.WriteString(w, strings.Repeat("x", size))
+	})
+	small := httptest.NewServer(handler)
+	defer small.Close()
+	large := httptest.NewServer(handler)
+	defer large.Close()
+
+	p, client := newTestProxy(t, Options{HostBodyLimits: map[string]int{
+		strings.TrimPrefix(small.URL, "http://"): 10,
+		strings.TrimPrefix(large.URL, "http://"): 40,
+	}})
+	// Each host keeps a body at its limit and truncates one a byte over
+	cases := []struct {
+		url       string
+		size      int
+		truncated bool
+	}{
+		{small.URL, 10, false},
+		{small.URL, 11, true},
+		{large.URL, 40, false},
+		{large.URL, 41, true},
+	}
+	for _, tc := range cases {
+		resp, err := client.Get(fmt.Sprintf("%s/?size=%d", tc.url, tc.size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != len(cases) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(cases))
+	}
+	for i, tc := range cases {
+		entry := entries[i]
+		truncated := entry.ResponseBodyOverflow != nil
+		if truncated != tc.truncated || (!truncated && len(entry.ResponseBody) != tc.size) {
+			t.Errorf("%s: truncated %v with body length %d, want truncated %v", entry.URL, truncated, len(entry.ResponseBody), tc.truncated)
+		}
+		if truncated && entry.ResponseBodyOverflow.BodyLength != int64(tc.size) {
+			t.Errorf("%s: overflow length %d, want %d", entry.URL, entry.ResponseBodyOverflow.BodyLength, tc.size)
+		}
+	}
+}
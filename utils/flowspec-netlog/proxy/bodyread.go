@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// errBodyClosed is returned when reading a body after it was closed
+var errBodyClosed = errors.New("body closed")
+
+// errBodyTimeout is returned by readBody when the body did not arrive in time
+var errBodyTimeout = errors.New("body read timed out")
+
+// errBodyClosedEarly marks a streamed body closed before it was read to the end
+var errBodyClosedEarly = errors.New("body closed before the end")
+
+const (
+	bodyReadTimeout = 10 * time.Second // longest wait for a body captured before forwarding
+	bodyReadChunk   = 32 * 1024
+)
+
+// readBody reads up to limit bytes of body for capture, giving up after
+// timeout so a slow sender cannot stall the capture path. It returns the
+// bytes read and a ReadCloser to forward in place of body: on success it
+// replays them followed by the rest of body, and on timeout or error it
+// replays whatever had arrived and continues where the read left off. When
+// reading body fails, the bytes that arrived are returned with the error.
+func readBody(body io.ReadCloser, limit int64, timeout time.Duration) ([]byte, io.ReadCloser, error) {
+	r := &chunkReader{chunks: make(chan []byte), stop: make(chan struct{}), body: body}
+	go r.fill(io.LimitReader(body, limit))
+
+	var buf bytes.Buffer
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case chunk, ok := <-r.chunks:
+			if ok {
+				buf.Write(chunk)
+				continue
+			}
+			restored := readCloser{io.MultiReader(bytes.NewReader(buf.Bytes()), r), r}
+			if r.err != io.EOF {
+				return buf.Bytes(), restored, r.err
+			}
+			return buf.Bytes(), restored, nil
+		case <-timer.C:
+			restored := readCloser{io.MultiReader(bytes.NewReader(buf.Bytes()), r), r}
+			return nil, restored, fmt.Errorf("%w after %s", errBodyTimeout, timeout)
+		}
+	}
+}
+
+// chunkReader hands over the chunks read by fill, then reads body directly
+// once fill has finished
+type chunkReader struct {
+	chunks   chan []byte
+	stop     chan struct{}
+	stopOnce sync.Once
+	err      error // set by fill before chunks is closed
+	body     io.ReadCloser
+	cur      []byte
+	done     bool
+}
+
+// fill reads r in chunks until EOF, an error, or Close
+func (c *chunkReader) fill(r io.Reader) {
+	defer close(c.chunks)
+	for {
+		buf := make([]byte, bodyReadChunk)
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-c.stop:
+				c.err = errBodyClosed
+				return
+			}
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// Close stops fill and closes the body
+func (c *chunkReader) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	return c.body.Close()
+}
+
+// Read implements io.Reader
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.cur) == 0 && !c.done {
+		chunk, ok := <-c.chunks
+		if !ok {
+			c.done = true
+			break
+		}
+		c.cur = chunk
+	}
+	if len(c.cur) > 0 {
+		n := copy(p, c.cur)
+		c.cur = c.cur[n:]
+		return n, nil
+	}
+	if c.err != io.EOF {
+		return 0, c.err
+	}
+	return c.body.Read(p)
+}
+
+// readCloser pairs a reader with the Closer of the body it replaces
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// slowBody returns its first part at once and the rest only after release
+// is closed
+type slowBody struct {
+	parts   []string
+	release chan struct{}
+	closed  bool
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	if len(b.parts) == 0 {
+		return 0, io.EOF
+	}
+	if len(b.parts) == 1 {
+		<-b.release
+	}
+	n := copy(p, b.parts[0])
+	b.parts = b.parts[1:]
+	return n, nil
+}
+
+func (b *slowBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestReadBodySlow(t *testing.T) {
+	body := &slowBody{parts: []string{"first,", "second"}, release: make(chan struct{})}
+	start := time.Now()
+	captured, restored, err := readBody(body, 1024, 50*time.Millisecond)
+	if !errors.Is(err, errBodyTimeout) {
+		t.Fatalf("err = %v, want %v", err, errBodyTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("readBody took %s, want about the timeout", elapsed)
+	}
+	if captured != nil {
+		t.Errorf("captured %q, want nothing", captured)
+	}
+
+	// The whole body is still forwarded once the sender catches up
+	close(body.release)
+	forwarded, err := io.ReadAll(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(forwarded) != "first,second" {
+		t.Errorf("forwarded %q, want %q", forwarded, "first,second")
+	}
+	restored.Close()
+	if !body.closed {
+		t.Error("closing the restored body did not close the original")
+	}
+}
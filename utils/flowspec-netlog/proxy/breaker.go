@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	panicLimit  = 5 // panics within panicWindow that disable a feature
+	panicWindow = time.Minute
+)
+
+// panicBreaker contains panics in capture code. A capture feature that
+// panics panicLimit times within panicWindow is disabled for the rest of the
+// session while requests keep being proxied.
+type panicBreaker struct {
+	mu       sync.Mutex
+	total    int
+	features map[string]*featurePanics
+}
+
+// featurePanics tracks the panics of one capture feature
+type featurePanics struct {
+	recent   []time.Time
+	disabled bool
+}
+
+func newPanicBreaker() *panicBreaker {
+	return &panicBreaker{features: make(map[string]*featurePanics)}
+}
+
+// guard runs fn unless feature has been disabled, recovering a panic. detail
+// (such as the request URL) is included in the warning. It reports whether
+// fn ran to completion.
+func (b *panicBreaker) guard(feature, detail string, fn func()) (ok bool) {
+	if b.disabled(feature) {
+		return false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			b.record(feature, detail, r, time.Now())
+			ok = false
+		}
+	}()
+	fn()
+	return true
+}
+
+// disabled reports whether feature has been disabled
+func (b *panicBreaker) disabled(feature string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.features[feature]
+	return state != nil && state.disabled
+}
+
+// record counts a panic in feature, warning on the first one and disabling
+// the feature once it exceeds the limit
+func (b *panicBreaker) record(feature, detail string, r interface{}, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.total++
+	state := b.features[feature]
+	if state == nil {
+		state = &featurePanics{}
+		b.features[feature] = state
+		fmt.Printf("Warning: recovered panic in %s (%s): %v\n%s", feature, detail, r, debug.Stack())
+	}
+
+	recent := state.recent[:0]
+	for _, t := range state.recent {
+		if now.Sub(t) < panicWindow {
+			recent = append(recent, t)
+		}
+	}
+	state.recent = append(recent, now)
+
+	if len(state.recent) >= panicLimit && !state.disabled {
+		state.disabled = true
+		fmt.Printf("Warning: disabling %s after %d panics in %s; requests are still proxied\n",
+			feature, len(state.recent), panicWindow)
+	}
+}
+
+// stats returns the panic count and the disabled features
+func (b *panicBreaker) stats() (int, []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	disabled := []string{}
+	for feature, state := range b.features {
+		if state.disabled {
+			disabled = append(disabled, feature)
+		}
+	}
+	sort.Strings(disabled)
+	return b.total, disabled
+}
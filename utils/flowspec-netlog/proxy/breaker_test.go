@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// panicSink panics on every write
+type panicSink struct {
+	writes int
+}
+
+func (s *panicSink) Write(log *RequestLog) error {
+	s.writes++
+	panic("sink bug")
+}
+
+func (s *panicSink) Close() error { return nil }
+
+func TestBreakerDisablesPanickingFeature(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	sink := &panicSink{}
+	hookCalls := 0
+	p, client := newTestProxy(t, Options{
+		Sinks: []Sink{sink},
+		OnRequestHook: func(req *http.Request) *http.Response {
+			hookCalls++
+			panic("hook bug")
+		},
+	})
+
+	const requests = panicLimit + 3
+	for i := 0; i < requests; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, resp.StatusCode)
+		}
+	}
+
+	// Each feature ran until its panicLimit-th panic, then stopped
+	if sink.writes != panicLimit || hookCalls != panicLimit {
+		t.Errorf("sink writes %d, hook calls %d; want %d each", sink.writes, hookCalls, panicLimit)
+	}
+	total, disabled := p.logger.breaker.stats()
+	if want := []string{"request hook", "sink *proxy.panicSink"}; total != 2*panicLimit || !reflect.DeepEqual(disabled, want) {
+		t.Errorf("breaker stats = %d panics, disabled %q; want %d and %q", total, disabled, 2*panicLimit, want)
+	}
+
+	// The log file still got every entry
+	if entries := closeAndRead(t, p); len(entries) != requests {
+		t.Errorf("got %d entries, want %d", len(entries), requests)
+	}
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheableStatus are the status codes a cache may store without explicit
+// freshness (RFC 9110 section 15.1)
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 206: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// CacheInfo summarizes the caching headers of a response. Cacheable is a
+// shared-cache heuristic: a GET or HEAD response with a storable status,
+// neither no-store nor private, that is fresh for a while or carries a
+// validator. FromCache says a cache in front of the origin answered: Age is
+// positive or X-Cache reports a hit.
+type CacheInfo struct {
+	MaxAge         *int64 `json:"max_age,omitempty"`
+	SMaxAge        *int64 `json:"s_maxage,omitempty"`
+	NoStore        bool   `json:"no_store,omitempty"`
+	NoCache        bool   `json:"no_cache,omitempty"`
+	Private        bool   `json:"private,omitempty"`
+	Public         bool   `json:"public,omitempty"`
+	MustRevalidate bool   `json:"must_revalidate,omitempty"`
+	Immutable      bool   `json:"immutable,omitempty"`
+	Expires        string `json:"expires,omitempty"` // RFC 3339 when valid, else as sent
+	ETag           string `json:"etag,omitempty"`
+	Age            *int64 `json:"age,omitempty"`
+	XCache         string `json:"x_cache,omitempty"`
+	Cacheable      bool   `json:"cacheable"`
+	FromCache      bool   `json:"from_cache"`
+}
+
+// parseCacheInfo reads the caching headers of a response to method, or
+// returns nil if it has none
+func parseCacheInfo(method string, resp *http.Response) *CacheInfo {
+	h := resp.Header
+	cacheControl := strings.Join(h.Values("Cache-Control"), ",")
+	expires, etag, age, xCache := h.Get("Expires"), h.Get("ETag"), h.Get("Age"), h.Get("X-Cache")
+	if cacheControl == "" && expires == "" && etag == "" && age == "" && xCache == "" {
+		return nil
+	}
+
+	c := &CacheInfo{ETag: etag, XCache: xCache}
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "max-age":
+			c.MaxAge = parseSeconds(value)
+		case "s-maxage":
+			c.SMaxAge = parseSeconds(value)
+		case "no-store":
+			c.NoStore = true
+		case "no-cache":
+			c.NoCache = true
+		case "private":
+			c.Private = true
+		case "public":
+			c.Public = true
+		case "must-revalidate":
+			c.MustRevalidate = true
+		case "immutable":
+			c.Immutable = true
+		}
+	}
+
+	// An Expires date that does not parse, such as 0, means already expired
+	var lifetime int64
+	if expires != "" {
+		c.Expires = expires
+		if t, err := http.ParseTime(expires); err == nil {
+			c.Expires = t.UTC().Format(time.RFC3339)
+			date, err := http.ParseTime(h.Get("Date"))
+			if err != nil {
+				date = time.Now()
+			}
+			lifetime = int64(t.Sub(date).Seconds())
+		}
+	}
+	// s-maxage, then max-age, override Expires for shared caches
+	switch {
+	case c.SMaxAge != nil:
+		lifetime = *c.SMaxAge
+	case c.MaxAge != nil:
+		lifetime = *c.MaxAge
+	}
+	if age != "" {
+		c.Age = parseSeconds(age)
+	}
+
+	c.Cacheable = (method == http.MethodGet || method == http.MethodHead) &&
+		cacheableStatus[resp.StatusCode] && !c.NoStore && !c.Private &&
+		(lifetime > 0 || etag != "" || h.Get("Last-Modified") != "")
+	c.FromCache = c.Age != nil && *c.Age > 0 ||
+		strings.Contains(strings.ToUpper(xCache), "HIT")
+	return c
+}
+
+// parseSeconds parses a delta-seconds value, or returns nil if it is invalid
+func parseSeconds(value string) *int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return nil
+	}
+	return &n
+}
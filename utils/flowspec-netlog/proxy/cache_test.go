@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseCacheInfo(t *testing.T) {
+	seconds := func(n int64) *int64 { return &n }
+	for _, tc := range []struct {
+		name   string
+		method string
+		status int
+		header http.Header
+		want   *CacheInfo
+	}{
+		{
+			"cache hit", "GET", 200,
+			http.Header{"Cache-Control": {"public, max-age=300"}, "X-Cache": {"HIT"}},
+			&CacheInfo{MaxAge: seconds(300), Public: true, XCache: "HIT", Cacheable: true, FromCache: true},
+		},
+		{
+			"aged shared response", "GET", 200,
+			http.Header{"Cache-Control": {`s-maxage="60"`, "must-revalidate"}, "Age": {"12"}, "X-Cache": {"MISS"}},
+			&CacheInfo{SMaxAge: seconds(60), MustRevalidate: true, Age: seconds(12), XCache: "MISS", Cacheable: true, FromCache: true},
+		},
+		{
+			"no-store", "GET", 200,
+			http.Header{"Cache-Control": {"no-store, max-age=300"}},
+			&CacheInfo{MaxAge: seconds(300), NoStore: true},
+		},
+		{
+			"private", "GET", 200,
+			http.Header{"Cache-Control": {"private, max-age=300"}},
+			&CacheInfo{MaxAge: seconds(300), Private: true},
+		},
+		{
+			"POST", "POST", 200,
+			http.Header{"Cache-Control": {"max-age=300"}},
+			&CacheInfo{MaxAge: seconds(300)},
+		},
+		{
+			"validator only", "HEAD", 404,
+			http.Header{"Etag": {`"v1"`}},
+			&CacheInfo{ETag: `"v1"`, Cacheable: true},
+		},
+		{
+			"expires", "GET", 200,
+			http.Header{"Expires": {"Thu, 25 Dec 2025 13:00:00 GMT"}, "Date": {"Thu, 25 Dec 2025 12:00:00 GMT"}},
+			&CacheInfo{Expires: "2025-12-25T13:00:00Z", Cacheable: true},
+		},
+		{
+			"already expired", "GET", 200,
+			http.Header{"Expires": {"0"}, "Cache-Control": {"max-age=oops"}},
+			&CacheInfo{Expires: "0"},
+		},
+		{"no caching headers", "GET", 200, http.Header{}, nil},
+	} {
+		got := parseCacheInfo(tc.method, &http.Response{StatusCode: tc.status, Header: tc.header})
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
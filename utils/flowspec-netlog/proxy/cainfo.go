@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNoCA is returned by LoadExistingCA when no CA has been generated yet
+var ErrNoCA = errors.New("no CA certificate")
+
+// CAInfo describes a CA certificate
+type CAInfo struct {
+	Path        string    `json:"path"`
+	Subject     string    `json:"subject"`
+	Serial      string    `json:"serial"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	DaysLeft    int       `json:"days_left"`
+	KeyType     string    `json:"key_type"`
+	KeyBits     int       `json:"key_bits"`
+	Fingerprint string    `json:"fingerprint"` // hex SHA-256 of the certificate
+}
+
+// LoadExistingCA loads the CA NewCertManagerFromOptions would use, without
+// generating one. It returns an error wrapping ErrNoCA when opts.LogDir has
+// no CA yet.
+func LoadExistingCA(opts Options) (*CertManager, error) {
+	opts = opts.withDefaults()
+	if opts.CACertFile != "" || opts.CAKeyFile != "" {
+		return NewCertManagerFromOptions(opts)
+	}
+
+	dir := filepath.Join(opts.LogDir, ".certs")
+	cm := &CertManager{
+		certDir:    dir,
+		certPath:   filepath.Join(dir, "flowspec-ca.crt"),
+		keyPath:    filepath.Join(dir, "flowspec-ca.key"),
+		systemCert: filepath.Join(dir, "flowspec-ca-system.crt"),
+	}
+	if _, err := os.Stat(cm.certPath); errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCA, dir)
+	}
+	cm, err := cm.loadExisting()
+	if errors.Is(err, fs.ErrPermission) {
+		return nil, certPermissionError(dir, err)
+	}
+	return cm, err
+}
+
+// RenewCA replaces the CA in opts.LogDir with a new certificate, valid from
+// now, leaving the logs untouched. keepKey signs it with the existing key,
+// so clients that trust the old certificate keep accepting the proxy's host
+// certificates; otherwise a new key is generated and clients must trust the
+// new certificate. A CA from FLOWSPEC_CA_CERT is not renewed.
+func RenewCA(opts Options, keepKey bool) (*CertManager, error) {
+	opts = opts.withDefaults()
+	if opts.CACertFile != "" || opts.CAKeyFile != "" {
+		return nil, errors.New("the CA set by FLOWSPEC_CA_CERT and FLOWSPEC_CA_KEY must be renewed by its issuer")
+	}
+
+	cm, err := LoadExistingCA(opts)
+	if err != nil {
+		return nil, err
+	}
+	if !keepKey {
+		cm.caKey = nil
+	}
+	renewed, err := cm.generate()
+	if errors.Is(err, fs.ErrPermission) {
+		return nil, certPermissionError(cm.certDir, err)
+	}
+	return renewed, err
+}
+
+// Info describes the CA certificate
+func (cm *CertManager) Info() CAInfo {
+	cert := cm.caCert
+	sum := sha256.Sum256(cert.Raw)
+	info := CAInfo{
+		Path:        cm.systemCert,
+		Subject:     cert.Subject.String(),
+		Serial:      hex.EncodeToString(cert.SerialNumber.Bytes()),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		DaysLeft:    int(math.Floor(time.Until(cert.NotAfter).Hours() / 24)),
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyType, info.KeyBits = "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.KeyType, info.KeyBits = "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		info.KeyType, info.KeyBits = "Ed25519", 256
+	default:
+		info.KeyType = fmt.Sprintf("%T", key)
+	}
+	return info
+}
+
+// Print writes the CA details in human-readable form
+func (info CAInfo) Print(w io.Writer) {
+	fmt.Fprintf(w, "Certificate:  %s\n", info.Path)
+	fmt.Fprintf(w, "Subject:      %s\n", info.Subject)
+	fmt.Fprintf(w, "Serial:       %s\n", info.Serial)
+	fmt.Fprintf(w, "Not before:   %s\n", info.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(w, "Not after:    %s\n", info.NotAfter.Format(time.RFC3339))
+	if info.DaysLeft < 0 {
+		fmt.Fprintf(w, "Expires in:   expired %d days ago\n", -info.DaysLeft)
+	} else {
+		fmt.Fprintf(w, "Expires in:   %d days\n", info.DaysLeft)
+	}
+	if info.KeyBits > 0 {
+		fmt.Fprintf(w, "Key:          %s %d bits\n", info.KeyType, info.KeyBits)
+	} else {
+		fmt.Fprintf(w, "Key:          %s\n", info.KeyType)
+	}
+	fmt.Fprintf(w, "SHA-256:      %s\n", info.Fingerprint)
+}
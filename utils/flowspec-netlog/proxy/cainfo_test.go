@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCAInfo(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadExistingCA(Options{LogDir: dir}); !errors.Is(err, ErrNoCA) {
+		t.Fatalf("LoadExistingCA before generating: err = %v, want ErrNoCA", err)
+	}
+	generated, err := NewCertManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := LoadExistingCA(Options{LogDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := cm.Info()
+	cert := generated.caCert
+	sum := sha256.Sum256(cert.Raw)
+	var out bytes.Buffer
+	info.Print(&out)
+	for _, want := range []string{
+		"Certificate:  " + filepath.Join(dir, ".certs", "flowspec-ca-system.crt") + "\n",
+		"Subject:      CN=Flowspec CA,O=Flowspec Network Logger\n",
+		"Serial:       " + hex.EncodeToString(cert.SerialNumber.Bytes()) + "\n",
+		"Not before:   " + cert.NotBefore.Format(time.RFC3339) + "\n",
+		"Not after:    " + cert.NotAfter.Format(time.RFC3339) + "\n",
+		// A year from now, less the time since generating
+		"Expires in:   364 days\n",
+		"Key:          RSA 2048 bits\n",
+		"SHA-256:      " + hex.EncodeToString(sum[:]) + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRenewCA(t *testing.T) {
+	for _, keepKey := range []bool{true, false} {
+		dir := t.TempDir()
+		old, err := NewCertManager(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldCert := old.caCert
+		if _, err := RenewCA(Options{LogDir: dir}, keepKey); err != nil {
+			t.Fatal(err)
+		}
+
+		// The new certificate is the one on disk
+		renewed, err := LoadExistingCA(Options{LogDir: dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(renewed.caCert.Raw, oldCert.Raw) {
+			t.Errorf("keepKey %v: certificate unchanged after renewing", keepKey)
+		}
+		if renewed.caCert.SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+			t.Errorf("keepKey %v: serial unchanged after renewing", keepKey)
+		}
+		if same := bytes.Equal(renewed.caCert.RawSubjectPublicKeyInfo, oldCert.RawSubjectPublicKeyInfo); same != keepKey {
+			t.Errorf("keepKey %v: public key kept %v", keepKey, same)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/elazarl/goproxy"
+)
+
+// Cassette modes
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+const (
+	cassetteMaxBody = 10 * 1024 * 1024 // largest response body recorded
+)
+
+// cassetteEntry is one recorded response, stored as a JSONL line. Bodies
+// that are not valid UTF-8 are base64 encoded.
+type cassetteEntry struct {
+	Key          string      `json:"key"`
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// cassette records upstream responses to a file, or replays them from it so
+// test runs are deterministic. Requests are matched by method, URL, and a
+// hash of the request body.
+type cassette struct {
+	mode        string
+	passthrough bool
+
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	entries map[string]*cassetteEntry
+}
+
+// openCassette opens path for mode. Recording truncates the file; replaying
+// loads every entry, the first recording of a key winning. With no mode, an
+// existing cassette is replayed and a missing one recorded.
+func openCassette(path, mode string, passthrough bool) (*cassette, error) {
+	if mode == "" {
+		mode = cassetteReplay
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			mode = cassetteRecord
+		}
+	}
+	c := &cassette{
+		mode:        mode,
+		passthrough: passthrough,
+		entries:     make(map[string]*cassetteEntry),
+	}
+
+	if mode == cassetteRecord {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cassette: %w", err)
+		}
+		c.file = file
+		c.encoder = newLogEncoder(file, false)
+		return c, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 2*cassetteMaxBody)
+	for line := 1; scanner.Scan(); line++ {
+		var entry cassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("cassette line %d: %w", line, err)
+		}
+		if _, ok := c.entries[entry.Key]; !ok {
+			c.entries[entry.Key] = &entry
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	return c, nil
+}
+
+// cassetteKey identifies req by method, URL, and body hash. The body is read
+// and restored; requests whose body exceeds limit have no key.
+func cassetteKey(req *http.Request, limit int) (string, bool) {
+	hash := sha256.New()
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(req.Body, int64(limit)+1))
+		if err != nil {
+			return "", false
+		}
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		if len(body) > limit {
+			return "", false
+		}
+		hash.Write(body)
+	}
+	return req.Method + " " + req.URL.String() + " " + hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// replay returns the recorded response for key, or nil
+func (c *cassette) replay(key string, req *http.Request) *http.Response {
+	c.mu.Lock()
+	entry := c.entries[key]
+	c.mu.Unlock()
+	if entry == nil {
+		return nil
+	}
+
+	body := []byte(entry.Body)
+	if entry.BodyEncoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Body)
+		if err != nil {
+			return nil
+		}
+		body = decoded
+	}
+
+	header := entry.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// missResponse answers a replayed request that has no recording
+func missResponse(req *http.Request) *http.Response {
+	return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusGatewayTimeout,
+		fmt.Sprintf("flowspec-netlog: no cassette recording for %s %s\n", req.Method, req.URL))
+}
+
+// record tees resp's body and saves the response once the body has been
+// read to the end. Bodies larger than cassetteMaxBody are not recorded.
+func (c *cassette) record(key string, req *http.Request, resp *http.Response) {
+	header := resp.Header.Clone()
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+
+	entry := &cassetteEntry{
+		Key:    key,
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: header,
+	}
+	resp.Body = &cassetteRecorder{
+		ReadCloser: resp.Body,
+		onEOF: func(body []byte) {
+			if utf8.Valid(body) {
+				entry.Body = string(body)
+			} else {
+				entry.Body = base64.StdEncoding.EncodeToString(body)
+				entry.BodyEncoding = "base64"
+			}
+			c.save(entry)
+		},
+	}
+}
+
+// save appends entry to the cassette unless its key was already recorded
+func (c *cassette) save(entry *cassetteEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.encoder == nil {
+		return
+	}
+	if _, ok := c.entries[entry.Key]; ok {
+		return
+	}
+	c.entries[entry.Key] = entry
+	if err := c.encoder.Encode(entry); err != nil {
+		fmt.Printf("Warning: failed to record response: %v\n", err)
+	}
+}
+
+// close closes the recording file
+func (c *cassette) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	c.encoder = nil
+	return err
+}
+
+// cassetteRecorder buffers a response body as it is relayed and hands it to
+// onEOF if the body is read completely
+type cassetteRecorder struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	overflow bool
+	done     bool
+	onEOF    func(body []byte)
+}
+
+// Read implements io.Reader
+func (r *cassetteRecorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if !r.overflow {
+		if r.buf.Len()+n > cassetteMaxBody {
+			r.overflow = true
+			r.buf = bytes.Buffer{}
+		} else {
+			r.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !r.done && !r.overflow {
+		r.done = true
+		r.onEOF(r.buf.Bytes())
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00, 0xfe}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(append([]byte(`{"created":`), append(body, '}')...))
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	cassettePath := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	type result struct {
+		status      int
+		contentType string
+		body        string
+	}
+	run := func(client *http.Client) []result {
+		var results []result
+		for _, req := range []struct{ method, path, body string }{
+			{http.MethodPost, "/users", `"ada"`},
+			{http.MethodGet, "/logo.png", ""},
+			{http.MethodGet, "/missing", ""},
+		} {
+			r, err := http.NewRequest(req.method, upstream.URL+req.path, strings.NewReader(req.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			results = append(results, result{resp.StatusCode, resp.Header.Get("Content-Type"), string(body)})
+		}
+		return results
+	}
+
+	p, client := newTestProxy(t, Options{CassetteFile: cassettePath, CassetteMode: cassetteRecord})
+	recorded := run(client)
+	closeAndRead(t, p)
+	if recorded[1].body != string(binary) {
+		t.Fatalf("recording got body %q, want %q", recorded[1].body, binary)
+	}
+
+	// Replay with the upstream gone
+	upstream.Close()
+	p, client = newTestProxy(t, Options{CassetteFile: cassettePath, CassetteMode: cassetteReplay})
+	replayed := run(client)
+	for i := range recorded {
+		if replayed[i] != recorded[i] {
+			t.Errorf("request %d replayed %+v, recorded %+v", i, replayed[i], recorded[i])
+		}
+	}
+
+	// A request body that was never recorded misses
+	resp, err := client.Post(upstream.URL+"/users", "application/json", bytes.NewReader([]byte(`"bob"`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("unrecorded request: status %d, want 504", resp.StatusCode)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(entries))
+	}
+	for i, entry := range entries[:3] {
+		if !entry.Replayed || entry.Disposition != dispositionReplay {
+			t.Errorf("entry %d: replayed %v, disposition %q", i, entry.Replayed, entry.Disposition)
+		}
+	}
+	if miss := entries[3]; miss.ErrorKind != "cassette_miss" || miss.Replayed {
+		t.Errorf("miss entry: error kind %q, replayed %v", miss.ErrorKind, miss.Replayed)
+	}
+}
@@ -1,13 +1,17 @@
 package proxy
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/fs"
 	"math/big"
 	"os"
 	"path/filepath"
@@ -15,11 +19,11 @@ import (
 )
 
 const (
-	caOrg          = "Flowspec Network Logger"
-	caName         = "Flowspec CA"
-	certValidDays  = 365 // Certificate validity period in days (1 year)
-	// Note: Certificates must be renewed before expiry. To renew, delete
-	// .logs/.certs/ directory and restart flowspec-netlog to regenerate.
+	caOrg         = "Flowspec Network Logger"
+	caName        = "Flowspec CA"
+	certValidDays = 365 // Certificate validity period in days (1 year)
+	// Note: Certificates must be renewed before expiry. To renew, run
+	// flowspec-netlog ca renew and restart flowspec-netlog.
 	// Consider monitoring cert expiry with: openssl x509 -enddate -noout -in cert.pem
 )
 
@@ -34,8 +38,18 @@ type CertManager struct {
 	systemCert string
 }
 
-// NewCertManager creates or loads a CA certificate
+// NewCertManager creates or loads a CA certificate. Files the current user
+// may not access give an error explaining how to fix their ownership.
 func NewCertManager(logDir string) (*CertManager, error) {
+	cm, err := openCertManager(logDir)
+	if errors.Is(err, fs.ErrPermission) {
+		return nil, certPermissionError(filepath.Join(logDir, ".certs"), err)
+	}
+	return cm, err
+}
+
+// openCertManager loads the CA in logDir/.certs, generating it if missing
+func openCertManager(logDir string) (*CertManager, error) {
 	cm := &CertManager{
 		certDir:    filepath.Join(logDir, ".certs"),
 		certPath:   filepath.Join(logDir, ".certs", "flowspec-ca.crt"),
@@ -57,14 +71,90 @@ func NewCertManager(logDir string) (*CertManager, error) {
 	return cm.generate()
 }
 
-// generate creates a new CA certificate and key
-func (cm *CertManager) generate() (*CertManager, error) {
-	// Generate RSA key
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+// NewCertManagerFromOptions loads the externally provided CA when
+// opts.CACertFile and opts.CAKeyFile are set, otherwise it creates or loads
+// the self-signed CA in opts.LogDir
+func NewCertManagerFromOptions(opts Options) (*CertManager, error) {
+	opts = opts.withDefaults()
+	if opts.CACertFile == "" && opts.CAKeyFile == "" {
+		cm, err := NewCertManager(opts.LogDir)
+		if err != nil && opts.CATempFallback && errors.Is(err, fs.ErrPermission) {
+			fmt.Printf("Warning: %v\n", err)
+			if cm, err = newTempCertManager(); err == nil {
+				fmt.Printf("Using a temporary CA in %s for this run\n", cm.certDir)
+			}
+		}
+		return cm, err
+	}
+	if opts.CACertFile == "" || opts.CAKeyFile == "" {
+		return nil, fmt.Errorf("CA cert and key must be provided together")
+	}
+	return LoadCertManager(opts.CACertFile, opts.CAKeyFile)
+}
+
+// LoadCertManager uses an externally provided CA (e.g. one issued by an
+// internal PKI). The certificate must be a CA allowed to sign certificates,
+// and the key must match it. Nothing is written to disk.
+func LoadCertManager(certPath, keyPath string) (*CertManager, error) {
+	certPEM, err := os.ReadFile(certPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate key: %w", err)
+		return nil, fmt.Errorf("failed to read CA cert: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+
+	// X509KeyPair also verifies that the key matches the certificate
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA cert/key pair: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA cert: %w", err)
+	}
+	if !cert.IsCA || !cert.BasicConstraintsValid {
+		return nil, fmt.Errorf("%s is not a CA certificate", certPath)
+	}
+	if cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, fmt.Errorf("%s is not allowed to sign certificates (missing keyCertSign usage)", certPath)
+	}
+
+	// Leaf certificates get their own P-256 keys but are signed with the CA
+	// key, which x509.CreateCertificate accepts as RSA, ECDSA or Ed25519
+	switch pair.PrivateKey.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported CA key type %T", pair.PrivateKey)
+	}
+	pair.Leaf = cert
+
+	cm := &CertManager{
+		caCert:     cert,
+		tlsCA:      pair,
+		certDir:    filepath.Dir(certPath),
+		certPath:   certPath,
+		keyPath:    keyPath,
+		systemCert: certPath,
+	}
+	cm.caKey, _ = pair.PrivateKey.(*rsa.PrivateKey)
+	return cm, nil
+}
+
+// generate creates a new CA certificate, and a new key unless cm already has one
+func (cm *CertManager) generate() (*CertManager, error) {
+	key := cm.caKey
+	if key == nil {
+		// Generate RSA key
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		cm.caKey = key
 	}
-	cm.caKey = key
 
 	// Create CA certificate
 	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
@@ -165,7 +255,7 @@ func (cm *CertManager) save(derBytes []byte) (err error) {
 // loadExisting loads an existing CA certificate and key
 func (cm *CertManager) loadExisting() (*CertManager, error) {
 	// Load certificate
-	certPEM, err := os.ReadFile(cm.certPath)
+	certPEM, err := readCAFile(cm.certPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read cert: %w", err)
 	}
@@ -182,7 +272,7 @@ func (cm *CertManager) loadExisting() (*CertManager, error) {
 	cm.caCert = cert
 
 	// Load key
-	keyPEM, err := os.ReadFile(cm.keyPath)
+	keyPEM, err := readCAFile(cm.keyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read key: %w", err)
 	}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+// captureStderr returns what fn prints to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, fn)
+}
+
+// captureOutput returns what fn writes to *file
+func captureOutput(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	defer func() { *file = saved }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestCAInstructionsQuiet(t *testing.T) {
+	for _, print := range []bool{true, false} {
+		out := captureStdout(t, func() {
+			p, err := NewProxy(Options{LogDir: t.TempDir(), PrintCAInstructions: print})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Close()
+		})
+		if got := strings.Contains(out, "install the CA certificate"); got != print {
+			t.Errorf("PrintCAInstructions %v: printed instructions %v:\n%s", print, got, out)
+		}
+	}
+}
+
+// writeCA writes a self-signed certificate for key, as template describes,
+// and the PEM-encoded signer to dir, returning their paths
+func writeCA(t *testing.T, dir string, template *x509.Certificate, key, signer crypto.Signer) (certPath, keyPath string) {
+	t.Helper()
+	template.SerialNumber = big.NewInt(1)
+	template.Subject = pkix.Name{CommonName: "External CA"}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath = filepath.Join(dir, "ca.crt")
+	keyPath = filepath.Join(dir, "ca.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestLoadCertManager(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := func() *x509.Certificate {
+		return &x509.Certificate{
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		template *x509.Certificate
+		key      crypto.Signer
+		signer   crypto.Signer
+		wantErr  string
+	}{
+		{"ecdsa CA", ca(), ecKey, ecKey, ""},
+		{"ed25519 CA", ca(), edKey, edKey, ""},
+		{"not a CA", &x509.Certificate{KeyUsage: x509.KeyUsageDigitalSignature}, ecKey, ecKey, "is not a CA certificate"},
+		{"no keyCertSign", &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageDigitalSignature}, ecKey, ecKey, "missing keyCertSign"},
+		{"mismatched key", ca(), ecKey, otherKey, "invalid CA cert/key pair"},
+	} {
+		certPath, keyPath := writeCA(t, t.TempDir(), tc.template, tc.key, tc.signer)
+		cm, err := LoadCertManager(certPath, keyPath)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+
+		// Leaves signed with the external CA verify against it
+		signer, err := newLeafSigner(cm.GetTLSCA(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := signer.certificate("api.example.com")
+		if err != nil {
+			t.Errorf("%s: signing a leaf: %v", tc.name, err)
+			continue
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(cm.caCert)
+		cert, err := x509.ParseCertificate(leaf.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, DNSName: "api.example.com"}); err != nil {
+			t.Errorf("%s: leaf does not verify: %v", tc.name, err)
+		}
+	}
+}
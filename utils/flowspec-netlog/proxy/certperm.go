@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// readCAFile reads the CA files in the log directory, replaceable in tests,
+// since root can read files whatever their mode
+var readCAFile = os.ReadFile
+
+// certPermissionError explains a CA file or directory the current user may
+// not access, usually because an earlier run under sudo created it. The
+// result still wraps err, so errors.Is(err, fs.ErrPermission) holds.
+func certPermissionError(certDir string, err error) error {
+	path := certDir
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		path = pathErr.Path
+	}
+
+	current := ""
+	if info, statErr := os.Stat(path); statErr == nil {
+		current = fmt.Sprintf(" (mode %04o)", info.Mode().Perm())
+	}
+	return fmt.Errorf("cannot access %s%s: %w\n"+
+		"  The CA files must be owned by the user running flowspec-netlog (uid %d), with\n"+
+		"  mode 0700 for %s, 0600 for the key, and 0644 for the certificates.\n"+
+		"  They were probably created by an earlier run under sudo. To fix this, either:\n"+
+		"    sudo chown -R $(id -u):$(id -g) %s\n"+
+		"  or delete %s to generate a new CA (clients must then trust the new one),\n"+
+		"  or set FLOWSPEC_CA_TEMP_FALLBACK=true to use a temporary CA for this run",
+		path, current, err, os.Getuid(), certDir, certDir, certDir)
+}
+
+// newTempCertManager generates a CA in a new temporary directory, for runs
+// that cannot use the one in the log directory. Clients must trust it anew
+// on every run.
+func newTempCertManager() (*CertManager, error) {
+	dir, err := os.MkdirTemp("", "flowspec-netlog-ca-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary CA directory: %w", err)
+	}
+	cm := &CertManager{
+		certDir:    dir,
+		certPath:   filepath.Join(dir, "flowspec-ca.crt"),
+		keyPath:    filepath.Join(dir, "flowspec-ca.key"),
+		systemCert: filepath.Join(dir, "flowspec-ca-system.crt"),
+	}
+	return cm.generate()
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCAKeyUnreadable(t *testing.T) {
+	logDir := t.TempDir()
+	cm, err := NewCertManager(logDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Geteuid() == 0 {
+		readCAFile = func(path string) ([]byte, error) {
+			if path == cm.keyPath {
+				return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrPermission}
+			}
+			return os.ReadFile(path)
+		}
+		t.Cleanup(func() { readCAFile = os.ReadFile })
+	} else {
+		if err := os.Chmod(cm.keyPath, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The error names the key and says how to fix it
+	_, err = NewCertManager(logDir)
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Fatalf("error = %v, want a permission error", err)
+	}
+	for _, want := range []string{"cannot access " + cm.keyPath, "sudo chown -R", "FLOWSPEC_CA_TEMP_FALLBACK=true"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+	if _, err := NewCertManagerFromOptions(Options{LogDir: logDir}); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("without the fallback: error = %v, want a permission error", err)
+	}
+
+	// With the fallback a temporary CA is generated instead
+	var temp *CertManager
+	out := captureStdout(t, func() {
+		temp, err = NewCertManagerFromOptions(Options{LogDir: logDir, CATempFallback: true})
+	})
+	if err != nil {
+		t.Fatalf("with the fallback: %v", err)
+	}
+	defer os.RemoveAll(temp.certDir)
+	if !strings.Contains(out, "Using a temporary CA in "+temp.certDir) {
+		t.Errorf("output does not announce the temporary CA:\n%s", out)
+	}
+	if filepath.Dir(temp.certPath) == cm.certDir || temp.caCert.Equal(cm.caCert) {
+		t.Errorf("fallback reused the CA in %s", cm.certDir)
+	}
+	if _, err := os.Stat(temp.certPath); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/elazarl/goproxy"
+)
+
+// connIDKey is the request context key of the client connection's ID
+type connIDKey struct{}
+
+// connectionID numbers a client connection. For intercepted HTTPS it is
+// also the CONNECT's UserData, which goproxy hands to every request
+// decrypted from the tunnel.
+type connectionID uint64
+
+// connContext is the http.Server ConnContext hook numbering client
+// connections. Connections accepted by a trackedListener are registered
+// until they close, for connClosed.
+func (p *Proxy) connContext(ctx context.Context, conn net.Conn) context.Context {
+	id := connectionID(p.connIDs.Add(1))
+	if tracked, ok := conn.(*trackedConn); ok {
+		p.conns.Store(id, tracked.closed)
+		context.AfterFunc(tracked.closed, func() { p.conns.Delete(id) })
+	}
+	return context.WithValue(ctx, connIDKey{}, id)
+}
+
+// connClosed returns a context done once the client connection with the
+// given ID has closed, or nil when the connection is not tracked
+func (p *Proxy) connClosed(id uint64) context.Context {
+	if closed, ok := p.conns.Load(connectionID(id)); ok {
+		return closed.(context.Context)
+	}
+	return nil
+}
+
+// trackedListener wraps the connections it accepts in trackedConn
+type trackedListener struct {
+	net.Listener
+}
+
+// Accept implements net.Listener
+func (l trackedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	closed, cancel := context.WithCancel(context.Background())
+	return &trackedConn{Conn: conn, closed: closed, close: cancel}, nil
+}
+
+// trackedConn is a client connection that reports its end, including after
+// goproxy hijacks it for a CONNECT
+type trackedConn struct {
+	net.Conn
+	closed context.Context
+	close  context.CancelFunc
+}
+
+// Close implements net.Conn
+func (c *trackedConn) Close() error {
+	c.close()
+	return c.Conn.Close()
+}
+
+// requestConnID returns the ID of the client connection req arrived on, or
+// zero when the Proxy is served by another http.Server
+func requestConnID(req *http.Request, ctx *goproxy.ProxyCtx) uint64 {
+	if id, ok := req.Context().Value(connIDKey{}).(connectionID); ok {
+		return uint64(id)
+	}
+	if id, ok := ctx.UserData.(connectionID); ok {
+		return uint64(id)
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestConnectionIDKeepAlive(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	p, addr := startTestProxy(t, Options{})
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}}
+	get := func(path string) {
+		resp, err := client.Get(upstream.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	get("/first")
+	get("/second")
+	client.CloseIdleConnections()
+	get("/third")
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	first, second, third := entries[0], entries[1], entries[2]
+	if first.ConnectionID == 0 || second.ConnectionID != first.ConnectionID {
+		t.Errorf("keep-alive requests have connection IDs %d and %d, want the same non-zero ID",
+			first.ConnectionID, second.ConnectionID)
+	}
+	if third.ConnectionID == first.ConnectionID {
+		t.Errorf("request on a new connection reused connection ID %d", third.ConnectionID)
+	}
+	if second.Timings == nil || !second.Timings.Reused {
+		t.Errorf("second request timings %+v, want the upstream connection reused", second.Timings)
+	}
+}
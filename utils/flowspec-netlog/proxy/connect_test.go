@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestConnectTarget(t *testing.T) {
+	for _, tc := range []struct {
+		host    string
+		reqHost string
+		want    string
+	}{
+		{"api.example.com:443", "", "api.example.com:443"},
+		{"API.Example.COM:8443", "", "api.example.com:8443"},
+		{"api.example.com", "", "api.example.com:443"},
+		{"[::1]:8443", "", "[::1]:8443"},
+		{"[::1]", "", "[::1]:443"},
+		// A request-target not in authority form falls back to the Host header
+		{"", "Api.Example.com:8443", "api.example.com:8443"},
+		{"", "", ""},
+	} {
+		req := &http.Request{Method: "CONNECT", Host: tc.reqHost}
+		if got := connectTarget(req, tc.host); got != tc.want {
+			t.Errorf("connectTarget(Host %q, %q) = %q, want %q", tc.reqHost, tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestConnectEntryTarget(t *testing.T) {
+	_, port, err := net.SplitHostPort(startEchoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only other hosts are intercepted, so the CONNECT is tunneled
+	p, addr := startTestProxy(t, Options{MITMHosts: []string{"example.com"}})
+	conn := connectTunnel(t, addr, "LocalHost:"+port)
+	conn.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	want := "localhost:" + port
+	if entry.Method != "CONNECT" || entry.URL != want || entry.Host != want {
+		t.Errorf("entry method %q, url %q, host %q; want CONNECT to %q", entry.Method, entry.URL, entry.Host, want)
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// parseContentDisposition returns the type of a Content-Disposition header
+// ("attachment", "inline", ...) and the filename it suggests. filename*=
+// (RFC 5987) is decoded and preferred over filename=. A directory part is
+// dropped, as clients do.
+func parseContentDisposition(header string) (dispType, filename string) {
+	if header == "" {
+		return "", ""
+	}
+	dispType, params, err := mime.ParseMediaType(header)
+	if err == nil {
+		filename = params["filename"]
+	} else {
+		dispType, _, _ = strings.Cut(header, ";")
+		dispType = strings.ToLower(strings.TrimSpace(dispType))
+	}
+	if filename == "" {
+		// mime rejects unquoted names with spaces and skips filename*=
+		// values in charsets other than UTF-8
+		filename = scanDispositionFilename(header)
+	}
+
+	if filename != "" {
+		filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	}
+	return dispType, filename
+}
+
+// scanDispositionFilename reads the filename parameters of a header that
+// mime could not fully parse, leniently
+func scanDispositionFilename(header string) string {
+	var plain, extended string
+	params := strings.Split(header, ";")
+	for _, param := range params[1:] {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "filename":
+			plain = strings.Trim(value, `"`)
+		case "filename*":
+			extended = decodeExtValue(value)
+		}
+	}
+	if extended != "" {
+		return extended
+	}
+	return plain
+}
+
+// decodeExtValue decodes an RFC 5987 charset'language'value string in
+// UTF-8 or ISO-8859-1, the charsets recipients must support
+func decodeExtValue(value string) string {
+	parts := strings.SplitN(value, "'", 3)
+	if len(parts) != 3 {
+		return ""
+	}
+	raw, err := url.PathUnescape(parts[2])
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parts[0]) {
+	case "utf-8":
+		return raw
+	case "iso-8859-1":
+		runes := make([]rune, len(raw))
+		for i := 0; i < len(raw); i++ {
+			runes[i] = rune(raw[i])
+		}
+		return string(runes)
+	}
+	return ""
+}
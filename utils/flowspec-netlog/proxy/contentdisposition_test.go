@@ -0,0 +1,26 @@
+package proxy
+
+import "testing"
+
+func TestParseContentDisposition(t *testing.T) {
+	for _, tc := range []struct {
+		header   string
+		dispType string
+		filename string
+	}{
+		{`attachment; filename*=UTF-8''na%C3%AFve.pdf`, "attachment", "naïve.pdf"},
+		{`attachment; filename="plain.pdf"; filename*=UTF-8''na%C3%AFve.pdf`, "attachment", "naïve.pdf"},
+		{`attachment; filename*=ISO-8859-1''na%EFve.pdf`, "attachment", "naïve.pdf"},
+		{`attachment; filename="report.csv"`, "attachment", "report.csv"},
+		{`attachment; filename=my report.csv`, "attachment", "my report.csv"},
+		{`attachment; filename="../../etc/passwd"`, "attachment", "passwd"},
+		{`attachment; filename="C:\Users\me\notes.txt"`, "attachment", "notes.txt"},
+		{`Inline`, "inline", ""},
+		{"", "", ""},
+	} {
+		dispType, filename := parseContentDisposition(tc.header)
+		if dispType != tc.dispType || filename != tc.filename {
+			t.Errorf("parseContentDisposition(%q) = %q, %q; want %q, %q", tc.header, dispType, filename, tc.dispType, tc.filename)
+		}
+	}
+}
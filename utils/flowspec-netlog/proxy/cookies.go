@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// CookieLog is a parsed cookie. Values are always redacted, like the raw
+// Cookie header; the attributes are kept for session debugging.
+type CookieLog struct {
+	Name     string `json:"name"`
+	Value    string `json:"value,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	MaxAge   int    `json:"max_age,omitempty"`
+	HttpOnly bool   `json:"http_only,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	SameSite string `json:"same_site,omitempty"`
+}
+
+// logCookies converts parsed cookies, masking their values
+func logCookies(cookies []*http.Cookie) []CookieLog {
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	logged := make([]CookieLog, 0, len(cookies))
+	for _, c := range cookies {
+		entry := CookieLog{
+			Name:     c.Name,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			MaxAge:   c.MaxAge,
+			HttpOnly: c.HttpOnly,
+			Secure:   c.Secure,
+			SameSite: sameSiteName(c.SameSite),
+		}
+		if c.Value != "" {
+			entry.Value = "[REDACTED]"
+		}
+		if !c.Expires.IsZero() {
+			entry.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		logged = append(logged, entry)
+	}
+	return logged
+}
+
+// sameSiteName returns the attribute value of a SameSite mode
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCookiesLogged(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "session=s3cr3t; Domain=example.com; Path=/app; Expires=Wed, 21 Oct 2026 07:28:00 GMT; Max-Age=3600; HttpOnly; Secure; SameSite=Strict")
+		w.Header().Add("Set-Cookie", "theme=; Path=/; SameSite=Lax")
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{ResponseHeaders: []string{"Set-Cookie"}})
+	req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Cookie", "session=s3cr3t; lang=en")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+
+	wantRequest := []CookieLog{
+		{Name: "session", Value: "[REDACTED]"},
+		{Name: "lang", Value: "[REDACTED]"},
+	}
+	if !reflect.DeepEqual(entry.RequestCookies, wantRequest) {
+		t.Errorf("request cookies = %+v, want %+v", entry.RequestCookies, wantRequest)
+	}
+
+	// An empty value is left empty rather than marked redacted
+	wantResponse := []CookieLog{
+		{
+			Name:     "session",
+			Value:    "[REDACTED]",
+			Domain:   "example.com",
+			Path:     "/app",
+			Expires:  "2026-10-21T07:28:00Z",
+			MaxAge:   3600,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: "Strict",
+		},
+		{Name: "theme", Path: "/", SameSite: "Lax"},
+	}
+	if !reflect.DeepEqual(entry.ResponseCookies, wantResponse) {
+		t.Errorf("response cookies = %+v, want %+v", entry.ResponseCookies, wantResponse)
+	}
+
+	// Neither the raw headers nor the parsed cookies hold a value
+	if got := entry.ResponseHeaders["Set-Cookie"]; got != "[REDACTED]" {
+		t.Errorf("Set-Cookie header = %q, want [REDACTED]", got)
+	}
+	if got := entry.Headers["Cookie"]; got != "" && got != "[REDACTED]" {
+		t.Errorf("Cookie header = %q, want it redacted", got)
+	}
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExportCurl writes the requests of the log file at path as a shell script
+// with one curl command per entry, and returns how many it wrote. Bypassed
+// requests and tunnels are skipped, as their requests were never captured.
+// Redacted header values become shell variables the script user sets, and
+// bodies stored in FLOWSPEC_BODIES_DIR are sent from their files. Bodies
+// that are not text, or were over the capture limit, are left out with a
+// comment saying so.
+func ExportCurl(w io.Writer, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var b strings.Builder
+	vars := make(map[string]bool)
+	n, entry := 0, 0
+	err = readLogRecords(file, func(line []byte) {
+		if isSessionRecord(line) {
+			return
+		}
+		var log RequestLog
+		if err := json.Unmarshal(line, &log); err != nil || log.Pause != nil {
+			return
+		}
+		entry++
+		if log.Bypassed || log.Tunnel || log.Method == "" {
+			return
+		}
+		if log.RequestBodyFile != "" {
+			log.RequestBodyFile = resolveBodyRef(path, log.RequestBodyFile)
+		}
+		writeCurl(&b, entry, &log, vars)
+		n++
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	header := "#!/bin/sh\n# Requests exported from " + commentSafe(path) + " by flowspec-netlog export-curl\n"
+	if len(vars) > 0 {
+		names := make([]string, 0, len(vars))
+		for name := range vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		header += "# Redacted values are read from: " + strings.Join(names, " ") + "\n"
+	}
+	_, err = io.WriteString(w, header+b.String())
+	return n, err
+}
+
+// writeCurl appends the curl command for log, entry n of its file, adding
+// the variables standing in for redacted values to vars
+func writeCurl(b *strings.Builder, n int, log *RequestLog, vars map[string]bool) {
+	fmt.Fprintf(b, "\n# %d: %s %s", n, commentSafe(log.Method), commentSafe(log.URL))
+	if log.StatusCode > 0 {
+		fmt.Fprintf(b, " -> %d", log.StatusCode)
+	}
+	b.WriteString("\n")
+
+	body := log.RequestBody
+	if body == "" && len(log.FormFields) > 0 {
+		body = url.Values(log.FormFields).Encode()
+	}
+	var data, file string
+	switch {
+	case log.RequestBodyFile != "":
+		file = log.RequestBodyFile
+	case log.RequestBodyOverflow != nil:
+		fmt.Fprintf(b, "# request body of %d bytes was over the capture limit and is not sent\n", log.RequestBodyOverflow.BodyLength)
+	case body != "" && (!utf8.ValidString(body) || strings.ContainsAny(body, "\x00\uFFFD")):
+		b.WriteString("# request body is not text and is not sent\n")
+	default:
+		data = body
+	}
+
+	b.WriteString("curl")
+	switch {
+	case log.Method == "HEAD":
+		b.WriteString(" --head")
+	case log.Method != "GET" || data != "" || file != "":
+		b.WriteString(" -X " + shellQuote(log.Method))
+	}
+	b.WriteString(" " + shellQuote(log.URL))
+
+	names := make([]string, 0, len(log.Headers))
+	for name := range log.Headers {
+		if !clientSetHeaders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := log.Headers[name]
+		if variable, ok := redactedVariable(name, value); ok {
+			vars[variable] = true
+			fmt.Fprintf(b, " \\\n  -H \"%s: ${%s}\"", name, variable)
+			continue
+		}
+		b.WriteString(" \\\n  -H " + shellQuote(name+": "+value))
+	}
+	// --data-raw sends a body starting with @ as is; --data-binary reads
+	// the file byte for byte
+	if file != "" {
+		b.WriteString(" \\\n  --data-binary " + shellQuote("@"+file))
+	} else if data != "" {
+		b.WriteString(" \\\n  --data-raw " + shellQuote(data))
+	}
+	b.WriteString("\n")
+}
+
+// commentSafe replaces control characters, so s cannot end a shell comment
+func commentSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
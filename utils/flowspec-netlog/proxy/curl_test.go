@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExportCurl(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFixture(t, dir, "network.fixture.jsonl",
+		`{"type":"session","schema_version":38,"started":"2025-12-25T12:00:00Z"}`,
+		`{"method":"GET","url":"https://api.example.com/users?q=it's","host":"api.example.com","status_code":200,"headers":{"Accept":"application/json"}}`,
+		`{"method":"CONNECT","url":"tunnel.example.com:443","host":"tunnel.example.com:443","tunnel":true}`,
+		`{"method":"POST","url":"https://api.example.com/run","host":"api.example.com","status_code":201,"request_body":"$(rm -rf ~) 'quoted' \"double\" `+"`cmd`"+`"}`,
+		`{"method":"HEAD","url":"https://api.example.com/","host":"api.example.com","status_code":204}`,
+	)
+
+	var out strings.Builder
+	n, err := ExportCurl(&out, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("exported %d requests, want 3", n)
+	}
+	want := "#!/bin/sh\n# Requests exported from " + path + " by flowspec-netlog export-curl\n" +
+		"\n# 1: GET https://api.example.com/users?q=it's -> 200\n" +
+		`curl 'https://api.example.com/users?q=it'\''s' \` + "\n" +
+		`  -H 'Accept: application/json'` + "\n" +
+		"\n# 3: POST https://api.example.com/run -> 201\n" +
+		`curl -X 'POST' 'https://api.example.com/run' \` + "\n" +
+		`  --data-raw '$(rm -rf ~) '\''quoted'\'' "double" ` + "`cmd`'\n" +
+		"\n# 4: HEAD https://api.example.com/ -> 204\n" +
+		"curl --head 'https://api.example.com/'\n"
+	if out.String() != want {
+		t.Errorf("script:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// The shell passes every value through unchanged
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh to run the script")
+	}
+	script := `curl() { printf '<%s>\n' "$@"; }` + "\n" + out.String()
+	args, err := exec.Command(sh, "-c", script).Output()
+	if err != nil {
+		t.Fatalf("running the script: %v", err)
+	}
+	wantArgs := "<https://api.example.com/users?q=it's>\n<-H>\n<Accept: application/json>\n" +
+		"<-X>\n<POST>\n<https://api.example.com/run>\n<--data-raw>\n<$(rm -rf ~) 'quoted' \"double\" `cmd`>\n" +
+		"<--head>\n<https://api.example.com/>\n"
+	if string(args) != wantArgs {
+		t.Errorf("curl arguments:\n%s\nwant:\n%s", args, wantArgs)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	bodiesDirName = "bodies"
+)
+
+// bodyStore writes each distinct body once, named by its SHA-256
+type bodyStore struct {
+	mu      sync.Mutex
+	logDir  string
+	dir     string // reference prefix, relative to logDir or absolute
+	written map[string]bool
+}
+
+// newBodyStore creates a store in dir, <logDir>/bodies when empty
+func newBodyStore(logDir, dir string) (*bodyStore, error) {
+	if dir == "" {
+		dir = filepath.Join(logDir, bodiesDirName)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bodies directory: %w", err)
+	}
+
+	// Refer to files inside the log directory relative to it, so the
+	// directory can be moved as a whole
+	ref, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve bodies directory: %w", err)
+	}
+	if absLog, err := filepath.Abs(logDir); err == nil {
+		if rel, err := filepath.Rel(absLog, ref); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			ref = rel
+		}
+	}
+	return &bodyStore{logDir: logDir, dir: ref, written: make(map[string]bool)}, nil
+}
+
+// resolveBodyRef returns the path of a body file referenced by an entry of
+// the log file at logPath
+func resolveBodyRef(logPath, ref string) string {
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(logPath), ref)
+}
+
+// store writes body if it hasn't been stored yet and returns its path
+// relative to the log directory, or absolute when the store is outside it
+func (s *bodyStore) store(body string) (string, error) {
+	sum := sha256.Sum256([]byte(body))
+	ref := filepath.Join(s.dir, hex.EncodeToString(sum[:])+".txt")
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.logDir, ref)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.written[ref] {
+		return ref, nil
+	}
+
+	// O_EXCL keeps files from earlier sessions untouched
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("failed to create body file: %w", err)
+	}
+	if err == nil {
+		_, err = file.WriteString(body)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("failed to write body file: %w", err)
+		}
+	}
+
+	s.written[ref] = true
+	return ref, nil
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDedupBodies(t *testing.T) {
+	const body = `{"items":[1,2,3]}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{DedupBodies: true})
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	files, err := os.ReadDir(filepath.Join(p.opts.LogDir, bodiesDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d body files, want 1", len(files))
+	}
+	want := filepath.Join(bodiesDirName, files[0].Name())
+	for i, entry := range entries {
+		if entry.ResponseBodyRef != want || entry.ResponseBody != "" {
+			t.Errorf("entry %d: body ref %q, body %q; want only the ref %q", i, entry.ResponseBodyRef, entry.ResponseBody, want)
+		}
+	}
+	stored, err := os.ReadFile(resolveBodyRef(p.GetLogPath(), want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != body {
+		t.Errorf("body file holds %q, want %q", stored, body)
+	}
+}
+
+func TestBodiesDir(t *testing.T) {
+	const reqBody, respBody = `{"name":"a"}`, `{"id":1}`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(respBody))
+	}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name   string
+		inside bool // bodies dir under the log dir, referenced relatively
+	}{
+		{"outside log dir", false},
+		{"inside log dir", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logDir := t.TempDir()
+			dir := t.TempDir()
+			if tc.inside {
+				dir = filepath.Join(logDir, "captured")
+			}
+			p, client := newTestProxy(t, Options{LogDir: logDir, BodiesDir: dir})
+			resp, err := client.Post(upstream.URL, "application/json", strings.NewReader(reqBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			entries := closeAndRead(t, p)
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			entry := entries[0]
+			if entry.RequestBody != "" || entry.ResponseBody != "" {
+				t.Errorf("bodies inlined: request %q, response %q", entry.RequestBody, entry.ResponseBody)
+			}
+			for _, ref := range []struct{ name, ref, want string }{
+				{"request", entry.RequestBodyFile, reqBody},
+				{"response", entry.ResponseBodyFile, respBody},
+			} {
+				if filepath.IsAbs(ref.ref) == tc.inside {
+					t.Errorf("%s body ref %q: absolute = %v, want %v", ref.name, ref.ref, filepath.IsAbs(ref.ref), !tc.inside)
+				}
+				path := resolveBodyRef(p.GetLogPath(), ref.ref)
+				if filepath.Dir(path) != dir {
+					t.Errorf("%s body file %q is not in %q", ref.name, path, dir)
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != ref.want {
+					t.Errorf("%s body file holds %q, want %q", ref.name, data, ref.want)
+				}
+			}
+
+			// Tools reading the log resolve the references
+			if err := loadBodyFiles(p.GetLogPath(), entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.RequestBody != reqBody || entry.ResponseBody != respBody {
+				t.Errorf("loaded bodies %q, %q; want %q, %q", entry.RequestBody, entry.ResponseBody, reqBody, respBody)
+			}
+		})
+	}
+}
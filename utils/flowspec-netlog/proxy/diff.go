@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDiffKey correlates entries by method and path
+var DefaultDiffKey = []string{"method", "path"}
+
+// diffKeyParts are the components a diff key can be built from
+var diffKeyParts = map[string]func(log *RequestLog, u *url.URL) string{
+	"method": func(log *RequestLog, u *url.URL) string { return log.Method },
+	"host":   func(log *RequestLog, u *url.URL) string { return strings.ToLower(log.Host) },
+	"path": func(log *RequestLog, u *url.URL) string {
+		if u.Path == "" && u.Opaque != "" {
+			return u.Opaque
+		}
+		return u.Path
+	},
+	"query": func(log *RequestLog, u *url.URL) string {
+		if u.RawQuery == "" {
+			return ""
+		}
+		return "?" + u.RawQuery
+	},
+	"body": requestBodyHash,
+}
+
+// DiffReport lists the differences between two capture files
+type DiffReport struct {
+	A           string       `json:"a"`
+	B           string       `json:"b"`
+	Key         []string     `json:"key"`
+	Matched     int          `json:"matched"`
+	Differences []Difference `json:"differences"`
+}
+
+// Difference is one way a correlated request differs, or a request present
+// in only one file. Kind is "status", "response_body", "missing" (only in A),
+// or "extra" (only in B).
+type Difference struct {
+	Key  string `json:"key"`
+	Kind string `json:"kind"`
+	A    string `json:"a,omitempty"`
+	B    string `json:"b,omitempty"`
+}
+
+// DiffFiles correlates the entries of two log files by key, a list of
+// method, host, path, query, and body (a hash of the request body). The
+// n-th entry with a key in a is paired with the n-th with that key in b.
+func DiffFiles(a, b string, key []string) (*DiffReport, error) {
+	key = append([]string(nil), key...)
+	for i, part := range key {
+		part = strings.ToLower(strings.TrimSpace(part))
+		key[i] = part
+		if diffKeyParts[part] == nil {
+			return nil, fmt.Errorf("invalid diff key %q: want method, host, path, query, or body", part)
+		}
+	}
+	entriesA, err := readEntries(a)
+	if err != nil {
+		return nil, err
+	}
+	entriesB, err := readEntries(b)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{A: a, B: b, Key: key, Differences: []Difference{}}
+	pending := make(map[string][]*RequestLog)
+	for _, log := range entriesB {
+		k := diffKey(log, key)
+		pending[k] = append(pending[k], log)
+	}
+
+	for _, logA := range entriesA {
+		k := diffKey(logA, key)
+		if len(pending[k]) == 0 {
+			report.Differences = append(report.Differences, Difference{Key: k, Kind: "missing"})
+			continue
+		}
+		logB := pending[k][0]
+		pending[k] = pending[k][1:]
+		report.Matched++
+
+		if logA.StatusCode != logB.StatusCode {
+			report.Differences = append(report.Differences, Difference{
+				Key: k, Kind: "status",
+				A: statusText(logA), B: statusText(logB),
+			})
+		}
+		if bodyA, bodyB := responseBodyID(logA), responseBodyID(logB); bodyA != bodyB {
+			report.Differences = append(report.Differences, Difference{
+				Key: k, Kind: "response_body",
+				A: bodyA, B: bodyB,
+			})
+		}
+	}
+
+	// Whatever is left in b had no counterpart in a, reported in file order
+	for _, logB := range entriesB {
+		k := diffKey(logB, key)
+		if len(pending[k]) > 0 && pending[k][0] == logB {
+			pending[k] = pending[k][1:]
+			report.Differences = append(report.Differences, Difference{Key: k, Kind: "extra"})
+		}
+	}
+	return report, nil
+}
+
+// Print writes the human-readable report
+func (r *DiffReport) Print(w io.Writer) {
+	counts := make(map[string]int)
+	for _, d := range r.Differences {
+		counts[d.Kind]++
+		switch d.Kind {
+		case "missing":
+			fmt.Fprintf(w, "- %s: only in %s\n", d.Key, r.A)
+		case "extra":
+			fmt.Fprintf(w, "+ %s: only in %s\n", d.Key, r.B)
+		case "status":
+			fmt.Fprintf(w, "~ %s: status %s -> %s\n", d.Key, d.A, d.B)
+		case "response_body":
+			fmt.Fprintf(w, "~ %s: response body %s -> %s\n", d.Key, d.A, d.B)
+		}
+	}
+	fmt.Fprintf(w, "\n%d matched, %d status changes, %d body changes, %d missing, %d extra\n",
+		r.Matched, counts["status"], counts["response_body"], counts["missing"], counts["extra"])
+}
+
+// readEntries returns the request entries of a log file
+func readEntries(path string) ([]*RequestLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []*RequestLog
+	var parseErr error
+	err = readLogRecords(file, func(line []byte) {
+		if parseErr != nil || isSessionRecord(line) {
+			return
+		}
+		var log RequestLog
+		if err := json.Unmarshal(line, &log); err != nil {
+			parseErr = fmt.Errorf("%s: malformed entry: %w", path, err)
+			return
+		}
+		if log.Pause != nil {
+			return
+		}
+		entries = append(entries, &log)
+	})
+	if err == nil {
+		err = parseErr
+	}
+	return entries, err
+}
+
+// diffKey builds the correlation key of an entry
+func diffKey(log *RequestLog, key []string) string {
+	u, err := url.Parse(log.URL)
+	if err != nil {
+		u = &url.URL{Opaque: log.URL}
+	}
+	parts := make([]string, 0, len(key))
+	for _, part := range key {
+		if value := diffKeyParts[part](log, u); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// requestBodyHash returns a short hash of the captured request body
+func requestBodyHash(log *RequestLog, u *url.URL) string {
+	body := log.RequestBody
+	if body == "" && len(log.FormFields) > 0 {
+		body = url.Values(log.FormFields).Encode()
+	}
+	if body == "" {
+		return "-"
+	}
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:6])
+}
+
+// responseBodyID identifies a response body for comparison: its size and
+// hash, or its deduplicated body file
+func responseBodyID(log *RequestLog) string {
+	// Body files are named by content hash, wherever they are stored
+	if ref := log.ResponseBodyFile + log.ResponseBodyRef; ref != "" {
+		return filepath.Base(ref)
+	}
+	if log.ResponseBody == "" {
+		return "(none)"
+	}
+	sum := sha256.Sum256([]byte(log.ResponseBody))
+	return fmt.Sprintf("%d bytes sha256:%s", len(log.ResponseBody), hex.EncodeToString(sum[:6]))
+}
+
+// statusText describes an entry's outcome for the diff
+func statusText(log *RequestLog) string {
+	if log.StatusCode == 0 {
+		if kind := errorKind(log); kind != "" {
+			return kind
+		}
+		return "none"
+	}
+	return fmt.Sprint(log.StatusCode)
+}
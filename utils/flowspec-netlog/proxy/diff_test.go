@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFixture writes a log file of the given lines to dir
+func writeFixture(t *testing.T, dir, name string, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDiffFilesStatusChange(t *testing.T) {
+	dir := t.TempDir()
+	session := `{"type":"session","schema_version":38,"started":"2025-12-25T12:00:00Z"}`
+	a := writeFixture(t, dir, "network.a.jsonl", session,
+		`{"method":"GET","url":"https://api.example.com/users","host":"api.example.com","status_code":200,"response_body":"[]"}`,
+		`{"method":"POST","url":"https://api.example.com/users","host":"api.example.com","status_code":201,"response_body":"{}"}`,
+	)
+	b := writeFixture(t, dir, "network.b.jsonl", session,
+		`{"method":"GET","url":"https://api.example.com/users","host":"api.example.com","status_code":200,"response_body":"[]"}`,
+		`{"method":"POST","url":"https://api.example.com/users","host":"api.example.com","status_code":409,"response_body":"{}"}`,
+	)
+
+	report, err := DiffFiles(a, b, DefaultDiffKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Matched != 2 {
+		t.Errorf("matched = %d, want 2", report.Matched)
+	}
+	want := []Difference{{Key: "POST /users", Kind: "status", A: "201", B: "409"}}
+	if !reflect.DeepEqual(report.Differences, want) {
+		t.Errorf("differences = %+v, want %+v", report.Differences, want)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	for _, line := range []string{
+		"~ POST /users: status 201 -> 409",
+		"2 matched, 1 status changes, 0 body changes, 0 missing, 0 extra",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("report missing %q:\n%s", line, out.String())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// diskCheckInterval is how often FLOWSPEC_MIN_FREE_DISK is checked
+const diskCheckInterval = 10 * time.Second
+
+// diskWatcher turns body capture off while the log directory's file system
+// has less than min bytes free, and back on once space recovers. Entries
+// are still logged and traffic still flows.
+type diskWatcher struct {
+	dir  string
+	min  int64
+	free func(dir string) (int64, error) // freeDiskSpace, replaceable in tests
+	low  atomic.Bool
+	quit chan struct{}
+	done chan struct{}
+}
+
+// startDiskWatcher checks free space now and then every diskCheckInterval
+func startDiskWatcher(dir string, minFree int64) *diskWatcher {
+	w := &diskWatcher{
+		dir:  dir,
+		min:  minFree,
+		free: freeDiskSpace,
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	w.check()
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(diskCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-w.quit:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+// check measures free space and switches body capture, warning on changes
+func (w *diskWatcher) check() {
+	free, err := w.free(w.dir)
+	if err != nil {
+		// Without a measurement keep the current state
+		return
+	}
+	low := free < w.min
+	if w.low.Swap(low) == low {
+		return
+	}
+	if low {
+		fmt.Printf("Warning: %s has %s free, below FLOWSPEC_MIN_FREE_DISK; body capture is off until space recovers\n", w.dir, formatSize(free))
+	} else {
+		fmt.Printf("%s has %s free again; body capture resumed\n", w.dir, formatSize(free))
+	}
+}
+
+// lowOnSpace reports whether body capture is off for lack of disk space
+func (w *diskWatcher) lowOnSpace() bool {
+	return w != nil && w.low.Load()
+}
+
+// stop ends the checks
+func (w *diskWatcher) stop() {
+	select {
+	case <-w.quit:
+	default:
+		close(w.quit)
+	}
+	<-w.done
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd)
+
+package proxy
+
+import "errors"
+
+// freeDiskSpace is not supported on this platform, so
+// FLOWSPEC_MIN_FREE_DISK never turns body capture off
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
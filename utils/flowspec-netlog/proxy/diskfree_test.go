@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLowDiskSpaceSkipsBodies(t *testing.T) {
+	const body = "response body"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer upstream.Close()
+
+	const minFree = 1 << 20
+	p, client := newTestProxy(t, Options{MinFreeDisk: minFree})
+	var free int64
+	watcher := p.logger.disk
+	watcher.free = func(string) (int64, error) { return free, nil }
+	get := func() {
+		t.Helper()
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	for _, tc := range []struct {
+		free    int64
+		message string
+	}{
+		{minFree - 1, "body capture is off until space recovers"},
+		{minFree, "body capture resumed"},
+	} {
+		free = tc.free
+		if out := captureStdout(t, watcher.check); !strings.Contains(out, tc.message) {
+			t.Errorf("free %d: output %q does not contain %q", tc.free, out, tc.message)
+		}
+		get()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if got := entries[0].ResponseBody; got != "" {
+		t.Errorf("body captured while low on space: %q", got)
+	}
+	if got := entries[1].ResponseBody; got != body {
+		t.Errorf("body after space recovered = %q, want %q", got, body)
+	}
+}
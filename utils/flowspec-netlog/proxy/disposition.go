@@ -0,0 +1,24 @@
+package proxy
+
+// Dispositions record how the proxy routed a request
+const (
+	dispositionMITM    = "mitm"    // HTTPS decrypted and forwarded
+	dispositionForward = "forward" // plain HTTP forwarded
+	dispositionTunnel  = "tunnel"  // CONNECT relayed without decryption
+	dispositionBypass  = "bypass"  // matched NO_PROXY
+	dispositionBlock   = "block"   // refused: client not allowed, over MaxConnections, or self-reference
+	dispositionMock    = "mock"    // answered from FLOWSPEC_MOCKS
+	dispositionReplay  = "replay"  // answered from the cassette
+	dispositionHook    = "hook"    // answered by Options.OnRequestHook
+	dispositionError   = "error"   // failed upstream or had no recording to replay
+)
+
+// setDisposition records how the request was routed, replacing an earlier
+// decision that the upstream then failed, and derives the older booleans
+// from it. Tunnel is set by LogTunnel, since a bypassed CONNECT is a tunnel too.
+func (log *RequestLog) setDisposition(disposition string) {
+	log.Disposition = disposition
+	log.Bypassed = disposition == dispositionBypass
+	log.Mocked = disposition == dispositionMock
+	log.Replayed = disposition == dispositionReplay
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDispositions(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsUpstream.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String() + "/"
+	l.Close()
+
+	dir := t.TempDir()
+	mocks := filepath.Join(dir, "mocks.json")
+	if err := os.WriteFile(mocks, []byte(`[{"url":"/","status":200,"body":"mocked"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cassette := filepath.Join(dir, "cassette.jsonl")
+	p, client := newTestProxy(t, Options{CassetteFile: cassette, CassetteMode: cassetteRecord})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	closeAndRead(t, p)
+	elsewhere, err := parseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		want   string
+		opts   Options
+		target string // "self" for the proxy's own address
+	}{
+		{dispositionForward, Options{}, upstream.URL},
+		{dispositionMITM, Options{InsecureUpstream: true}, tlsUpstream.URL},
+		{dispositionTunnel, Options{MITMHosts: []string{"example.com"}}, tlsUpstream.URL},
+		{dispositionBypass, Options{NoProxy: []string{"127.0.0.1"}}, upstream.URL},
+		{dispositionBlock, Options{AllowCIDRs: elsewhere}, upstream.URL},
+		{dispositionBlock, Options{}, "self"},
+		{dispositionMock, Options{MocksFile: mocks}, upstream.URL},
+		{dispositionReplay, Options{CassetteFile: cassette, CassetteMode: cassetteReplay}, upstream.URL},
+		{dispositionHook, Options{OnRequestHook: func(req *http.Request) *http.Response {
+			return &http.Response{StatusCode: http.StatusTeapot, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(nil))}
+		}}, upstream.URL},
+		{dispositionError, Options{}, refused},
+	} {
+		p, addr := startTestProxy(t, tc.opts)
+		target := tc.target
+		if target == "self" {
+			target = "http://" + addr + "/"
+		}
+		client := skipVerify(&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}})
+		if resp, err := client.Get(target); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		// A tunnel is logged once it closes
+		client.CloseIdleConnections()
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 1 {
+			t.Errorf("%s: got %d entries, want 1", tc.want, len(entries))
+			continue
+		}
+		entry := entries[0]
+		if entry.Disposition != tc.want {
+			t.Errorf("%s: disposition = %q (%s)", tc.want, entry.Disposition, entry.URL)
+		}
+		// The older booleans follow the disposition
+		if entry.Bypassed != (tc.want == dispositionBypass) || entry.Mocked != (tc.want == dispositionMock) ||
+			entry.Replayed != (tc.want == dispositionReplay) || entry.Tunnel != (tc.want == dispositionTunnel) {
+			t.Errorf("%s: bypassed %v, mocked %v, replayed %v, tunnel %v", tc.want,
+				entry.Bypassed, entry.Mocked, entry.Replayed, entry.Tunnel)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// inflightTracker counts captures that have started but not yet been
+// written, so shutdown can wait for them before closing the log. Unlike a
+// sync.WaitGroup it may be incremented while a waiter is blocked.
+type inflightTracker struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed whenever n is zero
+}
+
+// newInflightTracker creates an idle tracker
+func newInflightTracker() *inflightTracker {
+	idle := make(chan struct{})
+	close(idle)
+	return &inflightTracker{idle: idle}
+}
+
+// add records the start of a capture
+func (t *inflightTracker) add() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+}
+
+// done records the end of a capture
+func (t *inflightTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+}
+
+// wait blocks until no captures are in flight or ctx expires
+func (t *inflightTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return fmt.Errorf("%d requests still in flight", t.n)
+	}
+}
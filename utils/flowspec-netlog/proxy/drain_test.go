@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStopDrainsSlowRequest(t *testing.T) {
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first half, "))
+		w.(http.Flusher).Flush()
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("second half"))
+	}))
+	defer upstream.Close()
+
+	p, addr := startTestProxy(t, Options{})
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}}
+	type result struct {
+		body string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		done <- result{string(body), err}
+	}()
+
+	<-started
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	res := <-done
+	if res.err != nil || res.body != "first half, second half" {
+		t.Errorf("client got %q, %v; want the whole body", res.body, res.err)
+	}
+
+	entries, err := readEntries(p.GetLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.StatusCode != http.StatusOK || entry.ResponseBody != "first half, second half" || entry.Incomplete {
+		t.Errorf("entry = status %d, body %q, incomplete %v; want the complete response",
+			entry.StatusCode, entry.ResponseBody, entry.Incomplete)
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEmbedded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	// Run the proxy as an embedder would, with the public API only
+	var captured bytes.Buffer
+	p, err := NewProxy(Options{
+		LogDir: t.TempDir(),
+		Addr:   "127.0.0.1:0",
+		Writer: &captured,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	proxyURL, err := url.Parse("http://" + p.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get(upstream.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := p.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The writer gets the session record, then the entry
+	scanner := bufio.NewScanner(&captured)
+	var lines [][]byte
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	if len(lines) != 2 {
+		t.Fatalf("writer got %d lines, want the session record and one entry:\n%s", len(lines), captured.String())
+	}
+	var session SessionRecord
+	if err := json.Unmarshal(lines[0], &session); err != nil || session.Type != "session" {
+		t.Errorf("first line %s is not the session record", lines[0])
+	}
+	var entry RequestLog
+	if err := json.Unmarshal(lines[1], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.URL != upstream.URL+"/status" || entry.StatusCode != http.StatusOK || entry.ResponseBody != `{"ok":true}` {
+		t.Errorf("entry %s %d %q, want the request to /status", entry.URL, entry.StatusCode, entry.ResponseBody)
+	}
+
+	// The log file holds the same entry
+	entries, err := readEntries(p.GetLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].URL != entry.URL {
+		t.Errorf("log file has %d entries, want the one the writer got", len(entries))
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt reads a non-negative integer environment variable, returning def
+// when it is unset
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a non-negative integer", name, value)
+	}
+	return n, nil
+}
+
+// envTimeout reads a timeout such as 30s. Unset returns zero, leaving the
+// default; "0" disables the timeout and is returned as -1.
+func envTimeout(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a duration such as 30s, or 0 to disable", name, value)
+	}
+	if timeout == 0 {
+		return -1, nil
+	}
+	return timeout, nil
+}
+
+// envBool reports whether an environment variable is set to "true"
+func envBool(name string) bool {
+	return os.Getenv(name) == "true"
+}
+
+// envList reads a comma-separated environment variable, dropping empty items
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,17 @@
+package proxy
+
+import "testing"
+
+func TestOptionsFromEnvInvalidInt(t *testing.T) {
+	for _, tc := range []struct{ name, value string }{
+		{"FLOWSPEC_RETRY", "three"},
+		{"FLOWSPEC_MAX_CONNS_PER_HOST", "-1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(tc.name, tc.value)
+			if _, err := OptionsFromEnv(); err == nil {
+				t.Errorf("%s=%q accepted, want an error", tc.name, tc.value)
+			}
+		})
+	}
+}
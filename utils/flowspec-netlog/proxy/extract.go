@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errEntryNotFound is returned by FindEntry when no entry matches
+var errEntryNotFound = errors.New("no matching entry")
+
+// FindEntry returns the first entry of the log file at path for which match
+// returns true. n is the entry's 1-based position, not counting session
+// records or pause markers. A response body stored by FLOWSPEC_DEDUP_BODIES is read back
+// from the log directory.
+func FindEntry(path string, match func(n int, log *RequestLog) bool) (*RequestLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var found *RequestLog
+	n := 0
+	err = readLogRecords(file, func(line []byte) {
+		if found != nil || isSessionRecord(line) {
+			return
+		}
+		var log RequestLog
+		if err := json.Unmarshal(line, &log); err != nil || log.Pause != nil {
+			return
+		}
+		n++
+		if match(n, &log) {
+			found = &log
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errEntryNotFound
+	}
+
+	if err := loadBodyFiles(path, found); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// loadBodyFiles reads bodies stored outside an entry of the log file at
+// path (FLOWSPEC_BODIES_DIR and FLOWSPEC_DEDUP_BODIES) back into it
+func loadBodyFiles(path string, log *RequestLog) error {
+	for _, body := range []struct{ text, ref *string }{
+		{&log.RequestBody, &log.RequestBodyFile},
+		{&log.ResponseBody, &log.ResponseBodyFile},
+		{&log.ResponseBody, &log.ResponseBodyRef},
+	} {
+		if *body.text != "" || *body.ref == "" {
+			continue
+		}
+		data, err := os.ReadFile(resolveBodyRef(path, *body.ref))
+		if err != nil {
+			return fmt.Errorf("failed to read body file: %w", err)
+		}
+		*body.text = string(data)
+	}
+	return nil
+}
+
+// DumpHTTP writes log as a raw HTTP request in the style of
+// httputil.DumpRequest, followed by the response after a ### separator with
+// each line commented out, the layout .http files use for multiple messages.
+// Only the headers the logger captures are included, credentials stay
+// redacted, and urlencoded forms are rebuilt from their logged fields.
+func DumpHTTP(w io.Writer, log *RequestLog) error {
+	u, err := url.Parse(log.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", log.URL, err)
+	}
+	proto := log.ClientProtocol
+	if proto == "" || proto == h2cProtocol || strings.HasPrefix(proto, "HTTP/2") {
+		proto = "HTTP/1.1"
+	}
+
+	body := log.RequestBody
+	if body == "" && len(log.FormFields) > 0 {
+		body = url.Values(log.FormFields).Encode()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %s\r\n", log.Method, u.RequestURI(), proto)
+	fmt.Fprintf(&b, "Host: %s\r\n", log.Host)
+	names := make([]string, 0, len(log.Headers))
+	for name := range log.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := log.Headers[name]
+		if name == "Content-Length" && body != "" {
+			value = strconv.Itoa(len(body))
+		}
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	b.WriteString("\r\n")
+	b.WriteString(body)
+
+	if log.StatusCode > 0 {
+		b.WriteString("\n\n###\n")
+		fmt.Fprintf(&b, "# HTTP/1.1 %d %s\n", log.StatusCode, http.StatusText(log.StatusCode))
+		if log.ResponseBody != "" {
+			b.WriteString("#\n")
+			for _, line := range strings.Split(strings.TrimSuffix(log.ResponseBody, "\n"), "\n") {
+				b.WriteString("# " + line + "\n")
+			}
+		}
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
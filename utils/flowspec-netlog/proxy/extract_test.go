@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDumpHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{\"id\":7}\n"))
+	}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "http://")
+
+	p, client := newTestProxy(t, Options{})
+	req, err := http.NewRequest(http.MethodPost, upstream.URL+"/api/items?sort=name&page=2", strings.NewReader(`{"name":"ada"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "dump-test/1.0")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Not-Captured", "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	closeAndRead(t, p)
+
+	entry, err := FindEntry(p.GetLogPath(), func(n int, log *RequestLog) bool { return n == 1 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := DumpHTTP(&buf, entry); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+
+	want := "POST /api/items?sort=name&page=2 HTTP/1.1\r\n" +
+		"Host: " + host + "\r\n" +
+		"Authorization: [REDACTED]\r\n" +
+		"Content-Length: 14\r\n" +
+		"Content-Type: application/json\r\n" +
+		"User-Agent: dump-test/1.0\r\n" +
+		"\r\n" +
+		`{"name":"ada"}` +
+		"\n\n###\n" +
+		"# HTTP/1.1 201 Created\n" +
+		"#\n" +
+		"# {\"id\":7}\n"
+	if dump != want {
+		t.Errorf("dump =\n%q\nwant\n%q", dump, want)
+	}
+
+	// The request part parses as HTTP
+	parsed, err := http.ReadRequest(bufio.NewReader(strings.NewReader(dump)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(parsed.Body)
+	if parsed.Method != http.MethodPost || parsed.Host != host || string(body) != `{"name":"ada"}` {
+		t.Errorf("parsed %s %s, body %q", parsed.Method, parsed.Host, body)
+	}
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// failConditions are the FLOWSPEC_FAIL_ON conditions. "blocked" counts
+// requests refused by the proxy itself, those with the block disposition.
+var failConditions = map[string]func(s *SessionSummary) int{
+	"errors":  func(s *SessionSummary) int { return s.Errors },
+	"4xx":     func(s *SessionSummary) int { return s.StatusClasses["4xx"] },
+	"5xx":     func(s *SessionSummary) int { return s.StatusClasses["5xx"] },
+	"blocked": func(s *SessionSummary) int { return s.Dispositions[dispositionBlock] },
+}
+
+// parseFailOn validates FLOWSPEC_FAIL_ON conditions
+func parseFailOn(items []string) ([]string, error) {
+	conditions := make([]string, 0, len(items))
+	for _, item := range items {
+		condition := strings.ToLower(item)
+		if failConditions[condition] == nil {
+			return nil, fmt.Errorf("unknown condition %q: want errors, 4xx, 5xx, or blocked", item)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+// checkFailures records in Failures the count of each condition that
+// occurred during the session
+func (s *SessionSummary) checkFailures(conditions []string) {
+	for _, condition := range conditions {
+		if count := failConditions[condition](s); count > 0 {
+			if s.Failures == nil {
+				s.Failures = make(map[string]int)
+			}
+			s.Failures[condition] = count
+		}
+	}
+}
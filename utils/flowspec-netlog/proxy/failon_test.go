@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFailOnBlocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "network.blocked.jsonl")
+	log := `{"method":"GET","url":"http://api.example.com/","host":"api.example.com","status_code":403,"error_kind":"forbidden","disposition":"block"}
+{"method":"GET","url":"http://api.example.com/","host":"api.example.com","status_code":503,"error_kind":"throttled","disposition":"block"}
+{"method":"CONNECT","url":"127.0.0.1:8080","host":"127.0.0.1:8080","status_code":403,"error_kind":"self_reference","disposition":"block"}
+{"method":"GET","url":"http://api.example.com/","host":"api.example.com","status_code":502,"error_kind":"dial","disposition":"error"}
+`
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := SummarizeFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary.checkFailures([]string{"blocked"})
+	if got := summary.Failures["blocked"]; got != 3 {
+		t.Errorf("blocked = %d, want 3 (forbidden, throttled, and self_reference)", got)
+	}
+}
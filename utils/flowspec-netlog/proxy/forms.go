@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"mime"
+	"net/url"
+	"strings"
+)
+
+// sensitiveParamWords mark form fields whose values are redacted
+var sensitiveParamWords = []string{
+	"password", "passwd", "secret", "token", "apikey", "api_key", "auth", "credential", "session",
+}
+
+// isSensitiveParam reports whether a parameter name suggests a credential
+func isSensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveParamWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFormBody reports whether a content type is application/x-www-form-urlencoded
+func isFormBody(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// parseFormFields parses a urlencoded body, redacting sensitive values.
+// It returns nil if the body is not a valid form.
+func parseFormFields(body []byte) map[string][]string {
+	values, err := url.ParseQuery(string(body))
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+
+	for name, vals := range values {
+		if !isSensitiveParam(name) {
+			continue
+		}
+		for i := range vals {
+			vals[i] = "[REDACTED]"
+		}
+	}
+	return values
+}
+
+// redactFormPreview redacts sensitive fields in the preview of a form body
+// too large to capture; the last field may be truncated
+func redactFormPreview(preview string) string {
+	fields := parseFormFields([]byte(preview))
+	if fields == nil {
+		return preview
+	}
+	return url.Values(fields).Encode()
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormFieldsRedacted(t *testing.T) {
+	received := make(chan string, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	form := url.Values{"user": {"ada"}, "password": {"hunter2"}, "tags": {"a", "b"}}.Encode()
+	resp, err := client.Post(upstream.URL+"/login", "application/x-www-form-urlencoded", strings.NewReader(form))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// The upstream gets the form unchanged
+	if got := <-received; got != form {
+		t.Errorf("upstream received %q, want %q", got, form)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	want := map[string][]string{"user": {"ada"}, "password": {"[REDACTED]"}, "tags": {"a", "b"}}
+	if !reflect.DeepEqual(entries[0].FormFields, want) {
+		t.Errorf("form fields = %v, want %v", entries[0].FormFields, want)
+	}
+	if strings.Contains(entries[0].RequestBody, "hunter2") {
+		t.Errorf("request body %q holds the password", entries[0].RequestBody)
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedChain returns the client addresses recorded by proxies in front
+// of this one, original client first. The standard Forwarded header is
+// preferred; X-Forwarded-For is used when it has no for= parameters.
+// Entries are kept as sent, so obfuscated ones ("unknown", "_hidden") and
+// ports stay in the chain.
+func forwardedChain(h http.Header) []string {
+	var chain []string
+	for _, value := range h.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, node, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					if node = strings.Trim(strings.TrimSpace(node), `"`); node != "" {
+						chain = append(chain, node)
+					}
+				}
+			}
+		}
+	}
+	if len(chain) > 0 {
+		return chain
+	}
+
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, node := range strings.Split(value, ",") {
+			if node = strings.TrimSpace(node); node != "" {
+				chain = append(chain, node)
+			}
+		}
+	}
+	return chain
+}
+
+// originClientIP returns the leftmost IP address of a forwarded chain
+// without its port, or "" if no entry is an address
+func originClientIP(chain []string) string {
+	for _, node := range chain {
+		if ip := forwardedNodeIP(node); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// forwardedNodeIP parses a chain entry: 192.0.2.1, 192.0.2.1:443,
+// 2001:db8::1, or [2001:db8::1]:443
+func forwardedNodeIP(node string) net.IP {
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Log file formats, see FLOWSPEC_LOG_FORMAT
+const (
+	logFormatJSONL = "jsonl"
+	logFormatGob   = "gob"
+)
+
+// gobMagic starts every gob log file so readers can tell it from JSONL
+const gobMagic = "FLOWSPEC-GOB\n"
+
+// logEncoder writes log records; *json.Encoder and *gobLogEncoder implement it
+type logEncoder interface {
+	Encode(v interface{}) error
+}
+
+// gobRecord is one value of a gob log stream; Session or Entry is set.
+// gob drops pointers to zero values, such as a grpc_status of 0 or a pause
+// marker that skipped nothing, so Zero names the entry's pointer fields
+// that point to one.
+type gobRecord struct {
+	Session *SessionRecord
+	Entry   *RequestLog
+	Zero    []string
+}
+
+// gobZeroFields lists the pointer fields of log that point to zero values
+func gobZeroFields(log *RequestLog) []string {
+	var zero []string
+	add := func(name string, isZero bool) {
+		if isZero {
+			zero = append(zero, name)
+		}
+	}
+	add("timings", log.Timings != nil && *log.Timings == (Timings{}))
+	add("pause", log.Pause != nil && *log.Pause == (PauseMarker{}))
+	add("request_body_overflow", log.RequestBodyOverflow != nil && *log.RequestBodyOverflow == (BodyOverflow{}))
+	add("response_body_overflow", log.ResponseBodyOverflow != nil && *log.ResponseBodyOverflow == (BodyOverflow{}))
+	add("grpc_status", log.GRPCStatus != nil && *log.GRPCStatus == 0)
+	if c := log.Cache; c != nil {
+		add("cache", *c == (CacheInfo{}))
+		add("cache.max_age", c.MaxAge != nil && *c.MaxAge == 0)
+		add("cache.s_maxage", c.SMaxAge != nil && *c.SMaxAge == 0)
+		add("cache.age", c.Age != nil && *c.Age == 0)
+	}
+	return zero
+}
+
+// restoreGobZeros sets the pointer fields named by gobZeroFields, which gob
+// dropped, back to zero values
+func restoreGobZeros(log *RequestLog, zero []string) {
+	cache := func() *CacheInfo {
+		if log.Cache == nil {
+			log.Cache = &CacheInfo{}
+		}
+		return log.Cache
+	}
+	for _, name := range zero {
+		switch name {
+		case "timings":
+			log.Timings = &Timings{}
+		case "pause":
+			log.Pause = &PauseMarker{}
+		case "request_body_overflow":
+			log.RequestBodyOverflow = &BodyOverflow{}
+		case "response_body_overflow":
+			log.ResponseBodyOverflow = &BodyOverflow{}
+		case "grpc_status":
+			log.GRPCStatus = new(int)
+		case "cache":
+			cache()
+		case "cache.max_age":
+			cache().MaxAge = new(int64)
+		case "cache.s_maxage":
+			cache().SMaxAge = new(int64)
+		case "cache.age":
+			cache().Age = new(int64)
+		}
+	}
+}
+
+// gobLogEncoder writes log records as a gob stream, which encodes several
+// times faster than JSON since field names are sent once per file
+type gobLogEncoder struct {
+	enc *gob.Encoder
+}
+
+// newGobLogEncoder starts a gob log on w
+func newGobLogEncoder(w io.Writer) (*gobLogEncoder, error) {
+	if _, err := io.WriteString(w, gobMagic); err != nil {
+		return nil, err
+	}
+	return &gobLogEncoder{enc: gob.NewEncoder(w)}, nil
+}
+
+// Encode writes a *SessionRecord or *RequestLog
+func (e *gobLogEncoder) Encode(v interface{}) error {
+	switch v := v.(type) {
+	case *SessionRecord:
+		return e.enc.Encode(gobRecord{Session: v})
+	case *RequestLog:
+		return e.enc.Encode(gobRecord{Entry: v, Zero: gobZeroFields(v)})
+	}
+	return fmt.Errorf("cannot write %T to a gob log", v)
+}
+
+// readGobRecords calls fn with each record of a gob log, after the magic,
+// as a compact JSON line. A record cut short by a crash ends the file.
+func readGobRecords(r io.Reader, fn func(line []byte)) error {
+	decoder := gob.NewDecoder(r)
+	var line bytes.Buffer
+	encoder := newLogEncoder(&line, false)
+	for {
+		var record gobRecord
+		if err := decoder.Decode(&record); err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("malformed gob log record: %w", err)
+		}
+
+		line.Reset()
+		var err error
+		if record.Session != nil {
+			err = encoder.Encode(record.Session)
+		} else {
+			if record.Entry == nil {
+				record.Entry = &RequestLog{}
+			}
+			restoreGobZeros(record.Entry, record.Zero)
+			err = encoder.Encode(record.Entry)
+		}
+		if err != nil {
+			return err
+		}
+		fn(bytes.TrimSuffix(line.Bytes(), []byte("\n")))
+	}
+}
+
+// ConvertToJSONL writes the records of the log file at path, in any format,
+// to w as JSONL. Session records are kept, and a file written with a newer
+// schema than LogSchemaVersion produces a warning.
+func ConvertToJSONL(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var writeErr error
+	err = readLogRecords(file, func(line []byte) {
+		if isSessionRecord(line) {
+			var session SessionRecord
+			if json.Unmarshal(line, &session) == nil {
+				checkSchemaVersion(path, session.SchemaVersion)
+			}
+		}
+		if writeErr == nil {
+			_, writeErr = fmt.Fprintf(w, "%s\n", line)
+		}
+	})
+	if err == nil {
+		err = writeErr
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// sampleEntry returns an entry with the fields a typical capture sets
+func sampleEntry() *RequestLog {
+	status := 0
+	return &RequestLog{
+		Timestamp:       "2025-12-25T12:00:00Z",
+		EndTimestamp:    "2025-12-25T12:00:01Z",
+		Method:          "POST",
+		URL:             "https://api.example.com/v1/users?page=2",
+		Host:            "api.example.com",
+		StatusCode:      201,
+		Duration:        42,
+		Headers:         map[string]string{"Content-Type": "application/json", "Authorization": "[REDACTED]"},
+		ResponseHeaders: map[string]string{"Content-Type": "application/json", "Cache-Control": "no-store"},
+		RequestBody:     `{"name":"ada"}`,
+		ResponseBody:    `{"id":7,"name":"ada"}`,
+		Timings:         &Timings{DNSMs: 1.5, ConnectMs: 3.25, TLSMs: 12, TTFBMs: 40},
+		ForwardedFor:    []string{"203.0.113.7", "10.0.0.2"},
+		FormFields:      map[string][]string{"a": {"1", "2"}},
+		GRPCStatus:      &status,
+		Cache:           &CacheInfo{ETag: `"x"`, Cacheable: true},
+	}
+}
+
+func TestGobRoundTrip(t *testing.T) {
+	session := &SessionRecord{Type: sessionRecordType, SchemaVersion: LogSchemaVersion, Tags: map[string]string{"test": "gob"}}
+	entry := sampleEntry()
+	// Pointers to zero values, which gob drops on its own
+	zeroAge := int64(0)
+	entry.Cache.MaxAge, entry.Cache.Age = &zeroAge, &zeroAge
+	marker := &RequestLog{Timestamp: entry.Timestamp, Pause: &PauseMarker{}, Timings: &Timings{}}
+	records := []interface{}{session, entry, marker}
+
+	var buf bytes.Buffer
+	encoder, err := newGobLogEncoder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lines []string
+	if err := readLogRecords(&buf, func(line []byte) {
+		lines = append(lines, string(line))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != len(records) {
+		t.Fatalf("read %d records, want %d", len(lines), len(records))
+	}
+	for i, want := range records {
+		var expected bytes.Buffer
+		if err := newLogEncoder(&expected, false).Encode(want); err != nil {
+			t.Fatal(err)
+		}
+		if got := lines[i]; got != string(bytes.TrimSuffix(expected.Bytes(), []byte("\n"))) {
+			t.Errorf("record %d:\n got %s\nwant %s", i, got, expected.Bytes())
+		}
+	}
+}
+
+func BenchmarkEncodeGob(b *testing.B) {
+	entry := sampleEntry()
+	encoder, err := newGobLogEncoder(io.Discard)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := encoder.Encode(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	entry := sampleEntry()
+	encoder := json.NewEncoder(io.Discard)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := encoder.Encode(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	grpcFrameHeaderLen = 5    // 1-byte compressed flag + 4-byte big-endian length
+	maxGRPCFrames      = 1000 // frame sizes recorded per direction
+)
+
+// isGRPC reports whether a content type is gRPC (application/grpc, +proto, +json, ...)
+func isGRPC(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	return contentType == "application/grpc" ||
+		strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// parseGRPCPath splits a "/package.Service/Method" path into service and method
+func parseGRPCPath(path string) (service, method string) {
+	path = strings.TrimPrefix(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 || i == len(path)-1 {
+		return "", ""
+	}
+	return path[:i], path[i+1:]
+}
+
+// grpcFrames records the sizes of length-prefixed gRPC messages as a body
+// streams past. Payloads are skipped, never decoded.
+type grpcFrames struct {
+	mu        sync.Mutex
+	header    [grpcFrameHeaderLen]byte
+	headerLen int
+	remaining uint32
+	sizes     []int
+}
+
+// write feeds the next chunk of the stream into the frame parser
+func (f *grpcFrames) write(p []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(p) > 0 {
+		if f.remaining > 0 {
+			n := uint32(len(p))
+			if n > f.remaining {
+				n = f.remaining
+			}
+			f.remaining -= n
+			p = p[n:]
+			continue
+		}
+
+		n := copy(f.header[f.headerLen:], p)
+		f.headerLen += n
+		p = p[n:]
+		if f.headerLen < grpcFrameHeaderLen {
+			return
+		}
+
+		f.headerLen = 0
+		f.remaining = binary.BigEndian.Uint32(f.header[1:])
+		if len(f.sizes) < maxGRPCFrames {
+			f.sizes = append(f.sizes, int(f.remaining))
+		}
+	}
+}
+
+// list returns the frame sizes seen so far
+func (f *grpcFrames) list() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.sizes...)
+}
+
+// grpcFrameReader feeds everything read from a body into a frame parser
+type grpcFrameReader struct {
+	io.ReadCloser
+	frames *grpcFrames
+}
+
+// Read implements io.Reader
+func (r *grpcFrameReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.frames.write(p[:n])
+	return n, err
+}
+
+// grpcCapture holds the per-call framing state of a gRPC request
+type grpcCapture struct {
+	request  grpcFrames
+	response grpcFrames
+}
+
+// captureGRPCRequest marks log as a gRPC call and starts counting request frames
+func captureGRPCRequest(log *RequestLog, req *http.Request) {
+	if !isGRPC(req.Header.Get("Content-Type")) {
+		return
+	}
+
+	log.GRPCService, log.GRPCMethod = parseGRPCPath(req.URL.Path)
+	log.grpc = &grpcCapture{}
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &grpcFrameReader{ReadCloser: req.Body, frames: &log.grpc.request}
+	}
+}
+
+// captureGRPCResponse starts counting response frames of a gRPC call
+func captureGRPCResponse(log *RequestLog, resp *http.Response) {
+	if log.grpc == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	resp.Body = &grpcFrameReader{ReadCloser: resp.Body, frames: &log.grpc.response}
+}
+
+// finishGRPC copies the frame sizes and the grpc-status/grpc-message
+// trailers into log. Trailers are only populated once the response body has
+// been read to EOF; trailers-only responses carry them in the headers.
+func finishGRPC(log *RequestLog, resp *http.Response) {
+	if log.grpc == nil {
+		return
+	}
+
+	log.GRPCRequestFrames = log.grpc.request.list()
+	log.GRPCResponseFrames = log.grpc.response.list()
+
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if code, err := strconv.Atoi(status); err == nil {
+		log.GRPCStatus = &code
+	}
+	// grpc-message is percent-encoded on the wire
+	if decoded, err := url.PathUnescape(message); err == nil {
+		message = decoded
+	}
+	log.GRPCMessage = message
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// grpcFrame returns msg as a length-prefixed gRPC message
+func grpcFrame(msg string) []byte {
+	frame := make([]byte, grpcFrameHeaderLen, grpcFrameHeaderLen+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func TestGRPCCall(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write(grpcFrame("hi"))
+		w.Write(grpcFrame("there"))
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set("Grpc-Message", "user%20not%20found")
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	body := append(grpcFrame("abc"), grpcFrame("defg")...)
+	req, err := http.NewRequest("POST", upstream.URL+"/helloworld.Greeter/SayHello", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.GRPCService != "helloworld.Greeter" || entry.GRPCMethod != "SayHello" {
+		t.Errorf("service %q, method %q; want helloworld.Greeter and SayHello", entry.GRPCService, entry.GRPCMethod)
+	}
+	if entry.GRPCStatus == nil || *entry.GRPCStatus != 5 || entry.GRPCMessage != "user not found" {
+		t.Errorf("grpc status %v, message %q; want 5 and the decoded message", entry.GRPCStatus, entry.GRPCMessage)
+	}
+	if !reflect.DeepEqual(entry.GRPCRequestFrames, []int{3, 4}) || !reflect.DeepEqual(entry.GRPCResponseFrames, []int{2, 5}) {
+		t.Errorf("request frames %v, response frames %v; want [3 4] and [2 5]", entry.GRPCRequestFrames, entry.GRPCResponseFrames)
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// h2cProtocol is the ClientProtocol of requests sent as cleartext HTTP/2
+// with prior knowledge
+const h2cProtocol = "h2c"
+
+// ServeHTTP proxies req. Cleartext HTTP/2 requests carry only a path, with
+// the target in :authority, so they are rewritten to the absolute form
+// goproxy expects. Start serves h2c when built with Go 1.24 or later;
+// otherwise the connection preface arrives here as a PRI request and is
+// refused with an HTTP/1 error instead of being mistaken for a request.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.ProtoMajor == 2 && req.TLS == nil {
+		switch {
+		case req.Method == "PRI":
+			http.Error(w, "h2c is not supported by this build", http.StatusHTTPVersionNotSupported)
+			return
+		case req.Method == http.MethodConnect:
+			// Tunnels hijack the client connection, which HTTP/2 cannot hand over
+			http.Error(w, "CONNECT over h2c is not supported", http.StatusMethodNotAllowed)
+			return
+		case !req.URL.IsAbs():
+			req.URL.Scheme = "http"
+			req.URL.Host = req.Host
+		}
+	}
+	p.ProxyHttpServer.ServeHTTP(w, req)
+}
+
+// clientProtocol returns the ClientProtocol of req
+func clientProtocol(req *http.Request) string {
+	if req.ProtoMajor == 2 && req.TLS == nil {
+		return h2cProtocol
+	}
+	return req.Proto
+}
@@ -0,0 +1,15 @@
+//go:build go1.24
+
+package proxy
+
+import (
+	"net/http"
+)
+
+// enableH2C lets server accept cleartext HTTP/2 with prior knowledge
+// alongside HTTP/1
+func enableH2C(server *http.Server) {
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+}
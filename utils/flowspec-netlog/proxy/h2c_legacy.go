@@ -0,0 +1,11 @@
+//go:build !go1.24
+
+package proxy
+
+import (
+	"net/http"
+)
+
+// enableH2C is a no-op before Go 1.24, whose net/http cannot serve
+// cleartext HTTP/2; ServeHTTP refuses the preface instead
+func enableH2C(server *http.Server) {}
@@ -0,0 +1,54 @@
+//go:build go1.24
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	p, addr := startTestProxy(t, Options{})
+
+	// The client speaks HTTP/2 from the first byte, addressing the upstream
+	// through :authority
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	req, err := http.NewRequest("GET", "http://"+addr+"/greeting", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = strings.TrimPrefix(upstream.URL, "http://")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK || string(body) != "hello /greeting" {
+		t.Errorf("got %s %d %q, want HTTP/2 200 from the upstream", resp.Proto, resp.StatusCode, body)
+	}
+	client.CloseIdleConnections()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.ClientProtocol != h2cProtocol || entry.URL != upstream.URL+"/greeting" || entry.StatusCode != http.StatusOK {
+		t.Errorf("entry protocol %q, URL %q, status %d; want %q, %q, 200",
+			entry.ClientProtocol, entry.URL, entry.StatusCode, h2cProtocol, upstream.URL+"/greeting")
+	}
+}
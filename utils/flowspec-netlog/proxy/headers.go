@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// defaultRequestHeaders are the request headers captured unless
+// FLOWSPEC_REQUEST_HEADERS replaces them (selective to avoid clutter)
+var defaultRequestHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"User-Agent",
+	"Authorization",
+	"X-Request-ID",
+	"X-API-Key",
+	"Cookie",
+}
+
+// defaultResponseHeaders are the response headers captured unless
+// FLOWSPEC_RESPONSE_HEADERS replaces them
+var defaultResponseHeaders = []string{
+	"Content-Type",
+	"Content-Length",
+	"Cache-Control",
+	"ETag",
+	"Location",
+	"Server",
+}
+
+// sensitiveHeaders contain credentials and are redacted even when listed
+// explicitly. Keys are canonical header names.
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"X-Api-Key":     true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+// headerAllowlist returns the headers to capture: custom when configured,
+// otherwise defaults
+func headerAllowlist(custom, defaults []string) []string {
+	if len(custom) > 0 {
+		return custom
+	}
+	return defaults
+}
+
+// captureHeaders returns the values of the allowlisted headers present in
+// h, keyed as written in names, with sensitive values redacted
+func captureHeaders(h http.Header, names []string) map[string]string {
+	captured := make(map[string]string)
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			// Redact sensitive credentials to prevent exposure in logs
+			if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+				captured[name] = "[REDACTED]"
+			} else {
+				captured[name] = v
+			}
+		}
+	}
+	return captured
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCustomHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "cache-7")
+		w.Header().Set("Content-Type", "text/plain")
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{
+		RequestHeaders:  []string{"X-Trace", "Authorization"},
+		ResponseHeaders: []string{"X-Served-By"},
+	})
+	req, err := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Trace", "abc")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("User-Agent", "custom-test")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	// Only the configured headers are kept, and credentials stay redacted
+	wantRequest := map[string]string{"X-Trace": "abc", "Authorization": "[REDACTED]"}
+	if !reflect.DeepEqual(entries[0].Headers, wantRequest) {
+		t.Errorf("request headers = %v, want %v", entries[0].Headers, wantRequest)
+	}
+	wantResponse := map[string]string{"X-Served-By": "cache-7"}
+	if !reflect.DeepEqual(entries[0].ResponseHeaders, wantResponse) {
+		t.Errorf("response headers = %v, want %v", entries[0].ResponseHeaders, wantResponse)
+	}
+}
+
+func TestResponseHeadersSeparate(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Request-ID", "from-response")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	req, err := http.NewRequest(http.MethodPost, upstream.URL, strings.NewReader("a=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Request-ID", "from-request")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	// The same header name keeps each side's value
+	for _, tc := range []struct {
+		side    string
+		headers map[string]string
+		name    string
+		want    string
+	}{
+		{"request", entry.Headers, "Content-Type", "application/x-www-form-urlencoded"},
+		{"request", entry.Headers, "X-Request-ID", "from-request"},
+		{"response", entry.ResponseHeaders, "Content-Type", "application/json"},
+		{"response", entry.ResponseHeaders, "Cache-Control", "no-store"},
+	} {
+		if got := tc.headers[tc.name]; got != tc.want {
+			t.Errorf("%s %s = %q, want %q", tc.side, tc.name, got, tc.want)
+		}
+	}
+	// Response headers are not mixed into the request's
+	if _, ok := entry.Headers["Cache-Control"]; ok {
+		t.Errorf("request headers hold the response's Cache-Control: %v", entry.Headers)
+	}
+	if _, ok := entry.ResponseHeaders["X-Request-ID"]; ok {
+		t.Errorf("response headers hold X-Request-ID, not in the response allowlist: %v", entry.ResponseHeaders)
+	}
+}
+
+func TestSourceHeader(t *testing.T) {
+	var forwarded atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header[SourceHeader]; ok {
+			forwarded.Add(1)
+		}
+	})
+	upstream := httptest.NewServer(handler)
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(handler)
+	defer tlsUpstream.Close()
+
+	for _, tc := range []struct {
+		name   string
+		opts   Options
+		target string
+	}{
+		{"forwarded", Options{}, upstream.URL},
+		{"intercepted", Options{InsecureUpstream: true}, tlsUpstream.URL},
+		{"bypassed", Options{NoProxy: []string{"127.0.0.1"}}, upstream.URL},
+	} {
+		forwarded.Store(0)
+		p, client := newTestProxy(t, tc.opts)
+		for _, source := range []string{"billing-worker", "billing-worker", "checkout"} {
+			req, err := http.NewRequest("GET", tc.target, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(SourceHeader, source)
+			resp, err := skipVerify(client).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+		if n := forwarded.Load(); n != 0 {
+			t.Errorf("%s: %s forwarded upstream %d times", tc.name, SourceHeader, n)
+		}
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 3 || entries[0].Source != "billing-worker" || entries[2].Source != "checkout" {
+			var sources []string
+			for _, entry := range entries {
+				sources = append(sources, entry.Source)
+			}
+			t.Errorf("%s: entry sources %q, want billing-worker twice then checkout", tc.name, sources)
+		}
+		want := map[string]int{"billing-worker": 2, "checkout": 1}
+		if got := p.Summary().Sources; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: summary sources %v, want %v", tc.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseHookTagsEntries(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + listener.Addr().String()
+	listener.Close()
+
+	p, client := newTestProxy(t, Options{
+		OnRequestHook: func(req *http.Request) *http.Response {
+			if req.URL.Path != "/hooked" {
+				return nil
+			}
+			return &http.Response{
+				StatusCode: http.StatusTeapot,
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}
+		},
+		OnResponseHook: func(entry *RequestLog) {
+			entry.Tags = map[string]string{"team": "payments"}
+		},
+	})
+	for _, url := range []string{upstream.URL, upstream.URL + "/hooked", refused} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for _, entry := range entries {
+		if got := entry.Tags["team"]; got != "payments" {
+			t.Errorf("%s (%s): tag team = %q, want %q", entry.URL, entry.Disposition, got, "payments")
+		}
+	}
+	if got := entries[1].Disposition; got != dispositionHook {
+		t.Errorf("hooked request disposition = %q, want %q", got, dispositionHook)
+	}
+}
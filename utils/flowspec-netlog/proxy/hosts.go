@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// hostRules are the compiled host lists deciding which traffic is bypassed
+// and which HTTPS hosts are decrypted. A value is never modified once
+// published, so a request that loads it sees one consistent snapshot.
+type hostRules struct {
+	noProxy   *hostMatcher
+	mitmHosts *hostMatcher
+}
+
+// hostsFile is the format of FLOWSPEC_HOSTS_FILE; its lists are added to
+// NO_PROXY and FLOWSPEC_MITM_HOSTS
+type hostsFile struct {
+	NoProxy   []string `json:"no_proxy"`
+	MITMHosts []string `json:"mitm_hosts"`
+}
+
+// loadHostRules compiles the configured host lists plus those in path, if set
+func loadHostRules(noProxy, mitmHosts []string, path string) (*hostRules, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hosts file: %w", err)
+		}
+		var file hostsFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse hosts file: %w", err)
+		}
+		noProxy = append(append([]string(nil), noProxy...), file.NoProxy...)
+		mitmHosts = append(append([]string(nil), mitmHosts...), file.MITMHosts...)
+	}
+
+	return &hostRules{
+		noProxy:   newHostMatcher(noProxy),
+		mitmHosts: newHostMatcher(mitmHosts),
+	}, nil
+}
+
+// bypass reports whether host is forwarded without logging, and the
+// NO_PROXY entry that matched. Include the port so that port-specific
+// entries apply.
+func (r *hostRules) bypass(host string) (string, bool) {
+	return r.noProxy.match(host)
+}
+
+// intercept reports whether HTTPS traffic to host should be decrypted, and
+// the MITM hosts entry that matched. With no MITM hosts configured every host
+// is intercepted and no rule is reported.
+func (r *hostRules) intercept(host string) (string, bool) {
+	if r.mitmHosts.empty() {
+		return "", true
+	}
+	return r.mitmHosts.match(host)
+}
+
+// Reload re-reads FLOWSPEC_HOSTS_FILE and atomically swaps in the new host
+// rules. Requests already in flight keep the rules they started with, and
+// the capture continues in the same log file.
+func (p *Proxy) Reload() error {
+	rules, err := loadHostRules(p.opts.NoProxy, p.opts.MITMHosts, p.opts.HostsFile)
+	if err != nil {
+		return err
+	}
+	p.logger.hosts.Store(rules)
+	return nil
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadHostsFile(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "http://")
+
+	hostsFile := filepath.Join(t.TempDir(), "hosts.json")
+	writeHosts := func(content string) {
+		if err := os.WriteFile(hostsFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeHosts(`{"no_proxy": []}`)
+
+	p, client := newTestProxy(t, Options{HostsFile: hostsFile})
+	get := func() {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d, want 200", resp.StatusCode)
+		}
+	}
+	logPath := p.GetLogPath()
+
+	get()
+	writeHosts(`{"no_proxy": ["` + host + `"]}`)
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	get()
+
+	// A broken file keeps the rules in force
+	writeHosts(`{"no_proxy": [`)
+	if err := p.Reload(); err == nil {
+		t.Error("Reload of a malformed hosts file succeeded")
+	}
+	get()
+
+	if path := p.GetLogPath(); path != logPath {
+		t.Errorf("log path after reload = %s, want %s", path, logPath)
+	}
+	entries := closeAndRead(t, p)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, want := range []string{dispositionForward, dispositionBypass, dispositionBypass} {
+		if entries[i].Disposition != want {
+			t.Errorf("entry %d disposition = %q, want %q", i, entries[i].Disposition, want)
+		}
+	}
+	if entries[1].MatchedRule != host {
+		t.Errorf("bypassed entry matched rule %q, want %q", entries[1].MatchedRule, host)
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// indexFileName lists every capture session written to a log directory
+const indexFileName = "index.json"
+
+// IndexEntry describes one capture session in index.json
+type IndexEntry struct {
+	Started     string            `json:"started"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	LogFiles    []string          `json:"log_files"`
+	SummaryFile string            `json:"summary_file,omitempty"`
+	Requests    int               `json:"requests"`
+}
+
+// ReadIndex returns the sessions listed in dir's index.json, oldest first,
+// or none if it does not exist
+func ReadIndex(dir string) ([]IndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	var entries []IndexEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", indexFileName, err)
+	}
+	return entries, nil
+}
+
+// UpdateIndex appends this session, with its tags, log files, and summary
+// file, to index.json in the log directory. File names are relative to it.
+func (l *Logger) UpdateIndex(summary *SessionSummary, summaryPath string) error {
+	entries, err := ReadIndex(l.logDir)
+	if err != nil {
+		return err
+	}
+
+	entry := IndexEntry{
+		Started:  l.session.Started,
+		Tags:     l.session.Tags,
+		LogFiles: []string{},
+	}
+	if summaryPath != "" {
+		entry.SummaryFile = filepath.Base(summaryPath)
+	}
+	for _, path := range l.logFiles() {
+		entry.LogFiles = append(entry.LogFiles, filepath.Base(path))
+	}
+	if summary != nil {
+		entry.Requests = summary.Total
+	}
+	entries = append(entries, entry)
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	// Write a temporary file first so a crash never leaves a torn index
+	path := filepath.Join(l.logDir, indexFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elazarl/goproxy"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	leafValidity = 30 * 24 * time.Hour // lifetime of issued leaf certificates
+	leafBackdate = time.Hour           // tolerate clients with slightly slow clocks
+	maxLeafCerts = 1024                // cached leaf certificates, least recently used evicted
+)
+
+// leafSigner issues the certificates presented to clients of intercepted
+// HTTPS hosts, signed by the proxy's CA and cached by name. The cache holds
+// up to maxCerts certificates, since clients choose the names, and evicts
+// the least recently used. With wildcard set, hosts under a common parent
+// share one *.parent certificate.
+type leafSigner struct {
+	ca       *tls.Certificate
+	caCert   *x509.Certificate
+	wildcard bool
+	maxCerts int
+
+	mu    sync.Mutex
+	lru   *list.List // of *leafCert, most recently used first
+	certs map[string]*list.Element
+}
+
+// leafCert is a cached certificate and the name it is cached under
+type leafCert struct {
+	name string
+	cert *tls.Certificate
+}
+
+// newLeafSigner returns a signer for ca
+func newLeafSigner(ca *tls.Certificate, wildcard bool) (*leafSigner, error) {
+	caCert := ca.Leaf
+	if caCert == nil {
+		var err error
+		if caCert, err = x509.ParseCertificate(ca.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+		}
+	}
+	return &leafSigner{
+		ca:       ca,
+		caCert:   caCert,
+		wildcard: wildcard,
+		maxCerts: maxLeafCerts,
+		lru:      list.New(),
+		certs:    make(map[string]*list.Element),
+	}, nil
+}
+
+// tlsConfig is the goproxy ConnectAction TLSConfig hook. The certificate
+// is chosen by the SNI the client sends, falling back to the CONNECT host
+// for clients that send none (such as those connecting to an IP).
+func (s *leafSigner) tlsConfig(host string, ctx *goproxy.ProxyCtx) (*tls.Config, error) {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hostname
+			if hello.ServerName != "" {
+				name = hello.ServerName
+			}
+			return s.certificate(name)
+		},
+	}, nil
+}
+
+// certificate returns the cached certificate covering host, issuing it on
+// first use
+func (s *leafSigner) certificate(host string) (*tls.Certificate, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	names := s.names(host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.certs[names[0]]; ok {
+		cached := elem.Value.(*leafCert)
+		if time.Now().Before(cached.cert.Leaf.NotAfter) {
+			s.lru.MoveToFront(elem)
+			return cached.cert, nil
+		}
+		s.lru.Remove(elem)
+		delete(s.certs, names[0])
+	}
+	cert, err := s.sign(names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate for %s: %w", host, err)
+	}
+	for s.lru.Len() >= s.maxCerts {
+		oldest := s.lru.Remove(s.lru.Back()).(*leafCert)
+		delete(s.certs, oldest.name)
+	}
+	s.certs[names[0]] = s.lru.PushFront(&leafCert{name: names[0], cert: cert})
+	return cert, nil
+}
+
+// names returns the subject alternative names of the certificate for host.
+// A wildcard only matches one label, so *.example.com is issued for
+// a.example.com but not for example.com itself or IP addresses. The wildcard
+// stays below the registrable domain of the public suffix list: example.co.uk
+// and user.github.io get a certificate of their own rather than *.co.uk or
+// *.github.io.
+func (s *leafSigner) names(host string) []string {
+	if !s.wildcard || net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	_, parent, ok := strings.Cut(host, ".")
+	if !ok {
+		return []string{host}
+	}
+	if _, err := publicsuffix.EffectiveTLDPlusOne(parent); err != nil {
+		return []string{host} // parent is a public suffix
+	}
+	return []string{"*." + parent, parent}
+}
+
+// sign issues a certificate for names. IP addresses go in IPAddresses and
+// everything else in DNSNames, since clients match the requested host
+// against the SANs and ignore the common name.
+func (s *leafSigner) sign(names []string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(s.caCert.NotAfter) {
+		notAfter = s.caCert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{caOrg},
+			CommonName:   names[0],
+		},
+		NotBefore:             now.Add(-leafBackdate),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, s.caCert, &key.PublicKey, s.ca.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, s.ca.Certificate[0]},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
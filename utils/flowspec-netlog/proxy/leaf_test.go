@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestLeafNames(t *testing.T) {
+	s := &leafSigner{wildcard: true}
+	for _, tc := range []struct {
+		host string
+		want []string
+	}{
+		{"api.example.com", []string{"*.example.com", "example.com"}},
+		{"v2.api.example.com", []string{"*.api.example.com", "api.example.com"}},
+		{"example.com", []string{"example.com"}},
+		{"localhost", []string{"localhost"}},
+		{"127.0.0.1", []string{"127.0.0.1"}},
+		{"::1", []string{"::1"}},
+
+		// The wildcard never stands for a registrable domain
+		{"example.co.uk", []string{"example.co.uk"}},
+		{"www.example.co.uk", []string{"*.example.co.uk", "example.co.uk"}},
+		{"user.github.io", []string{"user.github.io"}},
+		{"www.user.github.io", []string{"*.user.github.io", "user.github.io"}},
+		{"db.internal", []string{"db.internal"}},
+	} {
+		if got := s.names(tc.host); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("names(%q) = %v, want %v", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestLeafVerifiesStrictly(t *testing.T) {
+	cm, err := NewCertManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cm.caCert)
+
+	for _, wildcard := range []bool{false, true} {
+		signer, err := newLeafSigner(cm.GetTLSCA(), wildcard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, host := range []string{"api.example.com", "example.co.uk", "www.example.co.uk", "user.github.io", "localhost", "127.0.0.1", "::1"} {
+			config, err := signer.tlsConfig(net.JoinHostPort(host, "443"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			clientConn, serverConn := net.Pipe()
+			go func() {
+				defer serverConn.Close()
+				tls.Server(serverConn, config).Handshake()
+			}()
+
+			client := tls.Client(clientConn, &tls.Config{RootCAs: pool, ServerName: host})
+			if err := client.Handshake(); err != nil {
+				t.Errorf("wildcard %v: handshake for %s: %v", wildcard, host, err)
+			}
+			client.Close()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/elazarl/goproxy"
+)
+
+const (
+	throttleRetryAfter = "1" // seconds clients should wait after a 503
+)
+
+// acquireSlot reserves one of the MaxConnections request slots for log,
+// releasing it once the entry is written or the client connection closes,
+// whichever comes first; goproxy never completes some intercepted requests,
+// such as websocket upgrades. It reports false when all slots are taken;
+// with no limit configured it always succeeds.
+func (p *Proxy) acquireSlot(log *RequestLog) bool {
+	release, ok := p.takeSlot(log.ConnectionID)
+	log.onWritten = release
+	return ok
+}
+
+// takeSlot reserves a request slot for a request on connection connID and
+// returns the function that frees it, which the connection closing also
+// calls. It reports false when all slots are taken.
+func (p *Proxy) takeSlot(connID uint64) (func(), bool) {
+	if p.slots == nil {
+		return nil, true
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return nil, false
+	}
+	release := sync.OnceFunc(func() { <-p.slots })
+	if closed := p.connClosed(connID); closed != nil {
+		stop := context.AfterFunc(closed, release)
+		return func() {
+			stop()
+			release()
+		}, true
+	}
+	return release, true
+}
+
+// uncapturedRequest is the context of a request proxied without capture,
+// holding the release of its request slot
+type uncapturedRequest struct {
+	release func()
+}
+
+// finish frees the request slot once resp has been sent, or right away when
+// there is no response
+func (u uncapturedRequest) finish(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		u.release()
+		return
+	}
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: u.release}
+}
+
+// releaseOnClose calls release when the body is closed
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close implements io.Closer
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// throttledResponse rejects a request that arrived while every slot was taken
+func throttledResponse(req *http.Request) *http.Response {
+	resp := goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusServiceUnavailable,
+		"flowspec-netlog: too many concurrent requests\n")
+	resp.Header.Set("Retry-After", throttleRetryAfter)
+	return resp
+}
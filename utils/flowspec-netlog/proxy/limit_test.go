@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxConnectionsOverLimit(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer upstream.Close()
+
+	_, client := newTestProxy(t, Options{MaxConnections: 2})
+
+	// Fill both slots with requests the upstream holds
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(upstream.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("request within the limit: status %d", resp.StatusCode)
+			}
+		}()
+		<-arrived
+	}
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit: status %d, want 503", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("request over the limit: no Retry-After header")
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+func TestMaxConnectionsReleasedOnClose(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	// A websocket target that refuses connections
+	refused, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := refused.Addr().String()
+	refused.Close()
+
+	p, addr := startTestProxy(t, Options{MaxConnections: 1, PairTimeout: time.Hour})
+
+	// goproxy never reports a result for an intercepted websocket upgrade,
+	// so the entry is never written; the slot must be freed when the
+	// client connection ends instead
+	conn := connectTLS(t, addr, target, &tls.Config{InsecureSkipVerify: true})
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", target)
+	conn.Read(make([]byte, 1)) // returns once the proxy gives up and closes
+	conn.Close()
+
+	proxyURL, _ := url.Parse("http://" + addr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status %d after the websocket connection closed, want 200", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The unwritten entry would hold up the drain for shutdownTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	p.close(ctx)
+}
+
+func TestMaxConnectionsCaptureDisabled(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hold" {
+			arrived <- struct{}{}
+			<-release
+		}
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{MaxConnections: 1})
+	// As after repeated panics in request capture
+	p.logger.breaker.features["request capture"] = &featurePanics{disabled: true}
+
+	done := make(chan int)
+	go func() {
+		resp, err := client.Get(upstream.URL + "/hold")
+		if err != nil {
+			t.Error(err)
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	<-arrived
+
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("uncaptured request over the limit: status %d, want 503", resp.StatusCode)
+	}
+
+	close(release)
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("uncaptured request within the limit: status %d", status)
+	}
+
+	// The slot is freed once the response is sent, even on a kept-alive
+	// connection
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d after the slot was freed: status %d", i, resp.StatusCode)
+		}
+	}
+	if entries := closeAndRead(t, p); len(entries) != 0 {
+		t.Errorf("got %d entries with capture disabled, want 0", len(entries))
+	}
+}
@@ -1,16 +1,13 @@
 package proxy
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,9 +15,28 @@ const (
 	maxBodySize = 1024 * 1024 // 1MB max body capture
 )
 
+// errLoggerClosed is returned for entries written after Close
+var errLoggerClosed = errors.New("log is closed")
+
+// CaptureHeader lets a client override body capture for a single request:
+// "bodies" forces capture, "none" suppresses it. It is never forwarded.
+const CaptureHeader = "X-Flowspec-Capture"
+
+// SourceHeader lets a client label its requests with the service or
+// container that made them, recorded as Source. It is never forwarded.
+const SourceHeader = "X-Flowspec-Source"
+
+// RequestLog write states; entries created by LogRequest are pending until written
+const (
+	entryUntracked int32 = iota
+	entryPending
+	entryWritten
+)
+
 // RequestLog represents a captured HTTP request/response
 type RequestLog struct {
 	Timestamp    string            `json:"timestamp"`
+	EndTimestamp string            `json:"end_timestamp,omitempty"`
 	Method       string            `json:"method"`
 	URL          string            `json:"url"`
 	Host         string            `json:"host"`
@@ -30,84 +46,379 @@ type RequestLog struct {
 	ResponseBody string            `json:"response_body,omitempty"`
 	Duration     int64             `json:"duration_ms,omitempty"`
 	Error        string            `json:"error,omitempty"`
+	ErrorKind    string            `json:"error_kind,omitempty"`
 	Bypassed     bool              `json:"bypassed,omitempty"`
+	Protocol     string            `json:"protocol,omitempty"`
+	Retries      int               `json:"retries,omitempty"`
+	Timings      *Timings          `json:"timings,omitempty"`
+	Mocked       bool              `json:"mocked,omitempty"`
+	Replayed     bool              `json:"replayed,omitempty"`
+
+	// Disposition is how the proxy routed the request: mitm, forward,
+	// tunnel, bypass, block, mock, replay, hook, or error. Bypassed, Mocked, and
+	// Replayed are derived from it for older consumers.
+	Disposition string `json:"disposition,omitempty"`
+
+	// ResponseHeaders holds the allowlisted headers of the response
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+
+	// ContentDisposition is the type of the response's Content-Disposition
+	// header, "attachment" or "inline", and Filename the name it suggests,
+	// decoded from filename*= when present and without any directory part
+	ContentDisposition string `json:"content_disposition,omitempty"`
+	Filename           string `json:"filename,omitempty"`
+
+	// Dropped counts the entries for this host not logged since the previous
+	// one because they exceeded FLOWSPEC_PER_HOST_RATE
+	Dropped int `json:"dropped,omitempty"`
+
+	// Incomplete marks a request whose response never arrived, written
+	// after FLOWSPEC_PAIR_TIMEOUT or at shutdown
+	Incomplete bool `json:"incomplete,omitempty"`
+
+	// Pause marks the entry written when capture resumes after a pause; it
+	// is not a request
+	Pause *PauseMarker `json:"pause,omitempty"`
+
+	// ProxyOverheadMs is the time the proxy spent on the request itself:
+	// capturing it before forwarding, then capturing and processing the
+	// response. It is not part of duration_ms, which times the upstream.
+	ProxyOverheadMs float64 `json:"proxy_overhead_ms,omitempty"`
+
+	// UnixSocket is the socket the request was forwarded over, for hosts
+	// mapped by FLOWSPEC_UNIX_UPSTREAMS
+	UnixSocket string `json:"unix_socket,omitempty"`
+
+	// SNI is the server name from the client's TLS ClientHello on a tunnel
+	// that was not intercepted, when FLOWSPEC_TUNNEL_SNI is set
+	SNI string `json:"sni,omitempty"`
+
+	// UserAgentFamily is the client library and version from the leading
+	// User-Agent product, e.g. "curl/8.4.0", or "unknown"
+	UserAgentFamily string `json:"user_agent_family,omitempty"`
+
+	// Tags are free-form labels set by an Options.OnResponseHook
+	Tags map[string]string `json:"tags,omitempty"`
+
+	// Source is the client's X-Flowspec-Source label, telling apart services
+	// that share the proxy
+	Source string `json:"source,omitempty"`
+
+	// ForwardedFor is the client chain from the Forwarded or X-Forwarded-For
+	// header set by proxies in front of this one, and OriginClientIP its
+	// leftmost address: the original client
+	ForwardedFor   []string `json:"forwarded_for,omitempty"`
+	OriginClientIP string   `json:"origin_client_ip,omitempty"`
+
+	// Via is the chain of proxies from the Via header as forwarded, ending
+	// with this one, e.g. ["1.1 corp-proxy", "1.1 flowspec-netlog"]
+	Via []string `json:"via,omitempty"`
+
+	// ReverseDNS is the name an IP-literal Host resolves back to, when
+	// FLOWSPEC_REVERSE_DNS is set and the lookup finished in time
+	ReverseDNS string `json:"reverse_dns,omitempty"`
+
+	// ResolvedIPs are the addresses DNS returned for the upstream host when
+	// a new connection was dialed; empty when a pooled connection was reused
+	ResolvedIPs []string `json:"resolved_ips,omitempty"`
+
+	// ConnectionID numbers the client connection the request arrived on, so
+	// requests sharing a keep-alive connection or HTTPS tunnel share it
+	ConnectionID uint64 `json:"connection_id,omitempty"`
+
+	// MatchedRule is the NO_PROXY or FLOWSPEC_MITM_HOSTS entry that decided
+	// whether the request was bypassed or intercepted
+	MatchedRule string `json:"matched_rule,omitempty"`
+
+	// ClientProtocol is the HTTP version of the client-to-proxy request (e.g.
+	// "HTTP/1.0", or "h2c" for cleartext HTTP/2), as opposed to Protocol,
+	// which was negotiated upstream
+	ClientProtocol string `json:"client_protocol,omitempty"`
+
+	// Scheme is the request URL's scheme, http or https. Intercepted is set
+	// for requests decrypted from an HTTPS tunnel, as opposed to https URLs
+	// a client sent to the proxy in cleartext.
+	Scheme      string `json:"scheme,omitempty"`
+	Intercepted bool   `json:"intercepted,omitempty"`
+
+	// Upstream TLS certificate; UpstreamCertVerified is false when
+	// verification is disabled with FLOWSPEC_VERIFY_UPSTREAM=false. MTLS is
+	// set when the proxy offered FLOWSPEC_UPSTREAM_CLIENT_CERT.
+	UpstreamCertVerified bool   `json:"upstream_cert_verified,omitempty"`
+	UpstreamCertSubject  string `json:"upstream_cert_subject,omitempty"`
+	UpstreamCertIssuer   string `json:"upstream_cert_issuer,omitempty"`
+	MTLS                 bool   `json:"mtls,omitempty"`
+
+	// FormFields replaces RequestBody for urlencoded form bodies; credential-like
+	// fields are redacted
+	FormFields map[string][]string `json:"form_fields,omitempty"`
+
+	// Parsed Cookie and Set-Cookie headers, values redacted
+	RequestCookies  []CookieLog `json:"request_cookies,omitempty"`
+	ResponseCookies []CookieLog `json:"response_cookies,omitempty"`
+
+	// Redirect hops followed by the same client share a ChainID; RedirectChain
+	// lists the URLs of the chain up to and including this request
+	ChainID       string   `json:"chain_id,omitempty"`
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+
+	// BodyCaptureError says why a body was forwarded without being captured,
+	// such as a sender too slow to read it within the capture timeout
+	BodyCaptureError string `json:"body_capture_error,omitempty"`
+
+	// ResponseTruncated is set when the upstream failed partway through the
+	// response body, with the reason in BodyReadError. The client got the
+	// bytes that arrived, and the captured body holds them.
+	ResponseTruncated bool   `json:"response_truncated,omitempty"`
+	BodyReadError     string `json:"body_read_error,omitempty"`
+
+	// RequestTruncated is set when the upstream stopped reading a streamed
+	// request body before its end; the captured body holds what was read
+	RequestTruncated bool `json:"request_truncated,omitempty"`
+
+	// Set instead of RequestBody/ResponseBody when a body exceeds the capture limit
+	RequestBodyOverflow  *BodyOverflow `json:"request_body_overflow,omitempty"`
+	ResponseBodyOverflow *BodyOverflow `json:"response_body_overflow,omitempty"`
+
+	// SHA-256 of the bodies as relayed, before any formatting, set with
+	// FLOWSPEC_BODY_HASH whether or not the bodies are stored
+	RequestBodyHash  string `json:"request_body_hash,omitempty"`
+	ResponseBodyHash string `json:"response_body_hash,omitempty"`
+
+	// Events holds the first Server-Sent Events of a text/event-stream response
+	Events []string `json:"events,omitempty"`
+
+	// ResponseBodyRef points to the deduplicated body file (relative to the log dir)
+	ResponseBodyRef string `json:"response_body_ref,omitempty"`
+
+	// Set instead of RequestBody/ResponseBody with FLOWSPEC_BODIES_DIR: the
+	// body file, relative to the log dir or absolute if outside it
+	RequestBodyFile  string `json:"request_body_file,omitempty"`
+	ResponseBodyFile string `json:"response_body_file,omitempty"`
+
+	// Tunnel fields are set for CONNECT tunnels that were not intercepted.
+	// BytesSent counts client-to-upstream bytes, BytesReceived upstream-to-client.
+	Tunnel        bool  `json:"tunnel,omitempty"`
+	BytesSent     int64 `json:"bytes_sent,omitempty"`
+	BytesReceived int64 `json:"bytes_received,omitempty"`
+
+	// gRPC fields are set for application/grpc calls. Frame sizes are the
+	// lengths of the length-prefixed messages; payloads are not decoded.
+	GRPCService        string `json:"grpc_service,omitempty"`
+	GRPCMethod         string `json:"grpc_method,omitempty"`
+	GRPCStatus         *int   `json:"grpc_status,omitempty"`
+	GRPCMessage        string `json:"grpc_message,omitempty"`
+	GRPCRequestFrames  []int  `json:"grpc_request_frames,omitempty"`
+	GRPCResponseFrames []int  `json:"grpc_response_frames,omitempty"`
+
+	// Cache is parsed from the response's Cache-Control, Expires, ETag, Age,
+	// and X-Cache headers, when it has any
+	Cache *CacheInfo `json:"cache,omitempty"`
+
+	// Unexported capture state, never serialized
+	requestTap *bodyTap
+	reqType    string // request Content-Type, whether captured or not
+	noise      bool   // matched FLOWSPEC_FILTER_NOISE, so not written
+	overhead   time.Duration
+	upstream   time.Time // when the upstream round trip started
+	grpc       *grpcCapture
+	state      int32
+	skipBodies bool
+	forced     bool // CaptureHeader asked for bodies
+	maxBody    int  // capture limit for the host, see FLOWSPEC_HOST_BODY_LIMITS
+	onWritten  func()
 }
 
 // Logger handles structured logging of HTTP traffic
 type Logger struct {
-	file     *os.File
-	encoder  *json.Encoder
-	logPath  string
-	noProxy  map[string]bool
-	maxBody  int
+	mu        sync.Mutex
+	sinks     []Sink
+	closed    bool
+	hosts     atomic.Pointer[hostRules]
+	maxBody   int
+	hostMax   hostBodyLimits
+	preview   int
+	tail      int // FLOWSPEC_BODY_TAIL_BYTES
+	bodyTypes []string
+	jsonBody  string
+	sseEvents int
+	noBodies  bool
+	errBodies bool // FLOWSPEC_BODIES_ON_ERROR_ONLY
+	recent    *recentBuffer
+	stats     *statsCounter
+	bodies    *bodyStore
+	bodyFiles *bodyStore
+	anon      *anonymizer
+	sampler   *hostSampler
+	noise     *noiseFilter
+	filtered  atomic.Int64 // entries dropped as noise
+	metaOnly  bool
+	hashes    bool
+	breaker   *panicBreaker
+	session   *SessionRecord
+	logDir    string
+	inflight  *inflightTracker
+	rotation  *rotator
+	disk      *diskWatcher
+	pairs     *pairTracker
+	rdns      *reverseDNS
+	onEntry   func(*RequestLog) // Options.OnResponseHook
+	pause     pauseState
+
+	summaryHosts int // hosts listed by the printed summary
+
+	// Header allowlists, see FLOWSPEC_REQUEST_HEADERS and FLOWSPEC_RESPONSE_HEADERS
+	requestHeaders  []string
+	responseHeaders []string
 }
 
 // NewLogger creates a new network logger
-func NewLogger(logDir string) (*Logger, error) {
-	timestamp := time.Now().Format("20060102-150405")
-	logPath := filepath.Join(logDir, fmt.Sprintf("network.%s.jsonl", timestamp))
+func NewLogger(opts Options) (*Logger, error) {
+	opts = opts.withDefaults().withMetadataOnly()
+	if err := checkSplitByHost(opts); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	timestamp := started.Format("20060102-150405")
+
+	l := &Logger{
+		maxBody:   maxBodySize,
+		hostMax:   opts.HostBodyLimits,
+		preview:   opts.BodyPreviewBytes,
+		tail:      opts.BodyTailBytes,
+		bodyTypes: opts.BodyContentTypes,
+		jsonBody:  opts.JSONBody,
+		sseEvents: opts.SSEEvents,
+		noBodies:  opts.NoBodies,
+		errBodies: opts.BodiesOnErrorOnly,
+		recent:    newRecentBuffer(opts.RecentBuffer),
+		stats:     newStatsCounter(),
+		logDir:    opts.LogDir,
+		inflight:  newInflightTracker(),
+		breaker:   newPanicBreaker(),
+		metaOnly:  opts.MetadataOnly,
+		hashes:    opts.BodyHashes,
+		onEntry:   opts.OnResponseHook,
+
+		summaryHosts: opts.SummaryHosts,
+
+		requestHeaders:  headerAllowlist(opts.RequestHeaders, defaultRequestHeaders),
+		responseHeaders: headerAllowlist(opts.ResponseHeaders, defaultResponseHeaders),
+
+		session: &SessionRecord{
+			Type:          sessionRecordType,
+			SchemaVersion: LogSchemaVersion,
+			Tags:          opts.SessionTags,
+			Started:       started.Format(time.RFC3339),
+			MetadataOnly:  opts.MetadataOnly,
+		},
+	}
 
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	rules, err := loadHostRules(opts.NoProxy, opts.MITMHosts, opts.HostsFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log file: %w", err)
+		return nil, err
+	}
+	l.hosts.Store(rules)
+
+	// In split mode entries go to per-host files instead of a combined log
+	if opts.SplitByHost {
+		l.sinks = append(l.sinks, newHostFiles(opts.LogDir, timestamp, l.session, opts.PrettyLog))
+	} else {
+		file, err := newFileSink(opts.LogDir, timestamp, l.session, opts.DiskBudget, opts.MaxLogFiles, opts.PrettyLog, opts.LogFormat, opts.AsyncWrites)
+		if err != nil {
+			return nil, err
+		}
+		if opts.AsyncWrites {
+			l.sinks = append(l.sinks, newAsyncFileSink(file, opts.WriteBuffer, opts.WriteBufferFull == writeBufferDrop))
+		} else {
+			l.sinks = append(l.sinks, file)
+		}
 	}
 
-	l := &Logger{
-		file:     file,
-		encoder:  json.NewEncoder(file),
-		logPath:  logPath,
-		noProxy:  parseNoProxy(),
-		maxBody:  maxBodySize,
+	if opts.Writer != nil {
+		writer, err := newWriterSink(opts.Writer, l.session, opts.PrettyLog)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.sinks = append(l.sinks, writer)
 	}
+	l.sinks = append(l.sinks, opts.Sinks...)
 
-	return l, nil
-}
+	if opts.BodiesDir != "" {
+		if l.bodyFiles, err = newBodyStore(opts.LogDir, opts.BodiesDir); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	if opts.DedupBodies {
+		if l.bodies, err = newBodyStore(opts.LogDir, ""); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
 
-// parseNoProxy parses the NO_PROXY environment variable
-func parseNoProxy() map[string]bool {
-	noProxy := make(map[string]bool)
-	envNoProxy := os.Getenv("NO_PROXY")
-	if envNoProxy == "" {
-		envNoProxy = os.Getenv("no_proxy")
+	if opts.Anonymize {
+		if l.anon, err = newAnonymizer(opts.AnonymizePatterns); err != nil {
+			l.Close()
+			return nil, err
+		}
 	}
 
-	if envNoProxy != "" {
-		for _, host := range strings.Split(envNoProxy, ",") {
-			host = strings.TrimSpace(host)
-			if host != "" {
-				noProxy[host] = true
-			}
+	if opts.WebhookURL != "" {
+		webhook, err := newWebhookNotifier(opts.WebhookURL, opts.WebhookRule)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("invalid webhook rule: %w", err)
 		}
+		l.sinks = append(l.sinks, webhook)
 	}
 
-	return noProxy
-}
+	if opts.PerHostRate > 0 {
+		l.sampler = newHostSampler(opts.PerHostRate)
+	}
 
-// ShouldBypass checks if a host should bypass the proxy
-func (l *Logger) ShouldBypass(host string) bool {
-	// Use net.SplitHostPort to properly handle both IPv4 and IPv6 addresses
-	// IPv6 addresses contain colons (e.g., "[::1]:8080") and need special handling
-	hostname, _, err := net.SplitHostPort(host)
-	if err == nil {
-		// SplitHostPort succeeded, use the hostname part
-		host = hostname
+	if opts.FilterNoise {
+		l.noise = newNoiseFilter(opts.NoisePaths, opts.NoiseUserAgents)
 	}
-	// If SplitHostPort fails, the host has no port, use as-is
 
-	// Check exact match
-	if l.noProxy[host] {
-		return true
+	if opts.RotateInterval > 0 {
+		l.rotation = startRotator(opts.RotateInterval, l.rotate)
 	}
 
-	// Check if host ends with any NO_PROXY entry (for wildcard domains)
-	// Note: Use exact match for the second condition to avoid matching "notexample.com" when NO_PROXY contains "example.com"
-	for noProxyHost := range l.noProxy {
-		if strings.HasSuffix(host, "."+noProxyHost) || host == noProxyHost {
-			return true
-		}
+	if opts.MinFreeDisk > 0 {
+		l.disk = startDiskWatcher(opts.LogDir, opts.MinFreeDisk)
+	}
+
+	if opts.ReverseDNS {
+		l.rdns = newReverseDNS()
+	}
+
+	if opts.PairTimeout > 0 {
+		l.pairs = startPairTracker(opts.PairTimeout, l.expire)
 	}
 
-	return false
+	return l, nil
+}
+
+// ShouldBypass checks if a host should bypass the proxy
+func (l *Logger) ShouldBypass(host string) bool {
+	_, ok := l.hostRules().bypass(host)
+	return ok
+}
+
+// ShouldIntercept checks if HTTPS traffic to a host should be decrypted.
+// When FLOWSPEC_MITM_HOSTS is unset every host is intercepted.
+func (l *Logger) ShouldIntercept(host string) bool {
+	_, ok := l.hostRules().intercept(host)
+	return ok
+}
+
+// hostRules returns the current host rules; callers making several decisions
+// for one request should use a single snapshot
+func (l *Logger) hostRules() *hostRules {
+	return l.hosts.Load()
 }
 
 // LogRequest logs an HTTP request
@@ -115,164 +426,574 @@ func (l *Logger) LogRequest(req *http.Request, startTime time.Time) *RequestLog
 	log := &RequestLog{
 		Timestamp: startTime.Format(time.RFC3339),
 		Method:    req.Method,
-		URL:       req.URL.String(),
+		URL:       l.capturedURL(req.URL.String()),
 		Host:      req.Host,
-		Headers:   make(map[string]string),
+		Scheme:    req.URL.Scheme,
+
+		ClientProtocol: clientProtocol(req),
 	}
+	// Start the lookup so the name is likely known when the entry is written
+	l.rdns.name(log.Host)
+	log.noise = l.noise != nil && l.noise.match(req)
+
+	// Honor and strip the per-request capture override
+	switch strings.ToLower(strings.TrimSpace(req.Header.Get(CaptureHeader))) {
+	case "bodies":
+		log.skipBodies = false
+		log.forced = true
+	case "none":
+		log.skipBodies = true
+	default:
+		log.skipBodies = l.noBodies
+	}
+	req.Header.Del(CaptureHeader)
+
+	log.Source = l.source(req)
+	req.Header.Del(SourceHeader)
 
-	// Capture headers (selective to avoid clutter)
-	importantHeaders := []string{
-		"Content-Type",
-		"Content-Length",
-		"User-Agent",
-		"Authorization",
-		"X-Request-ID",
-		"X-API-Key",
-		"Cookie",
+	// Metadata-only captures store no body whatever the request asks for,
+	// nor does a capture short of disk space
+	if l.metaOnly || l.disk.lowOnSpace() {
+		log.skipBodies = true
 	}
 
-	// Headers that contain sensitive credentials and should be redacted
-	sensitiveHeaders := map[string]bool{
-		"Authorization": true,
-		"X-API-Key":     true,
-		"Cookie":        true,
+	log.UserAgentFamily = userAgentFamily(req.UserAgent())
+	if !l.metaOnly {
+		log.ForwardedFor = forwardedChain(req.Header)
+		log.OriginClientIP = originClientIP(log.ForwardedFor)
+		log.Via = viaChain(req.Header)
 	}
 
-	for _, h := range importantHeaders {
-		if v := req.Header.Get(h); v != "" {
-			// Redact sensitive credentials to prevent exposure in logs
-			if sensitiveHeaders[h] {
-				log.Headers[h] = "[REDACTED]"
-			} else {
-				log.Headers[h] = v
-			}
-		}
+	log.Headers = captureHeaders(req.Header, l.requestHeaders)
+	if l.metaOnly {
+		redactHeaderValues(log.Headers)
 	}
+	log.reqType = req.Header.Get("Content-Type")
+
+	log.RequestCookies = logCookies(req.Cookies())
+	log.maxBody = l.hostMax.limit(canonicalAddr(req.Host, req.URL.Scheme), l.maxBody)
+	maxBody, preview := l.captureLimits(log)
 
 	// Capture request body if present and small enough
 	// Use <= to capture bodies up to and including the maxBody limit (1MB)
-	if req.Body != nil && req.ContentLength > 0 && req.ContentLength <= int64(l.maxBody) {
-		body, err := io.ReadAll(io.LimitReader(req.Body, int64(l.maxBody)))
+	if log.skipBodies {
+		// Forward the body untouched, hashing it as it streams if asked to
+		if l.hashes && req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0 {
+			log.requestTap = newBodyTap(req.Body, 0, 0, 0, nil)
+			req.Body = log.requestTap
+		}
+	} else if req.Body != nil && req.ContentLength > 0 && req.ContentLength <= int64(maxBody) {
+		// A slow sender gets the body forwarded as it arrives, uncaptured
+		body, restored, err := readBody(req.Body, int64(maxBody), bodyReadTimeout)
+		req.Body = restored
 		if err == nil {
-			log.RequestBody = string(body)
-			// Restore body for forwarding
-			req.Body = io.NopCloser(bytes.NewBuffer(body))
+			l.setRequestBody(log, body)
+			if l.hashes {
+				log.RequestBodyHash = bodyHash(body)
+			}
+		} else {
+			log.BodyCaptureError = "request body: " + err.Error()
+		}
+	} else if req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0 {
+		// Too large or of unknown length: keep a preview and hash (or the
+		// whole body if it turns out to fit) while it streams upstream
+		keep := preview
+		if req.ContentLength < 0 {
+			keep = maxBody
 		}
+		log.requestTap = newBodyTap(req.Body, keep, preview, l.tail, nil)
+		req.Body = log.requestTap
 	}
 
+	captureGRPCRequest(log, req)
+
+	// Track the entry last, so a panic above leaves nothing for the drain
+	// to wait on
+	log.state = entryPending
+	l.inflight.add()
 	return log
 }
 
-// LogResponse logs an HTTP response
+// setRequestBody stores a captured request body, as form fields for
+// urlencoded forms and otherwise as (formatted) text
+func (l *Logger) setRequestBody(log *RequestLog, body []byte) {
+	if isFormBody(log.reqType) {
+		if fields := parseFormFields(body); fields != nil {
+			log.FormFields = fields
+			return
+		}
+	}
+	log.RequestBody = formatBody(body, l.jsonBody)
+}
+
+// LogResponse logs an HTTP response. A response arriving after its entry
+// was written as incomplete is dropped.
 func (l *Logger) LogResponse(log *RequestLog, resp *http.Response, startTime time.Time) error {
+	if log.written() {
+		return nil
+	}
+	l.pairs.settle(log)
+	handled := time.Now()
 	log.StatusCode = resp.StatusCode
-	log.Duration = time.Since(startTime).Milliseconds()
+	if log.upstream.IsZero() {
+		// Synthesized responses are all proxy time
+		log.overhead += handled.Sub(startTime)
+	} else {
+		startTime = log.upstream
+	}
+	log.Duration = handled.Sub(startTime).Milliseconds()
+
+	// Keep the bodies of failed requests only, unless the client asked
+	if l.errBodies && resp.StatusCode < 400 && !log.forced {
+		log.skipBodies = true
+		log.RequestBody, log.FormFields = "", nil
+	}
+	log.ResponseHeaders = captureHeaders(resp.Header, l.responseHeaders)
+	log.ContentDisposition, log.Filename = parseContentDisposition(resp.Header.Get("Content-Disposition"))
+	log.Cache = parseCacheInfo(log.Method, resp)
+	if l.metaOnly {
+		redactHeaderValues(log.ResponseHeaders)
+		log.Filename = ""
+		if log.Cache != nil {
+			log.Cache.ETag, log.Cache.XCache = "", ""
+		}
+	}
+	log.Protocol = negotiatedProtocol(resp)
+	log.ResponseCookies = logCookies(resp.Cookies())
+	recordUpstreamCert(log, resp)
+	captureGRPCResponse(log, resp)
+
+	// Event streams may never end: record events as they are relayed and
+	// write the entry when the stream closes
+	maxBody, preview := l.captureLimits(log)
+	if !log.skipBodies && isEventStream(resp.Header.Get("Content-Type")) && resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = newSSETap(resp.Body, l.sseEvents, maxBody, func(events []string) {
+			log.Events = events
+			log.EndTimestamp = time.Now().Format(time.RFC3339)
+			l.Write(log)
+		})
+		log.overhead += time.Since(handled)
+		return nil
+	}
 
 	// Capture response body if present and small enough
 	// Use <= to capture bodies up to and including the maxBody limit (1MB)
-	if resp.Body != nil && resp.ContentLength > 0 && resp.ContentLength <= int64(l.maxBody) {
-		body, err := io.ReadAll(io.LimitReader(resp.Body, int64(l.maxBody)))
-		if err == nil {
-			// Only log text-based responses
-			contentType := resp.Header.Get("Content-Type")
-			if strings.Contains(contentType, "json") ||
-				strings.Contains(contentType, "text") ||
-				strings.Contains(contentType, "xml") {
-				log.ResponseBody = string(body)
+	// Only log allowed (by default text-based) responses
+	isText := !log.skipBodies && shouldCaptureBody(resp.Header.Get("Content-Type"), l.bodyTypes)
+
+	if resp.Body != nil && resp.ContentLength > 0 && resp.ContentLength <= int64(maxBody) {
+		body, restored, err := readBody(resp.Body, int64(maxBody), bodyReadTimeout)
+		resp.Body = restored
+		if errors.Is(err, errBodyTimeout) {
+			log.BodyCaptureError = "response body: " + err.Error()
+		} else {
+			if isText {
+				log.ResponseBody = formatBody(body, l.jsonBody)
 			}
-			// Restore body
-			resp.Body = io.NopCloser(bytes.NewBuffer(body))
+			if err != nil {
+				log.truncate(err)
+			} else if l.hashes {
+				log.ResponseBodyHash = bodyHash(body)
+			}
+		}
+	} else if resp.Body != nil && resp.Body != http.NoBody && resp.ContentLength != 0 {
+		// Too large or of unknown length: keep a preview and hash (or the
+		// whole body if it turns out to fit) while it streams to the client,
+		// and write the entry once the body has been fully relayed
+		keep := preview
+		if resp.ContentLength < 0 {
+			keep = maxBody
 		}
+		resp.Body = newBodyTap(resp.Body, keep, preview, l.tail, func(tap *bodyTap) {
+			body, overflow := tap.result(maxBody)
+			if body != nil && isText {
+				log.ResponseBody = formatBody(body, l.jsonBody)
+			}
+			if !log.skipBodies {
+				log.ResponseBodyOverflow = overflow
+			}
+			if l.hashes {
+				log.ResponseBodyHash = tap.sum()
+			}
+			if err := tap.readErr(); err != nil {
+				log.truncate(err)
+			}
+			finishGRPC(log, resp)
+			log.EndTimestamp = time.Now().Format(time.RFC3339)
+			l.Write(log)
+		})
+		log.overhead += time.Since(handled)
+		return nil
 	}
 
+	finishGRPC(log, resp)
+	log.EndTimestamp = time.Now().Format(time.RFC3339)
+	log.overhead += time.Since(handled)
 	return l.Write(log)
 }
 
-// LogError logs a request with an error
+// captureLimits returns the body capture limit for log's host and the
+// preview size, which never exceeds it
+func (l *Logger) captureLimits(log *RequestLog) (maxBody, preview int) {
+	maxBody = l.maxBody
+	if log.maxBody > 0 {
+		maxBody = log.maxBody
+	}
+	preview = l.preview
+	if preview > maxBody {
+		preview = maxBody
+	}
+	return maxBody, preview
+}
+
+// truncate records that the response body failed partway with err
+func (log *RequestLog) truncate(err error) {
+	log.ResponseTruncated = true
+	log.BodyReadError = err.Error()
+}
+
+// negotiatedProtocol returns the ALPN-style name of the upstream protocol
+func negotiatedProtocol(resp *http.Response) string {
+	switch {
+	case resp.ProtoMajor == 2:
+		return "h2"
+	case resp.ProtoMajor == 1 && resp.ProtoMinor == 0:
+		return "http/1.0"
+	case resp.ProtoMajor == 1:
+		return "http/1.1"
+	}
+	return resp.Proto
+}
+
+// startUpstream marks the start of the upstream round trip; the time since
+// the request arrived at startTime was spent by the proxy
+func (log *RequestLog) startUpstream(startTime time.Time) {
+	log.upstream = time.Now()
+	log.overhead += log.upstream.Sub(startTime)
+}
+
+// LogError logs a request with an error. An entry already written is left
+// alone, as a sink may be encoding it.
 func (l *Logger) LogError(log *RequestLog, err error) error {
+	if log.written() {
+		return nil
+	}
+	l.pairs.settle(log)
 	log.Error = err.Error()
+	log.EndTimestamp = time.Now().Format(time.RFC3339)
+	log.setDisposition(dispositionError)
 	return l.Write(log)
 }
 
-// LogBypassed logs a bypassed request
-func (l *Logger) LogBypassed(req *http.Request) error {
+// source returns the client's X-Flowspec-Source label, which metadata-only
+// captures leave out like other header values
+func (l *Logger) source(req *http.Request) string {
+	if l.metaOnly {
+		return ""
+	}
+	return strings.TrimSpace(req.Header.Get(SourceHeader))
+}
+
+// capturedURL returns raw as it is logged: metadata-only captures keep the
+// query keys but not their values, nor any userinfo
+func (l *Logger) capturedURL(raw string) string {
+	if l.metaOnly {
+		return redactURL(raw)
+	}
+	return raw
+}
+
+// LogBypassed logs a request bypassed by the NO_PROXY entry rule
+func (l *Logger) LogBypassed(req *http.Request, rule string) error {
 	log := &RequestLog{
-		Timestamp: time.Now().Format(time.RFC3339),
-		Method:    req.Method,
-		URL:       req.URL.String(),
-		Host:      req.Host,
-		Bypassed:  true,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Method:      req.Method,
+		URL:         l.capturedURL(req.URL.String()),
+		Host:        req.Host,
+		MatchedRule: rule,
+		Source:      l.source(req),
+
+		UserAgentFamily: userAgentFamily(req.UserAgent()),
 	}
+	log.setDisposition(dispositionBypass)
 	return l.Write(log)
 }
 
-// Write writes a log entry to the file
-func (l *Logger) Write(log *RequestLog) error {
-	return l.encoder.Encode(log)
+// LogForbidden logs a CONNECT to host rejected because the client address
+// is not allowed
+func (l *Logger) LogForbidden(req *http.Request, host string) error {
+	return l.logBlocked(req, host, host, "forbidden")
 }
 
-// Close closes the log file
-func (l *Logger) Close() error {
-	if l.file != nil {
-		return l.file.Close()
+// logBlocked logs a request refused with 403 before it was captured, with
+// kind as its error_kind
+func (l *Logger) logBlocked(req *http.Request, url, host, kind string) error {
+	log := &RequestLog{
+		Timestamp:      time.Now().Format(time.RFC3339),
+		Method:         req.Method,
+		URL:            l.capturedURL(url),
+		Host:           host,
+		StatusCode:     http.StatusForbidden,
+		ErrorKind:      kind,
+		Source:         l.source(req),
+		ClientProtocol: clientProtocol(req),
 	}
-	return nil
+	log.setDisposition(dispositionBlock)
+	return l.Write(log)
 }
 
-// GetLogPath returns the path to the log file
-func (l *Logger) GetLogPath() string {
-	return l.logPath
+// LogTunnel logs an opaque CONNECT tunnel that was not intercepted. rule is
+// the host rule that decided how the tunnel was handled, if any.
+func (l *Logger) LogTunnel(host string, startTime time.Time, sent, received int64, bypassed bool, rule string, err error) error {
+	return l.Write(tunnelLog(host, startTime, sent, received, bypassed, rule, err))
 }
 
-// Summary prints a summary of the log file
-func (l *Logger) Summary() error {
-	// Reopen file for reading
-	file, err := os.Open(l.logPath)
+// tunnelLog builds the entry LogTunnel writes
+func tunnelLog(host string, startTime time.Time, sent, received int64, bypassed bool, rule string, err error) *RequestLog {
+	log := &RequestLog{
+		Timestamp:     startTime.Format(time.RFC3339),
+		EndTimestamp:  time.Now().Format(time.RFC3339),
+		Method:        http.MethodConnect,
+		URL:           host,
+		Host:          host,
+		Duration:      time.Since(startTime).Milliseconds(),
+		Tunnel:        true,
+		BytesSent:     sent,
+		BytesReceived: received,
+		MatchedRule:   rule,
+	}
+	if bypassed {
+		log.setDisposition(dispositionBypass)
+	} else {
+		log.setDisposition(dispositionTunnel)
+	}
 	if err != nil {
-		return err
+		log.Error = err.Error()
 	}
-	defer file.Close()
+	return log
+}
 
-	var total, errors, bypassed, parseErrors int
-	methods := make(map[string]int)
-	hosts := make(map[string]int)
+// written reports whether an entry from LogRequest has been handed to the
+// sinks, after which it must not change
+func (log *RequestLog) written() bool {
+	return atomic.LoadInt32(&log.state) == entryWritten
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var log RequestLog
-		if err := json.Unmarshal(scanner.Bytes(), &log); err != nil {
-			// Log parse errors to alert users about malformed log entries
-			parseErrors++
-			continue
+// Write writes a log entry to the file. An entry from LogRequest is written
+// at most once; later calls for it are ignored.
+func (l *Logger) Write(log *RequestLog) error {
+	start := time.Now()
+	tracked := false
+	switch {
+	case atomic.CompareAndSwapInt32(&log.state, entryPending, entryWritten):
+		tracked = true
+		defer l.inflight.done()
+		if log.onWritten != nil {
+			defer log.onWritten()
 		}
+		l.pairs.settle(log)
+	case log.written():
+		return nil
+	}
 
-		total++
-		if log.Error != "" {
-			errors++
+	// Noise, requests over the per-host rate, and requests made while
+	// capture is paused were forwarded but are not logged
+	if l.pause.skip() {
+		return nil
+	}
+	if log.noise {
+		l.filtered.Add(1)
+		return nil
+	}
+	if l.sampler != nil && log.Pause == nil {
+		dropped, ok := l.sampler.allow(log.Host, time.Now())
+		if !ok {
+			return nil
 		}
-		if log.Bypassed {
-			bypassed++
+		log.Dropped = dropped
+	}
+	if log.ReverseDNS == "" {
+		log.ReverseDNS = l.rdns.name(log.Host)
+	}
+
+	// If body processing panics the entry is written without bodies, and
+	// without headers the anonymizer may not have scrubbed
+	if !l.breaker.guard("body processing", log.URL, func() { l.processBodies(log) }) {
+		log.RequestBody, log.ResponseBody = "", ""
+		log.FormFields, log.Events = nil, nil
+		log.RequestBodyOverflow, log.ResponseBodyOverflow = nil, nil
+		if l.anon != nil {
+			log.Headers, log.ResponseHeaders = nil, nil
 		}
-		methods[log.Method]++
-		hosts[log.Host]++
 	}
 
-	fmt.Println("\n=== Network Capture Summary ===")
-	fmt.Printf("Total requests: %d\n", total)
-	fmt.Printf("Errors: %d\n", errors)
-	fmt.Printf("Bypassed: %d\n", bypassed)
-	if parseErrors > 0 {
-		fmt.Printf("Parse errors: %d (malformed log entries)\n", parseErrors)
+	if l.onEntry != nil {
+		l.breaker.guard("response hook", log.URL, func() { l.onEntry(log) })
+	}
+
+	overheadMs := func() float64 {
+		return float64((log.overhead + time.Since(start)).Microseconds()) / 1000
+	}
+	if tracked {
+		log.ProxyOverheadMs = overheadMs()
+	}
+	if log.Pause == nil {
+		l.stats.add(log)
 	}
-	fmt.Println("\nRequests by method:")
-	for method, count := range methods {
-		fmt.Printf("  %s: %d\n", method, count)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return errLoggerClosed
 	}
-	fmt.Println("\nTop hosts:")
-	for host, count := range hosts {
-		fmt.Printf("  %s: %d\n", host, count)
+	l.recent.add(log)
+
+	var firstErr error
+	for i, sink := range l.sinks {
+		// Later sinks get their own copy stamped with the overhead so far,
+		// which includes the time spent in the sinks before them
+		entry := log
+		if tracked && i > 0 {
+			stamped := *log
+			stamped.ProxyOverheadMs = overheadMs()
+			entry = &stamped
+		}
+		l.breaker.guard(fmt.Sprintf("sink %T", sink), log.URL, func() {
+			if err := sink.Write(entry); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		})
 	}
-	fmt.Printf("\nLog file: %s\n", l.logPath)
+	return firstErr
+}
 
-	return scanner.Err()
+// processBodies finishes a captured request body, anonymizes the entry, and
+// moves a repeated response body to the shared body store
+func (l *Logger) processBodies(log *RequestLog) {
+	if log.requestTap != nil && !log.skipBodies {
+		maxBody, _ := l.captureLimits(log)
+		body, overflow := log.requestTap.result(maxBody)
+		if body != nil {
+			l.setRequestBody(log, body)
+		}
+		if overflow != nil && isFormBody(log.reqType) {
+			overflow.BodyPreview = redactFormPreview(overflow.BodyPreview)
+			overflow.BodyHead = redactFormPreview(overflow.BodyHead)
+			overflow.BodyTail = redactFormPreview(overflow.BodyTail)
+		}
+		log.RequestBodyOverflow = overflow
+	}
+	if log.requestTap != nil && errors.Is(log.requestTap.readErr(), errBodyClosedEarly) {
+		log.RequestTruncated = true
+	}
+	if log.requestTap != nil && l.hashes {
+		log.RequestBodyHash = log.requestTap.sum()
+	}
+
+	if l.anon != nil {
+		l.anon.apply(log)
+	}
+
+	// Move bodies out of the entry into FLOWSPEC_BODIES_DIR
+	if l.bodyFiles != nil {
+		for _, body := range []struct{ text, file *string }{
+			{&log.RequestBody, &log.RequestBodyFile},
+			{&log.ResponseBody, &log.ResponseBodyFile},
+		} {
+			if *body.text == "" {
+				continue
+			}
+			if ref, err := l.bodyFiles.store(*body.text); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			} else {
+				*body.file = ref
+				*body.text = ""
+			}
+		}
+		return
+	}
+
+	// Replace repeated response bodies with a reference to a shared file
+	if l.bodies != nil && log.ResponseBody != "" {
+		if ref, err := l.bodies.store(log.ResponseBody); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else {
+			log.ResponseBodyRef = ref
+			log.ResponseBody = ""
+		}
+	}
+}
+
+// Recent returns the most recently written entries matching filter, newest first
+func (l *Logger) Recent(filter func(*RequestLog) bool) []*RequestLog {
+	return l.recent.list(filter)
+}
+
+// Drain waits until every entry started by LogRequest has been written, or
+// ctx expires
+func (l *Logger) Drain(ctx context.Context) error {
+	return l.inflight.wait(ctx)
+}
+
+// Close closes every sink
+func (l *Logger) Close() error {
+	// Stop the rotation timer first; a rotation in progress needs l.mu
+	if l.rotation != nil {
+		l.rotation.stop()
+	}
+	if l.disk != nil {
+		l.disk.stop()
+	}
+	// Write the requests still waiting for a response
+	l.pairs.stop()
+	// Record a pause still in effect
+	l.Resume()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// GetLogPath returns the path to the active log file, or "" when split by host
+func (l *Logger) GetLogPath() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, sink := range l.sinks {
+		switch file := sink.(type) {
+		case *FileSink:
+			return file.Path()
+		case *asyncFileSink:
+			return file.Path()
+		}
+	}
+	return ""
+}
+
+// logFiles returns the files this session has written entries to, including
+// those closed by rotation
+func (l *Logger) logFiles() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var paths []string
+	for _, sink := range l.sinks {
+		if files, ok := sink.(filesSink); ok {
+			paths = append(paths, files.files()...)
+		}
+	}
+	return paths
 }
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// withMetadataOnly returns a copy of o that captures no bodies when
+// MetadataOnly is set. Options that would store payloads are overridden
+// with a warning naming them, rather than ignored silently.
+func (o Options) withMetadataOnly() Options {
+	if !o.MetadataOnly {
+		return o
+	}
+
+	var overridden []string
+	if !o.NoBodies {
+		overridden = append(overridden, "FLOWSPEC_CAPTURE_BODIES")
+	}
+	if o.BodiesDir != "" {
+		overridden = append(overridden, "FLOWSPEC_BODIES_DIR")
+		o.BodiesDir = ""
+	}
+	if o.DedupBodies {
+		overridden = append(overridden, "FLOWSPEC_DEDUP_BODIES")
+		o.DedupBodies = false
+	}
+	// A hash of a short body, such as a password, can be brute-forced
+	if o.BodyHashes {
+		overridden = append(overridden, "FLOWSPEC_BODY_HASH")
+		o.BodyHashes = false
+	}
+	// A cassette recording holds response bodies; replaying one is fine
+	if o.CassetteFile != "" && o.CassetteMode != cassetteReplay {
+		_, err := os.Stat(o.CassetteFile)
+		if o.CassetteMode == cassetteRecord || os.IsNotExist(err) {
+			overridden = append(overridden, "cassette recording")
+			o.CassetteFile, o.CassetteMode = "", ""
+		} else {
+			o.CassetteMode = cassetteReplay
+		}
+	}
+	if len(overridden) > 0 {
+		fmt.Printf("Warning: FLOWSPEC_METADATA_ONLY overrides %s\n", strings.Join(overridden, ", "))
+	}
+
+	o.NoBodies = true
+	return o
+}
+
+// redactHeaderValues replaces every captured header value, keeping which
+// headers were present
+func redactHeaderValues(headers map[string]string) {
+	for name := range headers {
+		headers[name] = "[REDACTED]"
+	}
+}
+
+// redactURL replaces the query values and userinfo of raw with [REDACTED],
+// keeping the query keys. The fragment, never sent by clients, is dropped.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		// Not a URL, such as a CONNECT host:port; keep nothing after a "?"
+		host, _, _ := strings.Cut(raw, "?")
+		return host
+	}
+
+	query := u.RawQuery
+	hasUser := u.User != nil
+	u.User, u.RawQuery, u.ForceQuery, u.Fragment, u.RawFragment = nil, "", false, "", ""
+	redacted := u.String()
+	if hasUser {
+		redacted = strings.Replace(redacted, "//", "//[REDACTED]@", 1)
+	}
+	if query != "" {
+		params := strings.Split(query, "&")
+		for i, param := range params {
+			if key, _, ok := strings.Cut(param, "="); ok {
+				params[i] = key + "=[REDACTED]"
+			}
+		}
+		redacted += "?" + strings.Join(params, "&")
+	}
+	return redacted
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mockRule is a canned response served for requests whose URL matches
+type mockRule struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// loadMocks reads a JSON array of mock rules. Each rule's url is a regular
+// expression matched against the full request URL; the first match wins.
+func loadMocks(path string) ([]*mockRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mocks file: %w", err)
+	}
+
+	var rules []*mockRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse mocks file: %w", err)
+	}
+
+	for i, rule := range rules {
+		if rule.URL == "" {
+			return nil, fmt.Errorf("mock %d: url pattern is required", i)
+		}
+		if rule.pattern, err = regexp.Compile(rule.URL); err != nil {
+			return nil, fmt.Errorf("mock %d: invalid url pattern: %w", i, err)
+		}
+		if rule.Status == 0 {
+			rule.Status = http.StatusOK
+		}
+	}
+	return rules, nil
+}
+
+// matchMock returns the first rule matching the request, or nil
+func matchMock(rules []*mockRule, req *http.Request) *mockRule {
+	url := req.URL.String()
+	for _, rule := range rules {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, req.Method) {
+			continue
+		}
+		if rule.pattern.MatchString(url) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// response builds the canned response for req
+func (m *mockRule) response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	for k, v := range m.Headers {
+		header.Set(k, v)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(m.Body)))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", m.Status, http.StatusText(m.Status)),
+		StatusCode:    m.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(m.Body)),
+		ContentLength: int64(len(m.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMockResponse(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer upstream.Close()
+
+	mocks := filepath.Join(t.TempDir(), "mocks.json")
+	rules := `[{"url":"/users/[0-9]+$","method":"GET","status":201,"headers":{"Content-Type":"application/json"},"body":"{\"id\":42}"}]`
+	if err := os.WriteFile(mocks, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, client := newTestProxy(t, Options{MocksFile: mocks})
+	resp, err := client.Get(upstream.URL + "/users/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusCreated || string(body) != `{"id":42}` {
+		t.Errorf("got %d %q, want the mock's 201 {\"id\":42}", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type %q, want the mock's application/json", resp.Header.Get("Content-Type"))
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("upstream called %d times for a mocked request", n)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if !entries[0].Mocked || entries[0].Disposition != dispositionMock || entries[0].ResponseBody != `{"id":42}` {
+		t.Errorf("entry mocked %v, disposition %q, body %q; want the mock", entries[0].Mocked, entries[0].Disposition, entries[0].ResponseBody)
+	}
+}
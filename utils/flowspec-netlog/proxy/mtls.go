@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// upstreamClientCert presents a client certificate to upstreams that
+// require mutual TLS, through its own transport so hosts outside its scope
+// never see the certificate
+type upstreamClientCert struct {
+	transport *http.Transport
+	hosts     *hostMatcher // nil for every host
+}
+
+// newUpstreamClientCert loads the client certificate and key into a copy of
+// base. hosts limits it to matching hosts, NO_PROXY style.
+func newUpstreamClientCert(base *http.Transport, certFile, keyFile string, hosts []string) (*upstreamClientCert, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("upstream client cert and key must be provided together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upstream client cert: %w", err)
+	}
+
+	transport := base.Clone()
+	transport.TLSClientConfig = base.TLSClientConfig.Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+	c := &upstreamClientCert{transport: transport}
+	if len(hosts) > 0 {
+		c.hosts = newHostMatcher(hosts)
+	}
+	return c, nil
+}
+
+// transportFor returns the transport to forward req with, and whether it
+// presents the client certificate
+func (p *Proxy) transportFor(req *http.Request) (*http.Transport, bool) {
+	c := p.clientCert
+	if c == nil || req.URL.Scheme != "https" {
+		return p.Tr, false
+	}
+	if c.hosts != nil {
+		if _, ok := c.hosts.match(canonicalAddr(req.URL.Host, req.URL.Scheme)); !ok {
+			return p.Tr, false
+		}
+	}
+	return c.transport, true
+}
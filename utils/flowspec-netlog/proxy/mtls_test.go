@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to dir
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "flowspec-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certPath, keyPath
+}
+
+func TestUpstreamClientCert(t *testing.T) {
+	cert, certPath, keyPath := writeClientCert(t, t.TempDir())
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name string
+		opts Options
+		ok   bool
+	}{
+		{"no cert", Options{}, false},
+		{"cert", Options{UpstreamClientCert: certPath, UpstreamClientKey: keyPath}, true},
+		{"cert for the host", Options{UpstreamClientCert: certPath, UpstreamClientKey: keyPath, UpstreamClientCertHosts: []string{"127.0.0.1"}}, true},
+		{"cert for other hosts", Options{UpstreamClientCert: certPath, UpstreamClientKey: keyPath, UpstreamClientCertHosts: []string{"internal.example.com"}}, false},
+	} {
+		tc.opts.InsecureUpstream = true
+		p, client := newTestProxy(t, tc.opts)
+		// Without a certificate the upstream rejects the handshake, which
+		// reaches the client as a 502 or a dropped connection
+		status := 0
+		if resp, err := skipVerify(client).Get(upstream.URL); err == nil {
+			resp.Body.Close()
+			status = resp.StatusCode
+		}
+		if ok := status == http.StatusOK; ok != tc.ok {
+			t.Errorf("%s: status %d, want success %v", tc.name, status, tc.ok)
+		}
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 1 {
+			t.Fatalf("%s: got %d entries, want 1", tc.name, len(entries))
+		}
+		entry := entries[0]
+		if entry.MTLS != tc.ok {
+			t.Errorf("%s: mtls = %v, want %v", tc.name, entry.MTLS, tc.ok)
+		}
+		if tc.ok == (entry.Error != "") {
+			t.Errorf("%s: error %q, want one only on failure", tc.name, entry.Error)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Built-in FLOWSPEC_FILTER_NOISE patterns: health checks, metric scrapes,
+// and favicons
+var (
+	defaultNoisePaths      = []string{"/healthz", "/livez", "/readyz", "/health", "/metrics", "/favicon.ico"}
+	defaultNoiseUserAgents = []string{"kube-probe", "Prometheus", "ELB-HealthChecker", "GoogleHC"}
+)
+
+// noiseFilter recognizes requests that are forwarded but not logged
+type noiseFilter struct {
+	paths      []string
+	userAgents []string // lowercased
+}
+
+// newNoiseFilter matches the given paths and user agents, each list
+// replacing the built-in one when set. The entry "default" stands for the
+// built-in list, so it can be extended rather than replaced.
+func newNoiseFilter(paths, userAgents []string) *noiseFilter {
+	f := &noiseFilter{paths: noisePatterns(paths, defaultNoisePaths)}
+	for _, agent := range noisePatterns(userAgents, defaultNoiseUserAgents) {
+		f.userAgents = append(f.userAgents, strings.ToLower(agent))
+	}
+	return f
+}
+
+// noisePatterns expands "default" in custom, or returns defaults when
+// custom is empty
+func noisePatterns(custom, defaults []string) []string {
+	if len(custom) == 0 {
+		return defaults
+	}
+	var patterns []string
+	for _, pattern := range custom {
+		if strings.EqualFold(pattern, "default") {
+			patterns = append(patterns, defaults...)
+		} else {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// match reports whether req is noise: its path is one of the paths or
+// below one, or its User-Agent contains one of the user agents
+func (f *noiseFilter) match(req *http.Request) bool {
+	path := req.URL.Path
+	for _, p := range f.paths {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	agent := strings.ToLower(req.UserAgent())
+	for _, a := range f.userAgents {
+		if agent != "" && strings.Contains(agent, a) {
+			return true
+		}
+	}
+	return false
+}
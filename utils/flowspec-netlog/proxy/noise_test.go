@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFilterNoise(t *testing.T) {
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{FilterNoise: true})
+	for _, tc := range []struct {
+		path, userAgent string
+	}{
+		{"/healthz", ""},
+		{"/healthz/deep", ""},
+		{"/api/users", "kube-probe/1.29"},
+		{"/api/users", ""},
+		{"/healthzz", ""},
+	} {
+		req, err := http.NewRequest("GET", upstream.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.userAgent != "" {
+			req.Header.Set("User-Agent", tc.userAgent)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", tc.path, resp.StatusCode)
+		}
+	}
+
+	// Every request reached the upstream, but only the last two were logged
+	if n := hits.Load(); n != 5 {
+		t.Errorf("upstream got %d requests, want 5", n)
+	}
+	entries := closeAndRead(t, p)
+	var urls []string
+	for _, entry := range entries {
+		urls = append(urls, entry.URL)
+	}
+	if len(urls) != 2 || urls[0] != upstream.URL+"/api/users" || urls[1] != upstream.URL+"/healthzz" {
+		t.Errorf("logged %v, want %s/api/users and %s/healthzz", urls, upstream.URL, upstream.URL)
+	}
+	if summary := p.Summary(); summary == nil || summary.NoiseFiltered != 3 {
+		t.Errorf("summary %+v, want 3 noise filtered", summary)
+	}
+}
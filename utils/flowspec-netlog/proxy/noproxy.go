@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+)
+
+// hostMatcher matches hosts against a NO_PROXY style list with the rules of
+// golang.org/x/net/http/httpproxy:
+//
+//   - "*" matches every host; empty entries are ignored
+//   - an IP address matches that address, and a CIDR range the addresses in it
+//   - "example.com" matches example.com and its subdomains, while
+//     ".example.com" and "*.example.com" match only the subdomains
+//   - an entry with a port ("example.com:8443", "[::1]:80") matches only that port
+//
+// Unlike httpproxy, domains are not converted to their punycode form.
+type hostMatcher struct {
+	all     string // the "*" entry, if present
+	ips     []ipEntry
+	domains []domainEntry
+}
+
+// ipEntry is an IP address or CIDR entry
+type ipEntry struct {
+	entry string
+	ip    net.IP
+	cidr  *net.IPNet
+	port  string
+}
+
+// domainEntry is a domain entry; suffix starts with a dot
+type domainEntry struct {
+	entry     string
+	suffix    string
+	port      string
+	matchHost bool // also matches the domain itself
+}
+
+// newHostMatcher compiles a host list
+func newHostMatcher(entries []string) *hostMatcher {
+	m := &hostMatcher{}
+	for _, entry := range entries {
+		p := strings.ToLower(strings.TrimSpace(entry))
+		if p == "" {
+			continue
+		}
+		if p == "*" {
+			m.all = entry
+			continue
+		}
+		if _, cidr, err := net.ParseCIDR(p); err == nil {
+			m.ips = append(m.ips, ipEntry{entry: entry, cidr: cidr})
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(p)
+		if err != nil {
+			host, port = p, ""
+		} else if host == "" {
+			continue // no host part; malformed
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if ip := net.ParseIP(host); ip != nil {
+			m.ips = append(m.ips, ipEntry{entry: entry, ip: ip, port: port})
+			continue
+		}
+
+		host = strings.TrimPrefix(host, "*")
+		matchHost := !strings.HasPrefix(host, ".")
+		if matchHost {
+			host = "." + host
+		}
+		if host == "." {
+			continue
+		}
+		m.domains = append(m.domains, domainEntry{entry: entry, suffix: host, port: port, matchHost: matchHost})
+	}
+	return m
+}
+
+// empty reports whether the list has no entries
+func (m *hostMatcher) empty() bool {
+	return m.all == "" && len(m.ips) == 0 && len(m.domains) == 0
+}
+
+// match returns the entry matching addr, a host with an optional port. When
+// several entries match, the most specific is returned: the longest domain
+// or narrowest IP range, then a port-specific entry over one for every port,
+// then the first in order; "*" only when nothing else matches.
+// Port-specific entries never match an addr without a port.
+func (m *hostMatcher) match(addr string) (string, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, ""
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+
+	best, bestScore := "", -1
+	consider := func(entry string, size int, entryPort string) {
+		score := size * 2
+		if entryPort != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, e := range m.ips {
+			if e.port != "" && e.port != port {
+				continue
+			}
+			switch {
+			case e.cidr != nil && e.cidr.Contains(ip):
+				ones, _ := e.cidr.Mask.Size()
+				consider(e.entry, ones, e.port)
+			case e.ip != nil && e.ip.Equal(ip):
+				consider(e.entry, 8*len(ip), e.port)
+			}
+		}
+	}
+
+	for _, e := range m.domains {
+		if e.port != "" && e.port != port {
+			continue
+		}
+		if !strings.HasSuffix(host, e.suffix) && !(e.matchHost && host == e.suffix[1:]) {
+			continue
+		}
+		consider(e.entry, len(e.suffix), e.port)
+	}
+
+	if bestScore < 0 && m.all != "" {
+		return m.all, true
+	}
+	return best, bestScore >= 0
+}
+
+// canonicalAddr adds the scheme's default port to a host without one, so
+// port-specific entries can match
+func canonicalAddr(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), port)
+}
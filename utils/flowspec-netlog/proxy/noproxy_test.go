@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestShouldBypassLiterals(t *testing.T) {
+	logger, err := NewLogger(Options{LogDir: t.TempDir(), NoProxy: []string{
+		"10.0.0.1",
+		"192.168.1.0/24",
+		"127.0.0.1:9000",
+		"::1",
+		"[2001:db8::5]:8443",
+		"fd00::/8",
+		"example.com",
+		".internal",
+		"api.test:8080",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		// IPv4 literals, with and without ports
+		{"10.0.0.1", true},
+		{"10.0.0.1:443", true},
+		{"10.0.0.2", false},
+		{"192.168.1.77:80", true},
+		{"192.168.2.1", false},
+		{"127.0.0.1:9000", true},
+		{"127.0.0.1:9001", false},
+		{"127.0.0.1", false},
+
+		// IPv6 literals, bracketed or not, with and without ports
+		{"::1", true},
+		{"[::1]", true},
+		{"[::1]:8080", true},
+		{"[0:0:0:0:0:0:0:1]:80", true},
+		{"[2001:db8::5]:8443", true},
+		{"[2001:db8::5]:443", false},
+		{"2001:db8::5", false},
+		{"[fd12::1]:443", true},
+		{"[fe80::1]:443", false},
+
+		// Domains match themselves and their subdomains; dotted entries only
+		// subdomains
+		{"example.com", true},
+		{"EXAMPLE.com:443", true},
+		{"api.example.com:8443", true},
+		{"notexample.com", false},
+		{"example.com.evil.net", false},
+		{"internal", false},
+		{"db.internal:5432", true},
+		{"api.test:8080", true},
+		{"api.test:80", false},
+		{"api.test", false},
+	} {
+		if got := logger.ShouldBypass(tc.addr); got != tc.want {
+			t.Errorf("ShouldBypass(%q) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestMatchMostSpecific(t *testing.T) {
+	m := newHostMatcher([]string{
+		"*",
+		"example.com",
+		"api.example.com",
+		".api.example.com",
+		"api.example.com:8443",
+		"10.0.0.0/8",
+		"10.1.0.0/16",
+		"10.1.2.3",
+		"10.1.2.3:8080",
+	})
+	for _, tc := range []struct {
+		addr string
+		want string
+	}{
+		{"www.example.com:443", "example.com"},
+		{"api.example.com:443", "api.example.com"},
+		{"v2.api.example.com:443", "api.example.com"},
+		{"api.example.com:8443", "api.example.com:8443"},
+		{"10.9.9.9:80", "10.0.0.0/8"},
+		{"10.1.9.9:80", "10.1.0.0/16"},
+		{"10.1.2.3:80", "10.1.2.3"},
+		{"10.1.2.3:8080", "10.1.2.3:8080"},
+		{"other.net:443", "*"},
+	} {
+		if got, ok := m.match(tc.addr); !ok || got != tc.want {
+			t.Errorf("match(%q) = %q, %v; want %q", tc.addr, got, ok, tc.want)
+		}
+	}
+}
+
+func TestMatchedRuleMostSpecific(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	host := strings.TrimPrefix(upstream.URL, "http://")
+
+	p, client := newTestProxy(t, Options{NoProxy: []string{"127.0.0.0/8", host, "127.0.0.1"}})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if got := entries[0].MatchedRule; got != host {
+		t.Errorf("matched rule = %q, want %q", got, host)
+	}
+}
+
+// httpproxyNoProxy is the NO_PROXY list from golang.org/x/net/http/httpproxy's
+// TestUseProxy
+const httpproxyNoProxy = "foobar.com, .barbaz.net, *.wildcard.io, 192.168.1.1, 192.168.1.2:81, 192.168.1.3:80, 10.0.0.0/30, 2001:db8::52:0:1, [2001:db8::52:0:2]:443, [2001:db8::52:0:3]:80, 2002:db8:a::45/64"
+
+func TestHostMatcherHTTPProxyParity(t *testing.T) {
+	// httpproxy's own cases; its "never proxy localhost" rule is left out
+	// since loopback traffic through this proxy is still captured
+	m := newHostMatcher(strings.Split(httpproxyNoProxy, ","))
+	for _, tc := range []struct {
+		host   string
+		bypass bool
+	}{
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"192.168.1.3", true},
+		{"192.168.1.4", false},
+		{"10.0.0.2", true},
+		{"[2001:db8::52:0:1]", true},
+		{"[2001:db8::52:0:2]", false},
+		{"[2001:db8::52:0:3]", true},
+		{"[2002:db8:a::123]", true},
+		{"[fe80::424b:c8be:1643:a1b6]", false},
+		{"barbaz.net", false},
+		{"www.barbaz.net", true},
+		{"foobar.com", true},
+		{"www.foobar.com", true},
+		{"foofoobar.com", false},
+		{"baz.com", false},
+		{"localhost.net", false},
+		{"local.localhost", false},
+		{"barbarbaz.net", false},
+		{"wildcard.io", false},
+		{"nested.wildcard.io", true},
+		{"awildcard.io", false},
+	} {
+		if _, got := m.match(canonicalAddr(tc.host, "http")); got != tc.bypass {
+			t.Errorf("match(http://%s) = %v, want %v", tc.host, got, tc.bypass)
+		}
+	}
+}
+
+func TestHostMatcherSchemes(t *testing.T) {
+	// httpproxy applies NO_PROXY the same way whether the proxy came from
+	// HTTP_PROXY, HTTPS_PROXY or ALL_PROXY; only the default port differs
+	for _, tc := range []struct {
+		noProxy string
+		url     string
+		bypass  bool
+	}{
+		{"", "http://example.com", false},
+		{"*", "http://example.com", true},
+		{"*", "https://example.com", true},
+		{" , ,", "http://example.com", false},
+		{"example.com", "http://example.com", true},
+		{"example.com", "https://foo.example.com", true},
+		{".example.com", "http://example.com", false},
+		{".example.com", "https://foo.example.com", true},
+		{"ample.com", "http://example.com", false},
+		{".foo.com", "https://example.com", false},
+		{"example.com:80", "http://example.com", true},
+		{"example.com:80", "https://example.com", false},
+		{"example.com:443", "https://example.com", true},
+		{"example.com:443", "http://example.com", false},
+		{"example.com:443", "http://example.com:443", true},
+		{"[::1]:443", "https://[::1]", true},
+		{"[::1]:443", "http://[::1]", false},
+		{"10.0.0.0/8", "https://10.2.3.4:8443", true},
+	} {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := newHostMatcher(strings.Split(tc.noProxy, ","))
+		if _, got := m.match(canonicalAddr(u.Host, u.Scheme)); got != tc.bypass {
+			t.Errorf("NO_PROXY=%q: match(%s) = %v, want %v", tc.noProxy, tc.url, got, tc.bypass)
+		}
+	}
+}
@@ -0,0 +1,455 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLogDir = ".logs"
+	defaultPort   = "8080"
+
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// Options configures a Proxy. The zero value of each field selects its default.
+type Options struct {
+	// LogDir holds log files and the CA certificate (default ".logs")
+	LogDir string
+	// Addr is the proxy listen address, e.g. ":8080" or "127.0.0.1:0"
+	Addr string
+	// Listener, if set, is served instead of listening on Addr
+	Listener net.Listener
+	// AdminAddr enables the admin endpoints on this address when set
+	AdminAddr string
+	// PrintCAInstructions prints CA installation instructions on startup
+	PrintCAInstructions bool
+	// CACertFile and CAKeyFile select an externally provided CA instead of
+	// the self-signed one generated in LogDir
+	CACertFile string
+	CAKeyFile  string
+	// CATempFallback generates a temporary CA for the run when the one in
+	// LogDir cannot be read or written for lack of permission
+	CATempFallback bool
+	// SessionTags are recorded in the session header of each log file and the summary
+	SessionTags map[string]string
+	// Writer, if set, receives every JSONL entry in addition to the log file
+	Writer io.Writer
+	// Sinks receive every entry in addition to the log file
+	Sinks []Sink
+	// OnRequestHook, if set, runs for each captured request before it is
+	// logged and forwarded; it may change the request. A non-nil response
+	// answers the client instead of the upstream.
+	OnRequestHook func(*http.Request) *http.Response
+	// OnResponseHook, if set, runs for each entry once it is complete, before
+	// it is written; it may change the entry, e.g. to add Tags
+	OnResponseHook func(*RequestLog)
+
+	// AllowCIDRs limits which client addresses may use the proxy; empty allows all
+	AllowCIDRs []*net.IPNet
+	// NoProxy lists hosts that are forwarded without logging
+	NoProxy []string
+	// MITMHosts limits HTTPS interception to these hosts; empty means all
+	MITMHosts []string
+	// HostsFile is a JSON file of extra no_proxy and mitm_hosts entries,
+	// re-read by Proxy.Reload
+	HostsFile string
+
+	// RecentBuffer is the size of the /recent ring buffer; negative disables it
+	RecentBuffer int
+	// NoBodies turns body capture off unless a request sends CaptureHeader: bodies
+	NoBodies bool
+	// BodiesOnErrorOnly keeps request and response bodies only for
+	// responses with status 400 or above
+	BodiesOnErrorOnly bool
+	// BodyPreviewBytes is the preview size kept for bodies over the capture limit
+	BodyPreviewBytes int
+	// HostBodyLimits overrides the 1MB body capture limit for the hosts (or
+	// host:port) it maps, higher or lower
+	HostBodyLimits map[string]int
+	// BodyTailBytes, if positive, also keeps that many bytes from the start
+	// and the end of bodies over the capture limit
+	BodyTailBytes int
+	// RequestHeaders and ResponseHeaders replace the default header allowlists
+	RequestHeaders  []string
+	ResponseHeaders []string
+	// BodyContentTypes replaces the default json/text/xml body capture filter
+	BodyContentTypes []string
+	// SSEEvents is the number of Server-Sent Events captured per stream
+	SSEEvents int
+	// JSONBody reformats logged JSON bodies: "pretty", "minify", or "raw" (default)
+	JSONBody string
+	// PrettyLog indents log records; files are then no longer one record per line
+	PrettyLog bool
+	// LogFormat is "jsonl" (the default) or "gob", a binary format that is
+	// faster to write; convert turns gob files back into JSONL
+	LogFormat string
+	// AsyncWrites queues entries for a background goroutine that writes the
+	// log file through a buffer, up to WriteBuffer entries (default 1024).
+	// WriteBufferFull says what a full queue does: "block" (the default)
+	// or "drop", counting the dropped entries.
+	AsyncWrites     bool
+	WriteBuffer     int
+	WriteBufferFull string
+	// Anonymize replaces emails, IPs, and tokens in bodies and headers with
+	// stable placeholders; AnonymizePatterns adds rules from a JSON file
+	Anonymize         bool
+	AnonymizePatterns string
+	// BodiesDir stores request and response bodies as files in this
+	// directory, referenced from the entry, instead of inline
+	BodiesDir string
+	// DedupBodies stores each distinct response body once under bodies/
+	DedupBodies bool
+	// BodyHashes records the SHA-256 of every body the proxy reads, whether
+	// or not the body itself is stored
+	BodyHashes bool
+	// MetadataOnly guarantees no body or header value is stored: body
+	// capture is off even when requested and header values are redacted,
+	// overriding any conflicting option
+	MetadataOnly bool
+	// SplitByHost writes each host's entries to its own network.<host>.<timestamp>.jsonl
+	SplitByHost bool
+	// RotateInterval starts a new log file at every interval boundary; zero disables rotation
+	RotateInterval time.Duration
+	// DiskBudget caps the combined size of log files in bytes; zero is unlimited
+	DiskBudget int64
+	// MaxLogFiles caps the number of log files kept besides the active one,
+	// whatever their size; zero is unlimited
+	MaxLogFiles int
+	// MinFreeDisk turns body capture off while the log directory's file
+	// system has fewer bytes free; zero never does
+	MinFreeDisk int64
+
+	// WebhookURL receives entries matching WebhookRule as JSON POSTs
+	WebhookURL  string
+	WebhookRule string
+
+	// DisableHTTP2 forces HTTP/1.1 to upstreams
+	DisableHTTP2 bool
+	// InsecureUpstream skips upstream certificate verification
+	InsecureUpstream bool
+	// UpstreamClientCert and UpstreamClientKey are a PEM client certificate
+	// presented to upstreams requiring mutual TLS; UpstreamClientCertHosts
+	// limits it to matching hosts (NO_PROXY syntax), otherwise every host
+	UpstreamClientCert      string
+	UpstreamClientKey       string
+	UpstreamClientCertHosts []string
+	// WildcardCerts issues one *.parent certificate to clients for all the
+	// intercepted hosts under a parent domain instead of one per host
+	WildcardCerts bool
+	// MaxConnections caps concurrent proxied requests; extra requests get a 503
+	MaxConnections int
+	// Timeouts on client connections, so slow clients cannot hold them open.
+	// ReadHeaderTimeout and IdleTimeout default to 10s and 2m; ReadTimeout
+	// and WriteTimeout are off, since they also cut long transfers and
+	// tunnels. Negative disables a timeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// PairTimeout is how long a request may wait for its response before
+	// its entry is written marked incomplete; default 10m, negative disables
+	PairTimeout time.Duration
+	// ReverseDNS records the name IP-literal hosts resolve back to, looked
+	// up in the background and cached
+	ReverseDNS bool
+	// TunnelSNI records the server name from the TLS ClientHello of tunnels
+	// that are not intercepted, without decrypting them
+	TunnelSNI bool
+	// UnixUpstreams maps hosts (optionally host:port) to unix sockets their
+	// requests are dialed on instead of TCP
+	UnixUpstreams map[string]string
+	// Upstream connection pool tuning; zero keeps the transport's default
+	MaxIdleConns    int
+	MaxConnsPerHost int
+	IdleConnTimeout time.Duration
+	// FilterNoise forwards health checks, metric scrapes, and favicon
+	// requests without logging them. NoisePaths and NoiseUserAgents replace
+	// the built-in patterns; the entry "default" includes them.
+	FilterNoise     bool
+	NoisePaths      []string
+	NoiseUserAgents []string
+
+	// PerHostRate caps logged entries per host per second; excess requests
+	// are forwarded but not logged. Zero is unlimited.
+	PerHostRate float64
+	// FailOn lists the conditions ("errors", "4xx", "5xx", "blocked") recorded
+	// in the summary's Failures; the command exits non-zero when any occurred
+	FailOn []string
+	// SummaryHosts is how many hosts the printed summary lists before
+	// rolling the rest up as others; zero lists 10
+	SummaryHosts int
+	// MaxAttempts is how many times an idempotent request is sent when the
+	// upstream fails transiently, counting the first try; 0 or 1 disables retries
+	MaxAttempts int
+	// MocksFile is a JSON file of canned responses
+	MocksFile string
+	// CassetteFile records upstream responses ("record") or serves them
+	// without contacting the upstream ("replay"). With no CassetteMode an
+	// existing file is replayed. Replay misses get a 504 unless
+	// CassettePassthrough forwards them.
+	CassetteFile        string
+	CassetteMode        string
+	CassettePassthrough bool
+}
+
+// withDefaults returns a copy of o with unset fields filled in
+func (o Options) withDefaults() Options {
+	if o.LogDir == "" {
+		o.LogDir = defaultLogDir
+	}
+	if o.Addr == "" {
+		o.Addr = ":" + defaultPort
+	}
+	if o.RecentBuffer == 0 {
+		o.RecentBuffer = defaultRecentBuffer
+	}
+	if o.BodyPreviewBytes == 0 {
+		o.BodyPreviewBytes = defaultBodyPreviewBytes
+	}
+	if o.SSEEvents == 0 {
+		o.SSEEvents = defaultSSEEvents
+	}
+	if o.ReadHeaderTimeout == 0 {
+		o.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = defaultIdleTimeout
+	}
+	if o.WriteBuffer == 0 {
+		o.WriteBuffer = defaultWriteBuffer
+	}
+	if o.PairTimeout == 0 {
+		o.PairTimeout = defaultPairTimeout
+	}
+	return o
+}
+
+// OptionsFromEnv builds Options from the FLOWSPEC_* environment variables
+func OptionsFromEnv() (Options, error) {
+	opts := Options{
+		LogDir:            os.Getenv("LOG_DIR"),
+		CACertFile:        os.Getenv("FLOWSPEC_CA_CERT"),
+		CAKeyFile:         os.Getenv("FLOWSPEC_CA_KEY"),
+		MITMHosts:         envList("FLOWSPEC_MITM_HOSTS"),
+		HostsFile:         os.Getenv("FLOWSPEC_HOSTS_FILE"),
+		BodyContentTypes:  envList("FLOWSPEC_BODY_CONTENT_TYPES"),
+		JSONBody:          os.Getenv("FLOWSPEC_JSON_BODY"),
+		PrettyLog:         envBool("FLOWSPEC_PRETTY_LOG"),
+		LogFormat:         os.Getenv("FLOWSPEC_LOG_FORMAT"),
+		AsyncWrites:       envBool("FLOWSPEC_ASYNC_WRITES"),
+		WriteBufferFull:   os.Getenv("FLOWSPEC_WRITE_BUFFER_FULL"),
+		Anonymize:         envBool("FLOWSPEC_ANONYMIZE"),
+		AnonymizePatterns: os.Getenv("FLOWSPEC_ANONYMIZE_PATTERNS"),
+		DedupBodies:       envBool("FLOWSPEC_DEDUP_BODIES"),
+		SplitByHost:       envBool("FLOWSPEC_SPLIT_BY_HOST"),
+		WebhookURL:        os.Getenv("FLOWSPEC_WEBHOOK_URL"),
+		WebhookRule:       os.Getenv("FLOWSPEC_WEBHOOK_ON"),
+		DisableHTTP2:      envBool("FLOWSPEC_DISABLE_H2"),
+		TunnelSNI:         envBool("FLOWSPEC_TUNNEL_SNI"),
+		ReverseDNS:        envBool("FLOWSPEC_REVERSE_DNS"),
+		MocksFile:         os.Getenv("FLOWSPEC_MOCKS"),
+		CassetteFile:      os.Getenv("FLOWSPEC_CASSETTE"),
+		CassetteMode:      os.Getenv("FLOWSPEC_CASSETTE_MODE"),
+	}
+
+	// Print CA instructions for interactive sessions unless configured explicitly
+	if value := os.Getenv("FLOWSPEC_PRINT_CA_INSTRUCTIONS"); value != "" {
+		opts.PrintCAInstructions = value == "true"
+	} else {
+		opts.PrintCAInstructions = isTerminal(os.Stdout)
+	}
+
+	opts.BodiesDir = os.Getenv("FLOWSPEC_BODIES_DIR")
+	opts.RequestHeaders = envList("FLOWSPEC_REQUEST_HEADERS")
+	opts.ResponseHeaders = envList("FLOWSPEC_RESPONSE_HEADERS")
+
+	// Body capture is on unless explicitly disabled
+	opts.NoBodies = os.Getenv("FLOWSPEC_CAPTURE_BODIES") == "false"
+	opts.BodiesOnErrorOnly = envBool("FLOWSPEC_BODIES_ON_ERROR_ONLY")
+
+	// Replay misses get a 504 unless they may reach the upstream
+	opts.CassettePassthrough = envBool("FLOWSPEC_CASSETTE_PASSTHROUGH")
+
+	// Upstream certificates are verified unless explicitly disabled
+	opts.InsecureUpstream = os.Getenv("FLOWSPEC_VERIFY_UPSTREAM") == "false"
+	opts.WildcardCerts = envBool("FLOWSPEC_WILDCARD_CERTS")
+	opts.UpstreamClientCert = os.Getenv("FLOWSPEC_UPSTREAM_CLIENT_CERT")
+	opts.UpstreamClientKey = os.Getenv("FLOWSPEC_UPSTREAM_CLIENT_KEY")
+	opts.UpstreamClientCertHosts = envList("FLOWSPEC_UPSTREAM_CLIENT_CERT_HOSTS")
+	opts.CATempFallback = envBool("FLOWSPEC_CA_TEMP_FALLBACK")
+	opts.MetadataOnly = envBool("FLOWSPEC_METADATA_ONLY")
+	// Metadata-only captures no bodies; only an explicit request for them
+	// is overridden with a warning
+	if opts.MetadataOnly && os.Getenv("FLOWSPEC_CAPTURE_BODIES") != "true" {
+		opts.NoBodies = true
+	}
+	opts.BodyHashes = envBool("FLOWSPEC_BODY_HASH")
+	opts.FilterNoise = envBool("FLOWSPEC_FILTER_NOISE")
+	opts.NoisePaths = envList("FLOWSPEC_NOISE_PATHS")
+	opts.NoiseUserAgents = envList("FLOWSPEC_NOISE_USER_AGENTS")
+
+	if port := os.Getenv("FLOWSPEC_NETLOG_PORT"); port != "" {
+		opts.Addr = ":" + port
+	}
+	if port := os.Getenv("FLOWSPEC_ADMIN_PORT"); port != "" {
+		opts.AdminAddr = "localhost:" + port
+	}
+
+	opts.NoProxy = envList("NO_PROXY")
+	if len(opts.NoProxy) == 0 {
+		opts.NoProxy = envList("no_proxy")
+	}
+
+	for _, n := range []struct {
+		name  string
+		def   int
+		value *int
+	}{
+		{"FLOWSPEC_RECENT_BUFFER", defaultRecentBuffer, &opts.RecentBuffer},
+		{"FLOWSPEC_BODY_PREVIEW_BYTES", defaultBodyPreviewBytes, &opts.BodyPreviewBytes},
+		{"FLOWSPEC_BODY_TAIL_BYTES", 0, &opts.BodyTailBytes},
+		{"FLOWSPEC_SSE_EVENTS", defaultSSEEvents, &opts.SSEEvents},
+		{"FLOWSPEC_WRITE_BUFFER", defaultWriteBuffer, &opts.WriteBuffer},
+		{"FLOWSPEC_MAX_CONNECTIONS", 0, &opts.MaxConnections},
+		{"FLOWSPEC_MAX_IDLE_CONNS", 0, &opts.MaxIdleConns},
+		{"FLOWSPEC_MAX_CONNS_PER_HOST", 0, &opts.MaxConnsPerHost},
+		{"FLOWSPEC_RETRY", 0, &opts.MaxAttempts},
+		{"FLOWSPEC_SUMMARY_HOSTS", summaryTopN, &opts.SummaryHosts},
+		{"FLOWSPEC_MAX_LOG_FILES", 0, &opts.MaxLogFiles},
+	} {
+		var err error
+		if *n.value, err = envInt(n.name, n.def); err != nil {
+			return opts, err
+		}
+	}
+
+	// An explicit 0 disables the recent buffer
+	if os.Getenv("FLOWSPEC_RECENT_BUFFER") == "0" {
+		opts.RecentBuffer = -1
+	}
+
+	if value := os.Getenv("FLOWSPEC_ROTATE_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return opts, fmt.Errorf("invalid FLOWSPEC_ROTATE_INTERVAL %q: want a positive duration such as 1h or 15m", value)
+		}
+		opts.RotateInterval = interval
+	}
+
+	if value := os.Getenv("FLOWSPEC_IDLE_CONN_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return opts, fmt.Errorf("invalid FLOWSPEC_IDLE_CONN_TIMEOUT %q: want a positive duration such as 90s", value)
+		}
+		opts.IdleConnTimeout = timeout
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"FLOWSPEC_READ_HEADER_TIMEOUT", &opts.ReadHeaderTimeout},
+		{"FLOWSPEC_READ_TIMEOUT", &opts.ReadTimeout},
+		{"FLOWSPEC_WRITE_TIMEOUT", &opts.WriteTimeout},
+		{"FLOWSPEC_IDLE_TIMEOUT", &opts.IdleTimeout},
+		{"FLOWSPEC_PAIR_TIMEOUT", &opts.PairTimeout},
+	} {
+		var err error
+		if *timeout.value, err = envTimeout(timeout.name); err != nil {
+			return opts, err
+		}
+	}
+
+	if value := os.Getenv("FLOWSPEC_DISK_BUDGET"); value != "" {
+		budget, err := parseSize(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid FLOWSPEC_DISK_BUDGET: %w", err)
+		}
+		opts.DiskBudget = budget
+	}
+
+	if value := os.Getenv("FLOWSPEC_MIN_FREE_DISK"); value != "" {
+		free, err := parseSize(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid FLOWSPEC_MIN_FREE_DISK: %w", err)
+		}
+		opts.MinFreeDisk = free
+	}
+
+	if value := os.Getenv("FLOWSPEC_PER_HOST_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return opts, fmt.Errorf("invalid FLOWSPEC_PER_HOST_RATE %q: want a positive number of requests per second", value)
+		}
+		opts.PerHostRate = rate
+	}
+
+	failOn, err := parseFailOn(envList("FLOWSPEC_FAIL_ON"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid FLOWSPEC_FAIL_ON: %w", err)
+	}
+	opts.FailOn = failOn
+
+	allow, err := parseCIDRs(envList("FLOWSPEC_ALLOW_CIDRS"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid FLOWSPEC_ALLOW_CIDRS: %w", err)
+	}
+	opts.AllowCIDRs = allow
+
+	bodyLimits, err := parseHostBodyLimits(envList("FLOWSPEC_HOST_BODY_LIMITS"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid FLOWSPEC_HOST_BODY_LIMITS: %w", err)
+	}
+	opts.HostBodyLimits = bodyLimits
+
+	unixUpstreams, err := parseUnixUpstreams(envList("FLOWSPEC_UNIX_UPSTREAMS"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid FLOWSPEC_UNIX_UPSTREAMS: %w", err)
+	}
+	opts.UnixUpstreams = unixUpstreams
+
+	tags, err := parseTags(envList("FLOWSPEC_SESSION_TAGS"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid FLOWSPEC_SESSION_TAGS: %w", err)
+	}
+	opts.SessionTags = tags
+
+	switch opts.JSONBody {
+	case "", jsonBodyRaw, jsonBodyPretty, jsonBodyMinify:
+	default:
+		return opts, fmt.Errorf("invalid FLOWSPEC_JSON_BODY %q: want pretty, minify, or raw", opts.JSONBody)
+	}
+
+	switch opts.LogFormat {
+	case "", logFormatJSONL, logFormatGob:
+	default:
+		return opts, fmt.Errorf("invalid FLOWSPEC_LOG_FORMAT %q: want jsonl or gob", opts.LogFormat)
+	}
+
+	switch opts.WriteBufferFull {
+	case "", writeBufferBlock, writeBufferDrop:
+	default:
+		return opts, fmt.Errorf("invalid FLOWSPEC_WRITE_BUFFER_FULL %q: want block or drop", opts.WriteBufferFull)
+	}
+
+	switch opts.CassetteMode {
+	case "", cassetteRecord, cassetteReplay:
+	default:
+		return opts, fmt.Errorf("invalid FLOWSPEC_CASSETTE_MODE %q: want record or replay", opts.CassetteMode)
+	}
+
+	return opts.withDefaults(), nil
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPairTimeout = 10 * time.Minute
+	pairCheckInterval  = 10 * time.Second
+)
+
+// pairTracker holds the forwarded entries that have no response yet.
+// goproxy skips the response handler when a client disconnects or a round
+// trip fails without an error reaching it, and those entries would never be
+// written; the reaper writes them, marked Incomplete, once they are older
+// than the timeout, and Close writes the rest. It writes the copy taken when
+// the request was forwarded, since the request's goroutine may still be
+// filling in the entry, and frees the entry's request slot and drain count;
+// a response or error arriving later is dropped.
+type pairTracker struct {
+	mu      sync.Mutex
+	pending map[*RequestLog]pendingPair
+	timeout time.Duration
+	expire  func(log, snapshot *RequestLog) // Logger.expire
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// pendingPair is a forwarded entry's request start and its copy as forwarded
+type pendingPair struct {
+	start    time.Time
+	snapshot *RequestLog
+}
+
+// startPairTracker starts the reaper, checking every pairCheckInterval or
+// more often for short timeouts
+func startPairTracker(timeout time.Duration, expire func(log, snapshot *RequestLog)) *pairTracker {
+	t := &pairTracker{
+		pending: make(map[*RequestLog]pendingPair),
+		timeout: timeout,
+		expire:  expire,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	interval := pairCheckInterval
+	if timeout/2 < interval {
+		interval = timeout / 2
+	}
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				t.reap(now.Add(-t.timeout))
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+// add tracks an entry waiting for its response. It must be called from the
+// request's goroutine before the round trip starts.
+func (t *pairTracker) add(log *RequestLog, start time.Time) {
+	if t == nil {
+		return
+	}
+	snapshot := log.incompleteCopy()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending[log] = pendingPair{start: start, snapshot: snapshot}
+}
+
+// settle stops tracking an entry whose response or error arrived
+func (t *pairTracker) settle(log *RequestLog) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, log)
+}
+
+// reap expires the entries started before cutoff
+func (t *pairTracker) reap(cutoff time.Time) {
+	t.mu.Lock()
+	orphans := make(map[*RequestLog]*RequestLog)
+	for log, pair := range t.pending {
+		if !pair.start.After(cutoff) {
+			delete(t.pending, log)
+			orphans[log] = pair.snapshot
+		}
+	}
+	t.mu.Unlock()
+
+	for log, snapshot := range orphans {
+		t.expire(log, snapshot)
+	}
+}
+
+// stop ends the reaper and writes every entry still waiting
+func (t *pairTracker) stop() {
+	if t == nil {
+		return
+	}
+	select {
+	case <-t.quit:
+		return
+	default:
+		close(t.quit)
+	}
+	<-t.done
+	t.reap(time.Now())
+}
+
+// incompleteCopy returns a copy of a forwarded entry to write if its
+// response never arrives. It shares nothing the writer changes in place
+// and is not tracked.
+func (log *RequestLog) incompleteCopy() *RequestLog {
+	c := *log
+	c.Incomplete = true
+	c.state = entryUntracked
+	c.onWritten = nil
+	c.requestTap, c.grpc = nil, nil
+	c.Headers = maps.Clone(log.Headers)
+	c.ForwardedFor = slices.Clone(log.ForwardedFor)
+	c.Via = slices.Clone(log.Via)
+	if log.FormFields != nil {
+		c.FormFields = make(map[string][]string, len(log.FormFields))
+		for name, values := range log.FormFields {
+			c.FormFields[name] = slices.Clone(values)
+		}
+	}
+	return &c
+}
+
+// expectResponse tracks a forwarded entry until its response or error
+// arrives, so it is written even if goproxy never reports one
+func (l *Logger) expectResponse(log *RequestLog, start time.Time) {
+	l.pairs.add(log, start)
+}
+
+// expire writes snapshot in place of an entry whose response never came,
+// then frees the entry's request slot and drain count. It claims the entry
+// as Write does, so a result arriving at the same time is written instead
+// and a later one is dropped.
+func (l *Logger) expire(log, snapshot *RequestLog) {
+	if !atomic.CompareAndSwapInt32(&log.state, entryPending, entryWritten) {
+		return
+	}
+	l.Write(snapshot)
+	l.inflight.done()
+	if log.onWritten != nil {
+		log.onWritten()
+	}
+}
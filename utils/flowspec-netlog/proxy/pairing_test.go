@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReapedEntryFreesSlot(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			arrived <- struct{}{}
+			<-release
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	p, client := newTestProxy(t, Options{MaxConnections: 1, PairTimeout: 20 * time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := client.Get(upstream.URL + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-arrived
+
+	// Wait for the reaper to write the slow request as incomplete
+	deadline := time.Now().Add(5 * time.Second)
+	for len(p.logger.Recent(func(log *RequestLog) bool { return log.Incomplete })) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("slow request never written as incomplete")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The slow request never settles, yet its slot and drain count are free
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.logger.Drain(ctx); err != nil {
+		t.Errorf("drain after reaping: %v", err)
+	}
+	resp, err := client.Get(upstream.URL + "/fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("request after reaping: status %d, want 200", resp.StatusCode)
+	}
+
+	// A late response is not logged again
+	release <- struct{}{}
+	<-done
+	slow := 0
+	for _, entry := range closeAndRead(t, p) {
+		if strings.HasSuffix(entry.URL, "/slow") {
+			slow++
+			if !entry.Incomplete || entry.StatusCode != 0 {
+				t.Errorf("slow entry: incomplete %v, status %d; want the incomplete copy",
+					entry.Incomplete, entry.StatusCode)
+			}
+		}
+	}
+	if slow != 1 {
+		t.Errorf("slow request logged %d times, want once", slow)
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PauseMarker is set on the entry written when capture resumes. That entry
+// is not a request: its timestamps span the paused period.
+type PauseMarker struct {
+	// Skipped counts the entries proxied but not logged while paused
+	Skipped int64 `json:"skipped"`
+}
+
+// pauseState tracks a pause of capture. While paused, traffic is proxied
+// but no entry is logged.
+type pauseState struct {
+	mu      sync.Mutex
+	paused  bool
+	since   time.Time
+	skipped int64
+}
+
+// skip reports whether capture is paused, counting the entry as skipped
+func (s *pauseState) skip() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		s.skipped++
+	}
+	return s.paused
+}
+
+// Pause stops logging entries until Resume. It reports whether capture was
+// running.
+func (l *Logger) Pause() bool {
+	l.pause.mu.Lock()
+	defer l.pause.mu.Unlock()
+
+	if l.pause.paused {
+		return false
+	}
+	l.pause.paused = true
+	l.pause.since = time.Now()
+	l.pause.skipped = 0
+	fmt.Println("Capture paused")
+	return true
+}
+
+// Resume restarts logging after Pause and writes a marker entry for the
+// paused period. It reports whether capture was paused.
+func (l *Logger) Resume() bool {
+	l.pause.mu.Lock()
+	if !l.pause.paused {
+		l.pause.mu.Unlock()
+		return false
+	}
+	l.pause.paused = false
+	since, skipped := l.pause.since, l.pause.skipped
+	l.pause.mu.Unlock()
+
+	fmt.Printf("Capture resumed (%d entries skipped)\n", skipped)
+	l.Write(&RequestLog{
+		Timestamp:    since.Format(time.RFC3339),
+		EndTimestamp: time.Now().Format(time.RFC3339),
+		Duration:     time.Since(since).Milliseconds(),
+		Pause:        &PauseMarker{Skipped: skipped},
+	})
+	return true
+}
+
+// Paused reports whether capture is paused
+func (l *Logger) Paused() bool {
+	l.pause.mu.Lock()
+	defer l.pause.mu.Unlock()
+	return l.pause.paused
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPauseMarkerBeforeSummary(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	// Close ends a pause still in effect; its marker must reach the summary
+	p, client := newTestProxy(t, Options{})
+	p.logger.Pause()
+	const skipped = 3
+	for i := 0; i < skipped; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	summary := p.Summary()
+	if summary == nil {
+		t.Fatal("no summary after close")
+	}
+	if summary.PausedSkipped != skipped {
+		t.Errorf("summary paused_skipped = %d, want %d", summary.PausedSkipped, skipped)
+	}
+}
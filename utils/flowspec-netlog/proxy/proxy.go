@@ -1,8 +1,17 @@
 package proxy
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"fmt"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/elazarl/goproxy"
@@ -11,21 +20,69 @@ import (
 // Proxy wraps goproxy with logging capabilities
 type Proxy struct {
 	*goproxy.ProxyHttpServer
-	logger  *Logger
-	certMgr *CertManager
+	opts        Options
+	logger      *Logger
+	certMgr     *CertManager
+	mitm        *goproxy.ConnectAction
+	maxAttempts int
+	mocks       []*mockRule
+	redirects   *redirectTracker
+	slots       chan struct{}
+	cassette    *cassette
+	clientCert  *upstreamClientCert
+	unix        unixUpstreams
+	connIDs     atomic.Uint64
+	conns       sync.Map                  // connectionID -> context done when it closes
+	self        atomic.Pointer[selfAddrs] // the listeners, updated by Start
+
+	mu            sync.Mutex
+	server        *http.Server
+	adminServer   *http.Server
+	listener      net.Listener
+	adminListener net.Listener
+	stopped       bool
+	closeOnce     sync.Once
+	closeErr      error
+	summary       *SessionSummary
+}
+
+// requestContext carries per-request state from the request handler to the
+// response handler via goproxy's ctx.UserData
+type requestContext struct {
+	log         *RequestLog
+	startTime   time.Time
+	trace       *requestTrace
+	cassetteKey string
+	finished    atomic.Bool
+}
+
+// finish claims the entry for whichever of the response handler and the
+// round-trip error hook completes it first, and reports false to the other.
+// goproxy runs the response handler after a failed plain HTTP round trip
+// but not after a failed intercepted one, so both must try.
+func (data *requestContext) finish() bool {
+	return data.finished.CompareAndSwap(false, true)
 }
 
 // NewProxy creates a new logging proxy server
-func NewProxy(logDir string) (*Proxy, error) {
+func NewProxy(opts Options) (*Proxy, error) {
+	opts = opts.withDefaults().withMetadataOnly()
+
+	// Create log directory if it doesn't exist
+	if err := os.MkdirAll(opts.LogDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
 	// Create logger
-	logger, err := NewLogger(logDir)
+	logger, err := NewLogger(opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create logger: %w", err)
 	}
 
 	// Create certificate manager
-	certMgr, err := NewCertManager(logDir)
+	certMgr, err := NewCertManagerFromOptions(opts)
 	if err != nil {
+		logger.Close()
 		return nil, fmt.Errorf("failed to create cert manager: %w", err)
 	}
 
@@ -33,48 +90,245 @@ func NewProxy(logDir string) (*Proxy, error) {
 	proxy := goproxy.NewProxyHttpServer()
 	proxy.Verbose = false // Disable goproxy's own logging
 
-	// Set up HTTPS handling
-	ca := certMgr.GetTLSCA()
-	if ca != nil {
-		goproxy.GoproxyCa = *ca
-		proxy.OnRequest().HandleConnect(goproxy.AlwaysMitm)
+	// Verify upstream certificates unless explicitly disabled
+	proxy.Tr.TLSClientConfig = upstreamTLSConfig(opts.InsecureUpstream)
+
+	// goproxy sets a custom TLS config, which disables Go's automatic HTTP/2
+	// upgrade; opt back in so upstreams see the protocol real clients would use
+	if opts.DisableHTTP2 {
+		proxy.Tr.ForceAttemptHTTP2 = false
+		proxy.Tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else {
+		proxy.Tr.ForceAttemptHTTP2 = true
+	}
+
+	// Size the upstream connection pool
+	if opts.MaxIdleConns > 0 {
+		proxy.Tr.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxConnsPerHost > 0 {
+		proxy.Tr.MaxConnsPerHost = opts.MaxConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		proxy.Tr.IdleConnTimeout = opts.IdleConnTimeout
+	}
+
+	// Reach hosts served on unix sockets
+	unix := unixUpstreams(opts.UnixUpstreams)
+	if len(unix) > 0 {
+		unix.route(proxy.Tr)
 	}
 
 	p := &Proxy{
 		ProxyHttpServer: proxy,
+		opts:            opts,
 		logger:          logger,
 		certMgr:         certMgr,
+		maxAttempts:     opts.MaxAttempts,
+		redirects:       newRedirectTracker(),
+		unix:            unix,
+	}
+	p.self.Store(newSelfAddrs(opts.Addr, opts.AdminAddr))
+	if opts.MaxConnections > 0 {
+		p.slots = make(chan struct{}, opts.MaxConnections)
+	}
+
+	// Present a client certificate to upstreams that require mutual TLS
+	if opts.UpstreamClientCert != "" || opts.UpstreamClientKey != "" {
+		p.clientCert, err = newUpstreamClientCert(proxy.Tr, opts.UpstreamClientCert, opts.UpstreamClientKey, opts.UpstreamClientCertHosts)
+		if err != nil {
+			logger.Close()
+			return nil, err
+		}
+	}
+
+	// Set up HTTPS handling with this proxy's CA (not goproxy's global one)
+	// so several proxies can run in one process
+	ca := certMgr.GetTLSCA()
+	if ca != nil {
+		signer, err := newLeafSigner(ca, opts.WildcardCerts)
+		if err != nil {
+			logger.Close()
+			return nil, err
+		}
+		p.mitm = &goproxy.ConnectAction{
+			Action:    goproxy.ConnectMitm,
+			TLSConfig: signer.tlsConfig,
+		}
+	}
+
+	// Load canned responses for offline testing
+	if opts.MocksFile != "" {
+		if p.mocks, err = loadMocks(opts.MocksFile); err != nil {
+			logger.Close()
+			return nil, err
+		}
+		fmt.Printf("Loaded %d mock(s) from %s\n", len(p.mocks), opts.MocksFile)
+	}
+
+	// Record or replay upstream responses
+	if opts.CassetteFile != "" {
+		if p.cassette, err = openCassette(opts.CassetteFile, opts.CassetteMode, opts.CassettePassthrough); err != nil {
+			logger.Close()
+			return nil, err
+		}
+		if p.cassette.mode == cassetteReplay {
+			fmt.Printf("Replaying %d response(s) from %s\n", len(p.cassette.entries), opts.CassetteFile)
+		} else {
+			fmt.Printf("Recording responses to %s\n", opts.CassetteFile)
+		}
 	}
 
 	// Set up request/response handlers
 	p.setupHandlers()
 
 	// Print CA installation instructions
-	certMgr.PrintInstallInstructions()
+	if opts.PrintCAInstructions {
+		certMgr.PrintInstallInstructions()
+	}
 
 	return p, nil
 }
 
 // setupHandlers configures the proxy request/response handlers
 func (p *Proxy) setupHandlers() {
+	// Decide per CONNECT whether to intercept or tunnel
+	p.OnRequest().HandleConnectFunc(p.handleConnect)
+
 	// Handle all requests
 	p.OnRequest().DoFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
+		// Never forward to the proxy's own listeners
+		if p.self.Load().matches(canonicalAddr(req.Host, req.URL.Scheme)) {
+			req.Header.Del(CaptureHeader)
+			p.logger.logBlocked(req, req.URL.String(), req.Host, "self_reference")
+			req.Header.Del(SourceHeader)
+			return req, selfReferenceResponse(req)
+		}
+
+		// Join the Via chain before anything sees the request, so the
+		// capture records the header as forwarded
+		appendVia(req)
+
 		// Check if request should be bypassed
-		if p.logger.ShouldBypass(req.Host) {
-			p.logger.LogBypassed(req)
+		rules := p.logger.hostRules()
+		allowed := p.clientAllowed(req.RemoteAddr)
+		if rule, bypassed := rules.bypass(canonicalAddr(req.Host, req.URL.Scheme)); bypassed && allowed {
+			req.Header.Del(CaptureHeader)
+			p.logger.LogBypassed(req, rule)
+			req.Header.Del(SourceHeader)
 			return req, nil
 		}
 
-		// Log request
+		// The embedder's hook sees the request before it is captured, so
+		// changes to it are logged
 		startTime := time.Now()
-		ctx.UserData = &struct {
-			log       *RequestLog
-			startTime time.Time
-		}{
-			log:       p.logger.LogRequest(req, startTime),
+		var hookResp *http.Response
+		if p.opts.OnRequestHook != nil && allowed {
+			p.logger.breaker.guard("request hook", req.URL.String(), func() {
+				hookResp = p.opts.OnRequestHook(req)
+			})
+		}
+
+		// Log request. Once request capture has been disabled by repeated
+		// panics, requests are proxied without being logged.
+		var log *RequestLog
+		p.logger.breaker.guard("request capture", req.URL.String(), func() {
+			log = p.logger.LogRequest(req, startTime)
+		})
+		if log == nil {
+			if !allowed {
+				return req, forbiddenResponse(req)
+			}
+			if hookResp != nil {
+				return req, hookResp
+			}
+			// Uncaptured requests still count against MaxConnections
+			release, ok := p.takeSlot(requestConnID(req, ctx))
+			if !ok {
+				return req, throttledResponse(req)
+			}
+			if release != nil {
+				ctx.UserData = uncapturedRequest{release: release}
+			}
+			return req, nil
+		}
+		data := &requestContext{
+			log:       log,
 			startTime: startTime,
+			trace:     newRequestTrace(startTime),
+		}
+		data.log.ConnectionID = requestConnID(req, ctx)
+		_, data.log.Intercepted = ctx.UserData.(connectionID)
+		ctx.UserData = data
+		p.redirects.link(data.log, req)
+
+		// Only clients from FLOWSPEC_ALLOW_CIDRS may use the proxy
+		if !allowed {
+			data.log.ErrorKind = "forbidden"
+			data.log.setDisposition(dispositionBlock)
+			return req, forbiddenResponse(req)
+		}
+
+		// Record the MITM hosts entry that let an HTTPS request be decrypted
+		if req.URL.Scheme == "https" {
+			data.log.MatchedRule, _ = rules.intercept(canonicalAddr(req.Host, req.URL.Scheme))
 		}
 
+		if hookResp != nil {
+			data.log.setDisposition(dispositionHook)
+			return req, hookResp
+		}
+
+		// Serve canned responses without contacting the upstream
+		if mock := matchMock(p.mocks, req); mock != nil {
+			data.log.setDisposition(dispositionMock)
+			return req, mock.response(req)
+		}
+
+		// Serve recorded responses, or note the key to record this one under
+		if p.cassette != nil {
+			data.cassetteKey, _ = cassetteKey(req, p.logger.maxBody)
+			if p.cassette.mode == cassetteReplay {
+				if resp := p.cassette.replay(data.cassetteKey, req); resp != nil {
+					data.log.setDisposition(dispositionReplay)
+					return req, resp
+				}
+				if !p.cassette.passthrough {
+					data.log.ErrorKind = "cassette_miss"
+					data.log.setDisposition(dispositionError)
+					return req, missResponse(req)
+				}
+			}
+		}
+
+		// Shed load once MaxConnections requests are in flight
+		if !p.acquireSlot(data.log) {
+			data.log.ErrorKind = "throttled"
+			data.log.setDisposition(dispositionBlock)
+			return req, throttledResponse(req)
+		}
+
+		if req.URL.Scheme == "https" {
+			data.log.setDisposition(dispositionMITM)
+		} else {
+			data.log.setDisposition(dispositionForward)
+		}
+
+		// Trace the upstream round trip for the timing breakdown
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), data.trace.clientTrace()))
+
+		// Retry transient upstream failures for idempotent requests
+		tr, mtls := p.transportFor(req)
+		data.log.MTLS = mtls
+		var rt goproxy.RoundTripper = goproxy.RoundTripperFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Response, error) {
+			return tr.RoundTrip(req)
+		})
+		if p.maxAttempts > 1 && isIdempotent(req.Method) {
+			rt = p.retryRoundTripper(data.log, tr)
+		}
+		ctx.RoundTripper = p.logRoundTripErrors(data, rt)
+		p.logger.expectResponse(data.log, startTime)
+
 		return req, nil
 	})
 
@@ -84,20 +338,38 @@ func (p *Proxy) setupHandlers() {
 		if ctx.UserData == nil {
 			return resp
 		}
+		if uncaptured, ok := ctx.UserData.(uncapturedRequest); ok {
+			uncaptured.finish(resp)
+			return resp
+		}
 
 		// Safe type assertion to prevent panic if UserData is unexpected type
-		data, ok := ctx.UserData.(*struct {
-			log       *RequestLog
-			startTime time.Time
-		})
+		data, ok := ctx.UserData.(*requestContext)
 		if !ok {
 			// UserData is not the expected type, skip logging
 			return resp
 		}
+		// The round-trip error hook already logged a failed request
+		if !data.finish() {
+			return resp
+		}
 
 		// Log response
+		if !data.log.Mocked && !data.log.Replayed && data.log.Disposition != dispositionHook {
+			data.trace.record(data.log)
+		}
 		if resp != nil {
-			p.logger.LogResponse(data.log, resp, data.startTime)
+			p.redirects.record(data.log, ctx.Req, resp)
+			// Write what was captured if response capture panics
+			if !p.logger.breaker.guard("response capture", data.log.URL, func() {
+				p.logger.LogResponse(data.log, resp, data.startTime)
+			}) {
+				data.log.StatusCode = resp.StatusCode
+				p.logger.Write(data.log)
+			}
+			if p.shouldRecord(data, resp) {
+				p.cassette.record(data.cassetteKey, ctx.Req, resp)
+			}
 		} else if ctx.Error != nil {
 			p.logger.LogError(data.log, ctx.Error)
 		}
@@ -106,14 +378,112 @@ func (p *Proxy) setupHandlers() {
 	})
 }
 
-// Close closes the proxy and its resources
+// shouldRecord reports whether resp is an upstream response to save to the
+// cassette. Canned, synthesized, and streaming responses are not recorded.
+func (p *Proxy) shouldRecord(data *requestContext, resp *http.Response) bool {
+	return p.cassette != nil && p.cassette.mode == cassetteRecord &&
+		data.cassetteKey != "" && !data.log.Mocked && data.log.Disposition != dispositionHook &&
+		data.log.Error == "" && data.log.ErrorKind == "" &&
+		!isEventStream(resp.Header.Get("Content-Type"))
+}
+
+// logRoundTripErrors logs upstream failures as soon as they happen. goproxy
+// skips the response handlers when an intercepted HTTPS round trip fails, so
+// the entry would otherwise never be written; the response handler that
+// does run after a plain HTTP failure then finds the entry finished.
+func (p *Proxy) logRoundTripErrors(data *requestContext, next goproxy.RoundTripper) goproxy.RoundTripper {
+	return goproxy.RoundTripperFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Response, error) {
+		data.log.startUpstream(data.startTime)
+		if socket, ok := p.unix.requestSocket(req); ok {
+			data.log.UnixSocket = socket
+		}
+		resp, err := next.RoundTrip(req, ctx)
+		if err != nil && isCertVerificationError(err) {
+			// Answer with a 502 the response handler logs, rather than
+			// dropping the connection
+			data.log.Error = err.Error()
+			data.log.ErrorKind = "tls"
+			data.log.setDisposition(dispositionError)
+			recordRejectedCert(data.log, err)
+			return badGatewayResponse(req, err), nil
+		}
+		if err != nil && data.finish() {
+			data.trace.record(data.log)
+			p.logger.LogError(data.log, err)
+		}
+		return resp, err
+	})
+}
+
+// Close waits up to shutdownTimeout for in-flight captures, prints the
+// summary, and closes the proxy's resources. It is safe to call more than once.
 func (p *Proxy) Close() error {
-	// Print summary
-	if err := p.logger.Summary(); err != nil {
-		fmt.Printf("Warning: failed to print summary: %v\n", err)
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return p.close(ctx)
+}
+
+// close drains in-flight captures until ctx expires, then closes the log
+func (p *Proxy) close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		// Let in-flight requests finish writing their entries
+		if err := p.logger.Drain(ctx); err != nil {
+			fmt.Printf("Warning: closing log with %v\n", err)
+		}
+
+		if p.cassette != nil {
+			if err := p.cassette.close(); err != nil {
+				fmt.Printf("Warning: failed to close cassette: %v\n", err)
+			}
+		}
+
+		// Flush and close the sinks first so the summary reads every entry,
+		// including those still queued for an async writer
+		p.closeErr = p.logger.Close()
+
+		// Print summary and save it for downstream tooling
+		summary, err := p.logger.Summarize()
+		if err != nil {
+			fmt.Printf("Warning: failed to summarize log: %v\n", err)
+		}
+		var summaryPath string
+		if summary != nil {
+			summary.checkFailures(p.opts.FailOn)
+			p.mu.Lock()
+			p.summary = summary
+			p.mu.Unlock()
+			summary.Print()
+			if summaryPath, err = p.logger.WriteSummaryFile(summary); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			} else {
+				fmt.Printf("Summary file: %s\n", summaryPath)
+			}
+		}
+		if err := p.logger.UpdateIndex(summary, summaryPath); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	})
+	return p.closeErr
+}
+
+// Summary returns the session summary computed when the proxy was closed,
+// or nil before then or if summarizing failed
+func (p *Proxy) Summary() *SessionSummary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.summary
+}
+
+// Pause stops logging entries, while still proxying, until Resume. It
+// reports whether capture was running.
+func (p *Proxy) Pause() bool {
+	return p.logger.Pause()
+}
 
-	return p.logger.Close()
+// Resume restarts logging after Pause, writing a marker entry with the
+// number of entries skipped. It reports whether capture was paused.
+func (p *Proxy) Resume() bool {
+	return p.logger.Resume()
 }
 
 // GetLogPath returns the path to the log file
@@ -125,3 +495,13 @@ func (p *Proxy) GetLogPath() string {
 func (p *Proxy) GetCertPath() string {
 	return p.certMgr.GetSystemCertPath()
 }
+
+// GetCertFingerprint returns the hex SHA-256 fingerprint of the CA certificate
+func (p *Proxy) GetCertFingerprint() string {
+	ca := p.certMgr.GetTLSCA()
+	if len(ca.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(ca.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
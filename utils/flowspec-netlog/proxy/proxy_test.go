@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProxy serves a proxy with opts, logging to a temporary directory
+// unless opts.LogDir is set, and returns it with a client that sends plain
+// HTTP requests through it. The proxy is closed when the test ends.
+func newTestProxy(t *testing.T, opts Options) (*Proxy, *http.Client) {
+	t.Helper()
+	if opts.LogDir == "" {
+		opts.LogDir = t.TempDir()
+	}
+	opts.Addr = "127.0.0.1:0"
+	p, err := NewProxy(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(p)
+	t.Cleanup(func() {
+		server.Close()
+		p.Close()
+	})
+
+	proxyURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+}
+
+// startTestProxy starts a proxy with opts on a local port, as the binary
+// does, logging to a temporary directory, and returns it with its address.
+// The proxy is closed when the test ends.
+func startTestProxy(t *testing.T, opts Options) (*Proxy, string) {
+	t.Helper()
+	opts.LogDir = t.TempDir()
+	opts.Addr = "127.0.0.1:0"
+	p, err := NewProxy(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	return p, p.Addr()
+}
+
+// connectTunnel opens a CONNECT tunnel to target through the proxy at
+// proxyAddr. The connection is closed when the test ends.
+func connectTunnel(t *testing.T, proxyAddr, target string) *net.TCPConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT %s: status %d", target, resp.StatusCode)
+	}
+	return conn.(*net.TCPConn)
+}
+
+// connectTLS opens a CONNECT tunnel to target through the proxy at
+// proxyAddr and starts TLS in it with config. The connection is closed
+// when the test ends.
+func connectTLS(t *testing.T, proxyAddr, target string, config *tls.Config) *tls.Conn {
+	t.Helper()
+	conn := connectTunnel(t, proxyAddr, target)
+	client := tls.Client(conn, config)
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// closeAndRead closes p and returns the request entries of its log file
+func closeAndRead(t *testing.T, p *Proxy) []*RequestLog {
+	t.Helper()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := readEntries(p.GetLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// startEchoServer serves a TCP echo on a local port and returns its
+// address. The server is closed when the test ends.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// skipVerify makes client accept any certificate, such as the proxy's
+// leaf certificates for intercepted hosts
+func skipVerify(client *http.Client) *http.Client {
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return client
+}
+
+func TestUpstreamProtocol(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstream.EnableHTTP2 = true
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		disableHTTP2 bool
+		want         string
+	}{
+		{false, "h2"},
+		{true, "http/1.1"},
+	} {
+		p, client := newTestProxy(t, Options{InsecureUpstream: true, DisableHTTP2: tc.disableHTTP2})
+		resp, err := skipVerify(client).Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 1 {
+			t.Fatalf("got %d entries, want 1", len(entries))
+		}
+		if entries[0].Protocol != tc.want {
+			t.Errorf("DisableHTTP2 %v: protocol %q, want %q", tc.disableHTTP2, entries[0].Protocol, tc.want)
+		}
+	}
+}
+
+func TestClientProtocolHTTP10(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	p, addr := startTestProxy(t, Options{})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET %s/legacy HTTP/1.0\r\n\r\n", upstream.URL)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if got := entries[0].ClientProtocol; got != "HTTP/1.0" {
+		t.Errorf("client protocol = %q, want HTTP/1.0", got)
+	}
+}
+
+func TestLogNotHTMLEscaped(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Tom & Jerry</p>"))
+	}))
+	defer upstream.Close()
+
+	for _, pretty := range []bool{false, true} {
+		p, client := newTestProxy(t, Options{PrettyLog: pretty})
+		resp, err := client.Post(upstream.URL+"/search?q=a&b=<c>", "text/plain", strings.NewReader("x < y && y > z"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(p.GetLogPath())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"/search?q=a&b=<c>", "x < y && y > z", "<p>Tom & Jerry</p>"} {
+			if !bytes.Contains(data, []byte(want)) {
+				t.Errorf("pretty %v: log does not hold %q verbatim", pretty, want)
+			}
+		}
+		for _, escaped := range []string{`\u003c`, `\u003e`, `\u0026`} {
+			if bytes.Contains(data, []byte(escaped)) {
+				t.Errorf("pretty %v: log holds %s", pretty, escaped)
+			}
+		}
+	}
+}
+
+func TestEndTimestamp(t *testing.T) {
+	const delay = 1500 * time.Millisecond
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+	}))
+	defer upstream.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String() + "/"
+	l.Close()
+
+	p, client := newTestProxy(t, Options{})
+	for _, target := range []string{upstream.URL, refused} {
+		if resp, err := client.Get(target); err == nil {
+			resp.Body.Close()
+		}
+	}
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	for _, entry := range entries {
+		start, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end, err := time.Parse(time.RFC3339, entry.EndTimestamp)
+		if err != nil {
+			t.Fatalf("%s: end timestamp: %v", entry.URL, err)
+		}
+		// Both are truncated to the second
+		elapsed := end.Sub(start)
+		duration := time.Duration(entry.Duration) * time.Millisecond
+		if diff := elapsed - duration; diff < -time.Second || diff > time.Second {
+			t.Errorf("%s: end - start = %s, want about the duration %s", entry.URL, elapsed, duration)
+		}
+	}
+	if entries[0].Duration < delay.Milliseconds() {
+		t.Errorf("duration = %dms, want at least the upstream's %s", entries[0].Duration, delay)
+	}
+}
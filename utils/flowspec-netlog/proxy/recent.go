@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"sync"
+)
+
+const (
+	defaultRecentBuffer = 100
+)
+
+// recentBuffer is a fixed-size ring buffer of the most recent log entries
+type recentBuffer struct {
+	mu      sync.Mutex
+	entries []*RequestLog
+	next    int
+	full    bool
+}
+
+// newRecentBuffer creates a ring buffer holding at most size entries.
+// A size of zero or less disables the buffer.
+func newRecentBuffer(size int) *recentBuffer {
+	if size <= 0 {
+		return nil
+	}
+	return &recentBuffer{entries: make([]*RequestLog, size)}
+}
+
+// add stores an entry, overwriting the oldest one when the buffer is full
+func (b *recentBuffer) add(log *RequestLog) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[b.next] = log
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// list returns the buffered entries matching filter, newest first
+func (b *recentBuffer) list(filter func(*RequestLog) bool) []*RequestLog {
+	if b == nil {
+		return []*RequestLog{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.entries)
+	}
+
+	result := make([]*RequestLog, 0, count)
+	for i := 1; i <= count; i++ {
+		log := b.entries[(b.next-i+len(b.entries))%len(b.entries)]
+		if filter == nil || filter(log) {
+			result = append(result, log)
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRecentBufferKeepsNewest(t *testing.T) {
+	buffer := newRecentBuffer(3)
+	for i := 1; i <= 5; i++ {
+		buffer.add(&RequestLog{URL: fmt.Sprintf("/%d", i)})
+	}
+	var urls []string
+	for _, log := range buffer.list(nil) {
+		urls = append(urls, log.URL)
+	}
+	if got := strings.Join(urls, " "); got != "/5 /4 /3" {
+		t.Errorf("list() = %s, want /5 /4 /3", got)
+	}
+}
+
+func TestRecentFilters(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	first := httptest.NewServer(handler)
+	defer first.Close()
+	second := httptest.NewServer(handler)
+	defer second.Close()
+
+	p, client := newTestProxy(t, Options{RecentBuffer: 3})
+	for _, target := range []string{
+		first.URL + "/old", // pushed out of the buffer
+		first.URL + "/a",
+		second.URL + "/missing",
+		first.URL + "/b",
+	} {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	secondHost := strings.TrimPrefix(second.URL, "http://")
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{first.URL + "/b", second.URL + "/missing", first.URL + "/a"}},
+		{"status=404", []string{second.URL + "/missing"}},
+		{"host=" + url.QueryEscape(secondHost), []string{second.URL + "/missing"}},
+		{"host=127.0.0.1", []string{first.URL + "/b", second.URL + "/missing", first.URL + "/a"}},
+		{"host=127.0.0.1&status=200", []string{first.URL + "/b", first.URL + "/a"}},
+	} {
+		rec := httptest.NewRecorder()
+		p.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/recent?"+tc.query, nil))
+		var entries []RequestLog
+		if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		var got []string
+		for _, entry := range entries {
+			got = append(got, entry.URL)
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("/recent?%s = %q, want %q", tc.query, got, tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	p.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/recent?status=ok", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("/recent?status=ok: status %d, want 400", rec.Code)
+	}
+}
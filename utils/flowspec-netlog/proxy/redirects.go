@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redirectTTL        = 30 * time.Second
+	maxPendingRedirect = 10000
+)
+
+// pendingRedirect is a 3xx hop waiting for the client to follow its Location
+type pendingRedirect struct {
+	chainID string
+	chain   []string
+	expires time.Time
+}
+
+// redirectTracker links redirect hops by matching a 3xx Location with the
+// next request for that URL from the same client
+type redirectTracker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingRedirect
+}
+
+// newRedirectTracker creates an empty tracker
+func newRedirectTracker() *redirectTracker {
+	return &redirectTracker{pending: make(map[string]*pendingRedirect)}
+}
+
+// clientIP returns the IP part of a RemoteAddr; clients often follow a
+// redirect on a new connection, so the port is not part of the key
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// canonicalURL normalizes a URL for comparison, dropping default ports and fragments
+func canonicalURL(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	c.Host = strings.ToLower(c.Host)
+	if (c.Scheme == "https" && c.Port() == "443") || (c.Scheme == "http" && c.Port() == "80") {
+		c.Host = c.Hostname()
+	}
+	return c.String()
+}
+
+// link attaches the chain of a pending redirect to a request that follows it
+func (t *redirectTracker) link(log *RequestLog, req *http.Request) {
+	key := clientIP(req.RemoteAddr) + " " + canonicalURL(req.URL)
+
+	t.mu.Lock()
+	hop, ok := t.pending[key]
+	if ok {
+		delete(t.pending, key)
+	}
+	t.mu.Unlock()
+
+	if !ok || time.Now().After(hop.expires) {
+		return
+	}
+	log.ChainID = hop.chainID
+	log.RedirectChain = append(append([]string{}, hop.chain...), log.URL)
+}
+
+// record remembers a redirect response so the follow-up request can be linked
+func (t *redirectTracker) record(log *RequestLog, req *http.Request, resp *http.Response) {
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		return
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return
+	}
+
+	if log.ChainID == "" {
+		log.ChainID = newChainID()
+		log.RedirectChain = []string{log.URL}
+	}
+
+	key := clientIP(req.RemoteAddr) + " " + canonicalURL(location)
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Drop hops that were never followed so state can't grow unbounded
+	for k, hop := range t.pending {
+		if now.After(hop.expires) {
+			delete(t.pending, k)
+		}
+	}
+	if len(t.pending) >= maxPendingRedirect {
+		return
+	}
+	t.pending[key] = &pendingRedirect{
+		chainID: log.ChainID,
+		chain:   log.RedirectChain,
+		expires: now.Add(redirectTTL),
+	}
+}
+
+// newChainID returns a random identifier for a redirect chain
+func newChainID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
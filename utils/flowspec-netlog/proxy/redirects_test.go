@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRedirectChain(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/c", http.StatusMovedPermanently)
+		}
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	resp, err := client.Get(upstream.URL + "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/c" {
+		t.Fatalf("client ended at %s, want /c", resp.Request.URL.Path)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	a, b, c := upstream.URL+"/a", upstream.URL+"/b", upstream.URL+"/c"
+	for i, want := range [][]string{{a}, {a, b}, {a, b, c}} {
+		if !reflect.DeepEqual(entries[i].RedirectChain, want) {
+			t.Errorf("entry %d: redirect chain %q, want %q", i, entries[i].RedirectChain, want)
+		}
+		if entries[i].ChainID == "" || entries[i].ChainID != entries[0].ChainID {
+			t.Errorf("entry %d: chain id %q, want the chain's %q", i, entries[i].ChainID, entries[0].ChainID)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ReplayOptions configures Replay
+type ReplayOptions struct {
+	// Cookies keeps a cookie jar for the session, as a browser would:
+	// cookies set by a replayed response are sent on later requests to the
+	// same domain, in place of captured cookies of the same name
+	Cookies bool
+	// Client sends the requests; nil uses a client with default settings.
+	// Redirects are never followed, since the capture holds the redirected
+	// requests as entries of their own.
+	Client *http.Client
+}
+
+// clientSetHeaders are captured headers a client sets itself from the URL
+// and body, so they are not sent as captured
+var clientSetHeaders = map[string]bool{"Host": true, "Content-Length": true}
+
+// replayRequest is a captured request to send again, entry n of its file
+type replayRequest struct {
+	n   int
+	log RequestLog
+}
+
+// Replay sends the requests of the log file at path again, in log order,
+// and writes one line per request to w with the status it got. It returns
+// how many requests were sent. Bypassed requests and tunnels are skipped,
+// as their requests were never captured. Redacted header values are read
+// from environment variables named after the header, and a header whose
+// variable is unset is left out. A form whose fields were redacted is not
+// sent, since its placeholder values would reach the server in place of the
+// real ones. A request that fails is reported and the replay goes on.
+func Replay(w io.Writer, path string, opts ReplayOptions) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var requests []replayRequest
+	entry := 0
+	err = readLogRecords(file, func(line []byte) {
+		if isSessionRecord(line) {
+			return
+		}
+		var log RequestLog
+		if err := json.Unmarshal(line, &log); err != nil || log.Pause != nil {
+			return
+		}
+		entry++
+		if log.Bypassed || log.Tunnel || log.Method == "" {
+			return
+		}
+		if log.RequestBodyFile != "" {
+			log.RequestBodyFile = resolveBodyRef(path, log.RequestBodyFile)
+		}
+		requests = append(requests, replayRequest{n: entry, log: log})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	client := &http.Client{}
+	if opts.Client != nil {
+		*client = *opts.Client
+	}
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	client.Jar = nil
+	if opts.Cookies {
+		if client.Jar, err = cookiejar.New(nil); err != nil {
+			return 0, err
+		}
+	}
+
+	sent := 0
+	for _, r := range requests {
+		fmt.Fprintf(w, "%d: %s %s", r.n, r.log.Method, r.log.URL)
+		if name := redactedFormField(r.log.FormFields); name != "" {
+			fmt.Fprintf(w, " -> skipped, form field %s was redacted\n", name)
+			continue
+		}
+		req, note, err := newReplayRequest(&r.log, client.Jar)
+		if err != nil {
+			fmt.Fprintf(w, " -> error: %v\n", err)
+			continue
+		}
+		resp, err := client.Do(req)
+		sent++
+		if err != nil {
+			fmt.Fprintf(w, " -> error: %v\n", err)
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		fmt.Fprintf(w, " -> %d", resp.StatusCode)
+		if r.log.StatusCode > 0 && r.log.StatusCode != resp.StatusCode {
+			fmt.Fprintf(w, " (logged %d)", r.log.StatusCode)
+		}
+		if note != "" {
+			fmt.Fprintf(w, " (%s)", note)
+		}
+		fmt.Fprintln(w)
+	}
+	return sent, nil
+}
+
+// newReplayRequest builds the request for a captured entry. note says what
+// could not be sent as captured, if anything.
+func newReplayRequest(log *RequestLog, jar http.CookieJar) (*http.Request, string, error) {
+	var notes []string
+	var body io.Reader
+	text := log.RequestBody
+	if text == "" && len(log.FormFields) > 0 {
+		text = url.Values(log.FormFields).Encode()
+	}
+	switch {
+	case log.RequestBodyFile != "":
+		data, err := os.ReadFile(log.RequestBodyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		body = bytes.NewReader(data)
+	case log.RequestBodyOverflow != nil:
+		notes = append(notes, "body over the capture limit not sent")
+	case text != "":
+		body = strings.NewReader(text)
+	}
+
+	req, err := http.NewRequest(log.Method, log.URL, body)
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range log.Headers {
+		if clientSetHeaders[name] {
+			continue
+		}
+		if variable, ok := redactedVariable(name, value); ok {
+			if value = os.Getenv(variable); value == "" {
+				notes = append(notes, fmt.Sprintf("%s left out, $%s unset", name, variable))
+				continue
+			}
+		}
+		req.Header.Set(name, value)
+	}
+	if jar != nil {
+		dropJarCookies(req, jar)
+	}
+	return req, strings.Join(notes, ", "), nil
+}
+
+// redactedFormField returns the first form field, by name, whose value was
+// redacted, or "" if there is none
+func redactedFormField(fields map[string][]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range fields[name] {
+			if value == "[REDACTED]" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// dropJarCookies removes the captured cookies that the jar holds a newer
+// value for, so the client sends the jar's instead
+func dropJarCookies(req *http.Request, jar http.CookieJar) {
+	fresh := make(map[string]bool)
+	for _, cookie := range jar.Cookies(req.URL) {
+		fresh[cookie.Name] = true
+	}
+	if len(fresh) == 0 {
+		return
+	}
+	captured := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range captured {
+		if !fresh[cookie.Name] {
+			req.AddCookie(cookie)
+		}
+	}
+}
+
+// redactedVariable returns the environment variable holding a redacted
+// header value, named after the header: X-API-Key reads $X_API_KEY. Only
+// names of letters, digits, and dashes qualify, so the variable is also a
+// valid shell name.
+func redactedVariable(name, value string) (string, bool) {
+	if value != "[REDACTED]" || name == "" {
+		return "", false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return "", false
+		}
+	}
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_")), true
+}
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplayCookieJar(t *testing.T) {
+	var got []string // Cookie header of each /me request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "fresh", Path: "/"})
+		case "/me":
+			got = append(got, r.Header.Get("Cookie"))
+		}
+	}))
+	defer server.Close()
+
+	// The capture sends the session cookie it had then, now stale
+	path := filepath.Join(t.TempDir(), "network.replay.jsonl")
+	log := fmt.Sprintf(`{"type":"session","schema_version":%d}
+{"method":"POST","url":"%[2]s/login","host":"example","status_code":200,"form_fields":{"user":["ada"]}}
+{"method":"GET","url":"%[2]s/me","host":"example","status_code":200,"headers":{"Cookie":"session=stale; theme=dark"}}
+`, LogSchemaVersion, server.URL)
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		cookies bool
+		want    string
+	}{
+		{true, "theme=dark; session=fresh"},
+		{false, "session=stale; theme=dark"},
+	} {
+		got = nil
+		var out strings.Builder
+		n, err := Replay(&out, path, ReplayOptions{Cookies: tc.cookies})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Errorf("cookies %v: sent %d requests, want 2\n%s", tc.cookies, n, out.String())
+		}
+		if len(got) != 1 || got[0] != tc.want {
+			t.Errorf("cookies %v: /me got Cookie %q, want %q", tc.cookies, got, tc.want)
+		}
+	}
+}
+
+func TestReplaySkipsRedactedForm(t *testing.T) {
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posted = append(posted, string(body))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "network.replay.jsonl")
+	log := fmt.Sprintf(`{"method":"POST","url":"%[1]s/login","host":"example","status_code":200,"form_fields":{"user":["ada"],"password":["[REDACTED]"]}}
+{"method":"POST","url":"%[1]s/search","host":"example","status_code":200,"form_fields":{"q":["go"]}}
+`, server.URL)
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	n, err := Replay(&out, path, ReplayOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(posted) != 1 || posted[0] != "q=go" {
+		t.Errorf("sent %d requests, server got %q; want only q=go", n, posted)
+	}
+	if !strings.Contains(out.String(), "1: POST "+server.URL+"/login -> skipped, form field password was redacted") {
+		t.Errorf("output does not report the skipped login:\n%s", out.String())
+	}
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseSize parses a human-readable size such as "500MB" or "2GB".
+// Units are binary (1KB = 1024 bytes); a bare number is bytes.
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.size
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a byte count in the largest unit parseSize accepts that fits
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// logFileInfo describes a log file in the log directory
+type logFileInfo struct {
+	path string
+	info os.FileInfo
+}
+
+// listLogFiles returns the network.*.jsonl* and network.*.gob files in dir,
+// oldest first
+func listLogFiles(dir string) ([]logFileInfo, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "network.*.jsonl*"))
+	if err != nil {
+		return nil, err
+	}
+	gobs, err := filepath.Glob(filepath.Join(dir, "network.*.gob"))
+	if err != nil {
+		return nil, err
+	}
+	matches = append(matches, gobs...)
+
+	files := make([]logFileInfo, 0, len(matches))
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, logFileInfo{path: path, info: info})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].info.ModTime().Equal(files[j].info.ModTime()) {
+			return files[i].info.ModTime().Before(files[j].info.ModTime())
+		}
+		return files[i].path < files[j].path
+	})
+	return files, nil
+}
+
+// enforceDiskBudget deletes the oldest log files until the combined size of
+// all log files is within budget. The active file is never deleted. It
+// returns the paths it deleted.
+func enforceDiskBudget(dir, activePath string, budget int64) ([]string, error) {
+	return pruneLogFiles(dir, activePath, "Disk budget exceeded", func(_ int, size int64) bool {
+		return size > budget
+	})
+}
+
+// enforceMaxLogFiles deletes the oldest log files until at most max remain
+// besides the active file, which is never deleted. It returns the paths it
+// deleted.
+func enforceMaxLogFiles(dir, activePath string, max int) ([]string, error) {
+	return pruneLogFiles(dir, activePath, "Log file limit exceeded", func(rotated int, _ int64) bool {
+		return rotated > max
+	})
+}
+
+// pruneLogFiles deletes the oldest log files other than the active one
+// while over reports a limit exceeded, given the number of files besides
+// the active one and the combined size of all of them. It returns the
+// paths it deleted; reason starts the message printed for each.
+func pruneLogFiles(dir, activePath, reason string, over func(rotated int, size int64) bool) ([]string, error) {
+	files, err := listLogFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := 0
+	var size int64
+	for _, f := range files {
+		if f.path != activePath {
+			rotated++
+		}
+		size += f.info.Size()
+	}
+
+	var evicted []string
+	for _, f := range files {
+		if !over(rotated, size) {
+			break
+		}
+		if f.path == activePath {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			return evicted, fmt.Errorf("failed to evict %s: %w", f.path, err)
+		}
+		rotated--
+		size -= f.info.Size()
+		evicted = append(evicted, f.path)
+		fmt.Printf("%s, evicted %s (%d bytes)\n", reason, f.path, f.info.Size())
+	}
+	return evicted, nil
+}
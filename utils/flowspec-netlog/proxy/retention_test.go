@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeOldLogs creates n log files in dir, the first one oldest
+func writeOldLogs(t *testing.T, dir string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("network.old%d.jsonl", i))
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(time.Duration(i-n-1) * time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// logNames returns the names of the log files in dir, oldest first
+func logNames(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := listLogFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f.path)
+	}
+	return names
+}
+
+func TestMaxLogFilesOnRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeOldLogs(t, dir, 5)
+
+	sink, err := newFileSink(dir, "t1", nil, 0, 3, false, logFormatJSONL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if got := fmt.Sprint(logNames(t, dir)); got != "[network.old2.jsonl network.old3.jsonl network.old4.jsonl network.t1.jsonl]" {
+		t.Fatalf("after open: %s", got)
+	}
+
+	if err := sink.rotate("t2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(logNames(t, dir)); got != "[network.old3.jsonl network.old4.jsonl network.t1.jsonl network.t2.jsonl]" {
+		t.Fatalf("after rotation: %s", got)
+	}
+}
+
+func TestSummaryAfterEviction(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := newFileSink(dir, "t1", &SessionRecord{Type: sessionRecordType}, 0, 1, false, logFormatJSONL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, timestamp := range []string{"t2", "t3"} {
+		if err := sink.Write(&RequestLog{Method: "GET", URL: "http://example.com/", Host: "example.com", StatusCode: 200}); err != nil {
+			t.Fatal(err)
+		}
+		// Keep modification times apart so eviction order is by age
+		time.Sleep(10 * time.Millisecond)
+		if err := sink.rotate(timestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(sink.files()); got != 2 {
+		t.Fatalf("files() lists %d files, want the 2 not evicted", got)
+	}
+	summary, err := SummarizeFiles(sink.files()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Total != 1 {
+		t.Errorf("Total = %d, want 1", summary.Total)
+	}
+
+	// A missing file is skipped, unless it is the only one
+	if _, err := SummarizeFiles(append(sink.files(), filepath.Join(dir, "gone.jsonl"))...); err != nil {
+		t.Errorf("missing file among others: %v", err)
+	}
+	if _, err := SummarizeFiles(filepath.Join(dir, "gone.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("only file missing: err = %v, want not exist", err)
+	}
+}
+
+func TestDiskBudgetEviction(t *testing.T) {
+	dir := t.TempDir()
+	writeOldLogs(t, dir, 5)
+
+	sink, err := newFileSink(dir, "t1", nil, 250, 0, false, logFormatJSONL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if got := fmt.Sprint(logNames(t, dir)); got != "[network.old3.jsonl network.old4.jsonl network.t1.jsonl]" {
+		t.Fatalf("after open: %s", got)
+	}
+
+	// Fill the active file past the budget, so rotating evicts it too
+	if err := sink.Write(&RequestLog{Method: "GET", URL: "http://example.com/" + string(make([]byte, 300))}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.rotate("t2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(logNames(t, dir)); got != "[network.t2.jsonl]" {
+		t.Fatalf("after rotation: %s", got)
+	}
+	if got := fmt.Sprint(sink.files()); got != "["+filepath.Join(dir, "network.t2.jsonl")+"]" {
+		t.Errorf("files() = %s, want only the active file", got)
+	}
+}
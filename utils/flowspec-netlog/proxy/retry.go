@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/elazarl/goproxy"
+)
+
+const (
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// isIdempotent reports whether a request with this method is safe to retry
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus reports whether an upstream status indicates a transient failure
+func isRetryableStatus(code int) bool {
+	return code == http.StatusBadGateway ||
+		code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
+
+// retryRoundTripper returns a round tripper that retries connection errors and
+// transient statuses over tr with exponential backoff, recording the count in
+// log.Retries
+func (p *Proxy) retryRoundTripper(log *RequestLog, tr http.RoundTripper) goproxy.RoundTripper {
+	return goproxy.RoundTripperFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Response, error) {
+		// Buffer the body so every attempt can resend it; bodies too large to
+		// buffer are sent once without retrying
+		var body []byte
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.ContentLength <= 0 || req.ContentLength > int64(p.logger.maxBody) {
+				return tr.RoundTrip(req)
+			}
+			var err error
+			if body, err = io.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+			req.Body.Close()
+		}
+
+		delay := retryBaseDelay
+		for attempt := 0; ; attempt++ {
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			resp, err := tr.RoundTrip(req)
+			retryable := (err != nil && !errors.Is(err, context.Canceled) && !isCertVerificationError(err)) ||
+				(err == nil && isRetryableStatus(resp.StatusCode))
+			if !retryable || attempt+1 >= p.maxAttempts {
+				log.Retries = attempt
+				return resp, err
+			}
+
+			if resp != nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+
+			select {
+			case <-time.After(delay):
+			case <-req.Context().Done():
+				log.Retries = attempt
+				return nil, req.Context().Err()
+			}
+			delay *= 2
+			if delay > retryMaxDelay {
+				delay = retryMaxDelay
+			}
+		}
+	})
+}
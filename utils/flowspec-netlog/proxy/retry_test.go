@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRetryFlakyUpstream(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{MaxAttempts: 3})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d, want 200 after the retries", resp.StatusCode)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("upstream called %d times, want 3", n)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].Retries != 2 || entries[0].StatusCode != http.StatusOK {
+		t.Errorf("entry retries %d, status %d; want 2 retries and 200", entries[0].Retries, entries[0].StatusCode)
+	}
+}
+
+func TestRetryStopsAtMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	// Two attempts are one short of the three the upstream needs
+	p, client := newTestProxy(t, Options{MaxAttempts: 2})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503 once the attempts run out", resp.StatusCode)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("upstream called %d times, want 2", n)
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].Retries != 1 {
+		t.Errorf("entry retries %d, want 1", entries[0].Retries)
+	}
+}
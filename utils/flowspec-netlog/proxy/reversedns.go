@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	reverseDNSCacheSize = 1024 // addresses remembered by FLOWSPEC_REVERSE_DNS
+	reverseDNSTimeout   = 2 * time.Second
+)
+
+// reverseDNS looks up the names of IP-literal hosts in the background and
+// caches them, failures included, so each address is queried once. Lookups
+// never block a request: an entry records the name only if it is known by
+// the time the entry is written. The oldest addresses are evicted once the
+// cache is full.
+type reverseDNS struct {
+	mu     sync.Mutex
+	names  map[string]*reverseName
+	order  []string                                               // addresses, oldest first
+	lookup func(ctx context.Context, ip string) ([]string, error) // net.DefaultResolver.LookupAddr, replaceable in tests
+}
+
+// reverseName is a cached lookup; name is set before done is closed
+type reverseName struct {
+	name string
+	done chan struct{}
+}
+
+func newReverseDNS() *reverseDNS {
+	return &reverseDNS{
+		names:  make(map[string]*reverseName),
+		lookup: net.DefaultResolver.LookupAddr,
+	}
+}
+
+// name returns the name of host if it is an IP literal whose lookup has
+// finished, starting the lookup on first sight. It returns "" otherwise.
+func (r *reverseDNS) name(host string) string {
+	ip := hostIP(host)
+	if r == nil || ip == "" {
+		return ""
+	}
+
+	r.mu.Lock()
+	entry, ok := r.names[ip]
+	if !ok {
+		entry = &reverseName{done: make(chan struct{})}
+		r.add(ip, entry)
+		go r.resolve(ip, entry)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-entry.done:
+		return entry.name
+	default:
+		return ""
+	}
+}
+
+// add caches entry, evicting the oldest address when full; r.mu is held
+func (r *reverseDNS) add(ip string, entry *reverseName) {
+	if len(r.order) >= reverseDNSCacheSize {
+		delete(r.names, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.names[ip] = entry
+	r.order = append(r.order, ip)
+}
+
+// resolve looks up ip, keeping the first name returned
+func (r *reverseDNS) resolve(ip string, entry *reverseName) {
+	defer close(entry.done)
+	ctx, cancel := context.WithTimeout(context.Background(), reverseDNSTimeout)
+	defer cancel()
+	names, err := r.lookup(ctx, ip)
+	if err == nil && len(names) > 0 {
+		entry.name = strings.TrimSuffix(names[0], ".")
+	}
+}
+
+// hostIP returns the address of a host or host:port that is an IP
+// literal, or ""
+func hostIP(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// stubLookup replaces r's resolver with one naming 127.0.0.1 and failing
+// for every other address, and returns the count of lookups made
+func stubLookup(r *reverseDNS) *atomic.Int64 {
+	var calls atomic.Int64
+	r.lookup = func(ctx context.Context, ip string) ([]string, error) {
+		calls.Add(1)
+		if ip != "127.0.0.1" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"upstream.internal.", "other.internal."}, nil
+	}
+	return &calls
+}
+
+// waitResolved waits for the lookup of ip to finish
+func waitResolved(r *reverseDNS, ip string) {
+	r.mu.Lock()
+	entry := r.names[ip]
+	r.mu.Unlock()
+	<-entry.done
+}
+
+func TestReverseDNSCache(t *testing.T) {
+	r := newReverseDNS()
+	calls := stubLookup(r)
+
+	for _, tc := range []struct {
+		host string
+		want string
+	}{
+		{"127.0.0.1:8080", "upstream.internal"},
+		{"10.0.0.1", ""},
+	} {
+		r.name(tc.host)
+		waitResolved(r, hostIP(tc.host))
+		if got := r.name(tc.host); got != tc.want {
+			t.Errorf("name(%q) = %q, want %q", tc.host, got, tc.want)
+		}
+	}
+	if got := r.name("example.com:443"); got != "" {
+		t.Errorf("name of a host name = %q, want none", got)
+	}
+
+	// Each address is looked up once, failures included, however it is written
+	r.name("127.0.0.1")
+	r.name("10.0.0.1:443")
+	if got := calls.Load(); got != 2 {
+		t.Errorf("lookups = %d, want 2", got)
+	}
+}
+
+func TestReverseDNSRecorded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{ReverseDNS: true})
+	calls := stubLookup(p.logger.rdns)
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		waitResolved(p.logger.rdns, "127.0.0.1")
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	// The first entry may be written before its lookup finishes
+	if got := entries[1].ReverseDNS; got != "upstream.internal" {
+		t.Errorf("reverse_dns = %q, want %q", got, "upstream.internal")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("lookups = %d, want 1", got)
+	}
+}
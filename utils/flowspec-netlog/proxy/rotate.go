@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"fmt"
+	"time"
+)
+
+// rotator calls rotate at every interval boundary (e.g. on the hour for 1h)
+// until stopped
+type rotator struct {
+	quit chan struct{}
+	done chan struct{}
+}
+
+// startRotator starts the rotation timer goroutine
+func startRotator(interval time.Duration, rotate func(boundary time.Time)) *rotator {
+	r := &rotator{
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(r.done)
+		for {
+			boundary := time.Now().Truncate(interval).Add(interval)
+			timer := time.NewTimer(time.Until(boundary))
+			select {
+			case <-timer.C:
+				rotate(boundary)
+			case <-r.quit:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+	return r
+}
+
+// stop ends the timer goroutine and waits for an in-progress rotation
+func (r *rotator) stop() {
+	select {
+	case <-r.quit:
+	default:
+		close(r.quit)
+	}
+	<-r.done
+}
+
+// rotate starts new log files named after the interval boundary in every
+// sink that writes files
+func (l *Logger) rotate(boundary time.Time) {
+	timestamp := boundary.Format("20060102-150405")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, sink := range l.sinks {
+		if r, ok := sink.(rotatingSink); ok {
+			if err := r.rotate(timestamp); err != nil {
+				fmt.Printf("Warning: log rotation failed: %v\n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateInterval(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{RotateInterval: time.Second})
+	sent := 0
+	for deadline := time.Now().Add(2200 * time.Millisecond); time.Now().Before(deadline); sent++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(p.opts.LogDir, "network.*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 2 {
+		t.Fatalf("files = %v, want a new one every second", files)
+	}
+	logged := 0
+	for _, file := range files {
+		entries, err := readEntries(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logged += len(entries)
+	}
+	if logged != sent {
+		t.Errorf("%d entries across %d files, want %d", logged, len(files), sent)
+	}
+	if total := p.Summary().Total; total != sent {
+		t.Errorf("summary total = %d, want %d", total, sent)
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoundTripErrorWrittenOnce(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{AsyncWrites: true})
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 500 {
+			t.Errorf("status %d for a failed upstream, want 5xx", resp.StatusCode)
+		}
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != requests {
+		t.Fatalf("got %d entries, want %d", len(entries), requests)
+	}
+	for _, entry := range entries {
+		if entry.Error == "" || entry.Disposition != dispositionError {
+			t.Errorf("entry error %q, disposition %q; want the upstream error", entry.Error, entry.Disposition)
+		}
+	}
+}
+
+func TestResponseTruncated(t *testing.T) {
+	const partial = "partial body"
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// A declared length is captured before forwarding; a chunked body
+		// is captured while it streams
+		if r.URL.Path == "/chunked" {
+			fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n", len(partial), partial)
+		} else {
+			fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 100\r\n\r\n%s", partial)
+		}
+		buf.Flush()
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	for _, path := range []string{"/length", "/chunked"} {
+		resp, err := client.Get(upstream.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The client still gets what arrived
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != partial {
+			t.Errorf("%s: client read %q, want %q", path, body, partial)
+		}
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.StatusCode != http.StatusOK || !entry.ResponseTruncated || entry.BodyReadError == "" {
+			t.Errorf("%s: status %d, truncated %v, body read error %q; want 200 with the error recorded",
+				entry.URL, entry.StatusCode, entry.ResponseTruncated, entry.BodyReadError)
+		}
+		if entry.ResponseBody != partial {
+			t.Errorf("%s: response body %q, want %q", entry.URL, entry.ResponseBody, partial)
+		}
+	}
+}
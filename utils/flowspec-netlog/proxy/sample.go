@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	samplerIdle = time.Minute // buckets unused this long are evicted
+)
+
+// hostSampler caps the rate of logged entries per host with a token bucket
+// per host. Requests are always forwarded; entries over the rate are not
+// written, and the count dropped since the last written entry is recorded
+// on the next one.
+type hostSampler struct {
+	rate  float64 // entries per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*hostBucket
+	lastSweep time.Time
+}
+
+// hostBucket is the token bucket of one host
+type hostBucket struct {
+	tokens  float64
+	last    time.Time
+	dropped int // entries dropped since the last written one
+}
+
+// newHostSampler allows rate entries per second per host, with bursts of up
+// to one second's worth
+func newHostSampler(rate float64) *hostSampler {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostSampler{
+		rate:      rate,
+		burst:     burst,
+		buckets:   make(map[string]*hostBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow reports whether an entry for host may be written at now, and if so
+// how many entries for host were dropped before it
+func (s *hostSampler) allow(host string, now time.Time) (int, bool) {
+	host = strings.ToLower(host)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= samplerIdle {
+		s.sweep(now)
+	}
+
+	bucket, ok := s.buckets[host]
+	if !ok {
+		bucket = &hostBucket{tokens: s.burst, last: now}
+		s.buckets[host] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * s.rate
+	if bucket.tokens > s.burst {
+		bucket.tokens = s.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		bucket.dropped++
+		return 0, false
+	}
+	bucket.tokens--
+	dropped := bucket.dropped
+	bucket.dropped = 0
+	return dropped, true
+}
+
+// sweep evicts idle buckets. Buckets with unreported drops are kept so the
+// summary can still count them.
+func (s *hostSampler) sweep(now time.Time) {
+	for host, bucket := range s.buckets {
+		if bucket.dropped == 0 && now.Sub(bucket.last) >= samplerIdle {
+			delete(s.buckets, host)
+		}
+	}
+	s.lastSweep = now
+}
+
+// pending returns the per-host counts of dropped entries not yet recorded
+// on a written entry
+func (s *hostSampler) pending() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for host, bucket := range s.buckets {
+		if bucket.dropped > 0 {
+			counts[host] = bucket.dropped
+		}
+	}
+	return counts
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPerHostRate(t *testing.T) {
+	var hits atomic.Int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits.Add(1) })
+	flooded := httptest.NewServer(handler)
+	defer flooded.Close()
+	quiet := httptest.NewServer(handler)
+	defer quiet.Close()
+
+	const rate, flood = 5, 50
+	p, client := newTestProxy(t, Options{PerHostRate: rate})
+	start := time.Now()
+	for i := 0; i < flood; i++ {
+		resp, err := client.Get(flooded.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, resp.StatusCode)
+		}
+	}
+	elapsed := time.Since(start)
+	resp, err := client.Get(quiet.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// Every request is forwarded
+	if got := hits.Load(); got != flood+1 {
+		t.Errorf("upstreams got %d requests, want %d", got, flood+1)
+	}
+
+	entries := closeAndRead(t, p)
+	floodedHost := strings.TrimPrefix(flooded.URL, "http://")
+	logged, recordedDrops, quietLogged := 0, 0, 0
+	for _, entry := range entries {
+		switch entry.Host {
+		case floodedHost:
+			logged++
+			recordedDrops += entry.Dropped
+		default:
+			quietLogged++
+		}
+	}
+	// The burst plus what the bucket refilled while flooding
+	if max := rate + int(elapsed.Seconds()*rate) + 1; logged > max || logged == 0 {
+		t.Errorf("logged %d of %d flooded requests in %v, want 1 to %d", logged, flood, elapsed, max)
+	}
+	if quietLogged != 1 {
+		t.Errorf("logged %d requests to the other host, want 1", quietLogged)
+	}
+
+	// Drops not yet recorded on an entry are added by the summary
+	summary := p.Summary()
+	if dropped := summary.Dropped[floodedHost]; logged+dropped != flood || dropped < recordedDrops {
+		t.Errorf("logged %d, summary dropped %d (%d on entries); want them to add up to %d",
+			logged, dropped, recordedDrops, flood)
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// LogSchema returns a JSON Schema document describing one line of a log
+// file: either the session record or a RequestLog entry. It is generated
+// from the struct definitions, so it cannot drift from what is written.
+func LogSchema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	session := schemaFor(reflect.TypeOf(SessionRecord{}), defs)
+	entry := schemaFor(reflect.TypeOf(RequestLog{}), defs)
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "flowspec-netlog log line",
+		"description": fmt.Sprintf("One JSONL line of a flowspec-netlog log file (schema version %d)", LogSchemaVersion),
+		"oneOf":       []interface{}{session, entry},
+		"$defs":       defs,
+	}
+}
+
+// schemaFor returns the schema of t, registering named structs in defs and
+// referring to them by $ref
+func schemaFor(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), defs)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := defs[t.Name()]; ok {
+			return ref
+		}
+		defs[t.Name()] = nil // reserve the name for recursive types
+		defs[t.Name()] = structSchema(t, defs)
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema describes the serialized fields of a struct. Fields without
+// omitempty are always written and therefore required.
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, defs)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	// The session record is identified by its type
+	if t == reflect.TypeOf(SessionRecord{}) {
+		properties["type"] = map[string]interface{}{"const": sessionRecordType}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
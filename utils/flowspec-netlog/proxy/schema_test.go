@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// validate checks value against the subset of JSON Schema LogSchema emits,
+// returning the problems found
+func validate(schema map[string]interface{}, defs map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return validate(defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]interface{}), defs, value, path)
+	}
+	if want, ok := schema["const"]; ok && value != want {
+		return []string{fmt.Sprintf("%s = %v, want %v", path, value, want)}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s = %v, want a string", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s = %v, want a boolean", path, value))
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			problems = append(problems, fmt.Sprintf("%s = %v, want an integer", path, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s = %v, want a number", path, value))
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s = %v, want an array", path, value))
+		}
+		for i, item := range items {
+			problems = append(problems, validate(schema["items"].(map[string]interface{}), defs, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return append(problems, fmt.Sprintf("%s = %v, want an object", path, value))
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, field := range object {
+			if properties != nil {
+				fieldSchema, ok := properties[key].(map[string]interface{})
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s.%s is not in the schema", path, key))
+					continue
+				}
+				problems = append(problems, validate(fieldSchema, defs, field, path+"."+key)...)
+			} else if extra, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+				problems = append(problems, validate(extra, defs, field, path+"."+key)...)
+			}
+		}
+		required, _ := schema["required"].([]string)
+		for _, key := range required {
+			if _, ok := object[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", path, key))
+			}
+		}
+	}
+	return problems
+}
+
+func TestCapturedLinesMatchSchema(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/", HttpOnly: true})
+		w.Header().Set("Cache-Control", "max-age=300")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{SessionTags: map[string]string{"test": "schema"}})
+	req, err := http.NewRequest(http.MethodPost, upstream.URL+"/login?next=%2F", strings.NewReader("user=ada&password=secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cookie", "theme=dark")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+	req.Header.Set(SourceHeader, "checkout")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// An upstream error fills in the error fields
+	if resp, err = client.Get("http://127.0.0.1:1/unreachable"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Round-trip the schema through JSON, as a consumer would read it
+	data, err := json.Marshal(LogSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	defs := schema["$defs"].(map[string]interface{})
+	for _, def := range defs {
+		def := def.(map[string]interface{})
+		if required, ok := def["required"].([]interface{}); ok {
+			keys := make([]string, len(required))
+			for i, key := range required {
+				keys[i] = key.(string)
+			}
+			def["required"] = keys
+		}
+	}
+	variants := schema["oneOf"].([]interface{})
+
+	// The check catches a field the schema does not know about
+	var drifted interface{}
+	json.Unmarshal([]byte(`{"method":"GET","url":"/","host":"h","status_code":200,"duration_ms":1,"timestamp":"t","renamed_field":1}`), &drifted)
+	if problems := validate(variants[1].(map[string]interface{}), defs, drifted, "$"); len(problems) == 0 {
+		t.Error("an entry with an unknown field matched the schema")
+	}
+
+	file, err := os.Open(p.GetLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	lines := 0
+	for scanner.Scan() {
+		lines++
+		var line interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		// Exactly one of the session record and entry schemas must match
+		var matched int
+		var problems []string
+		for _, variant := range variants {
+			found := validate(variant.(map[string]interface{}), defs, line, "$")
+			if len(found) == 0 {
+				matched++
+			}
+			problems = append(problems, found...)
+		}
+		if matched != 1 {
+			sort.Strings(problems)
+			t.Errorf("line %d matches %d schemas:\n%s\n%s", lines, matched, scanner.Text(), strings.Join(problems, "\n"))
+		}
+	}
+	if lines != 3 {
+		t.Errorf("validated %d lines, want the session record and 2 entries", lines)
+	}
+}
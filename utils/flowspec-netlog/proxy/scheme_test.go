@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSchemeAndIntercepted(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	upstream := httptest.NewServer(handler)
+	defer upstream.Close()
+	tlsUpstream := httptest.NewTLSServer(handler)
+	defer tlsUpstream.Close()
+
+	p, client := newTestProxy(t, Options{InsecureUpstream: true})
+	skipVerify(client)
+	for _, url := range []string{upstream.URL, tlsUpstream.URL} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for i, tc := range []struct {
+		scheme      string
+		intercepted bool
+	}{
+		{"http", false},
+		{"https", true},
+	} {
+		if entry := entries[i]; entry.Scheme != tc.scheme || entry.Intercepted != tc.intercepted {
+			t.Errorf("%s: scheme %q, intercepted %v; want %q, %v", entry.URL, entry.Scheme, entry.Intercepted, tc.scheme, tc.intercepted)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elazarl/goproxy"
+)
+
+// selfAddrs identifies the proxy's own listeners, so requests routed back
+// to them can be refused: a request to the proxy port would loop through
+// the proxy forever, and one to the admin port would reach endpoints that
+// are meant to be local.
+type selfAddrs struct {
+	ports map[string]bool // ports of the proxy and admin listeners
+	hosts map[string]bool // names and addresses of this machine
+}
+
+// newSelfAddrs describes listeners at addrs (host:port, possibly ":port");
+// those without a port are skipped
+func newSelfAddrs(addrs ...string) *selfAddrs {
+	s := &selfAddrs{
+		ports: make(map[string]bool),
+		hosts: map[string]bool{"localhost": true},
+	}
+	for _, addr := range addrs {
+		if _, port, err := net.SplitHostPort(addr); err == nil && port != "" && port != "0" {
+			s.ports[port] = true
+		}
+	}
+	if name, err := os.Hostname(); err == nil {
+		s.hosts[strings.ToLower(name)] = true
+	}
+	if ifaceAddrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range ifaceAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				s.hosts[ipNet.IP.String()] = true
+			}
+		}
+	}
+	return s
+}
+
+// matches reports whether addr, a host:port, is one of the listeners
+func (s *selfAddrs) matches(addr string) bool {
+	if s == nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || !s.ports[port] {
+		return false
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback() || ip.IsUnspecified() || s.hosts[ip.String()]
+	}
+	return s.hosts[host] || strings.HasSuffix(host, ".localhost")
+}
+
+// selfReferenceResponse refuses a request addressed to the proxy itself
+func selfReferenceResponse(req *http.Request) *http.Response {
+	return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusForbidden,
+		"flowspec-netlog: requests to the proxy's own address are not allowed\n")
+}
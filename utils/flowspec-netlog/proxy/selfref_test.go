@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSelfReferenceBlocked(t *testing.T) {
+	p, addr := startTestProxy(t, Options{AdminAddr: "127.0.0.1:0"})
+	_, proxyPort, _ := net.SplitHostPort(addr)
+	_, adminPort, _ := net.SplitHostPort(p.AdminAddr())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: addr})}}
+
+	targets := []string{
+		"127.0.0.1:" + proxyPort,
+		"localhost:" + proxyPort,
+		"127.0.0.1:" + adminPort,
+	}
+	for _, target := range targets {
+		resp, err := client.Get("http://" + target + "/stats")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s: status %d, want %d", target, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+	for _, target := range targets {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("CONNECT %s: status %d, want %d", target, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2*len(targets) {
+		t.Fatalf("got %d entries, want %d", len(entries), 2*len(targets))
+	}
+	for _, entry := range entries {
+		if entry.Disposition != dispositionBlock || entry.ErrorKind != "self_reference" || entry.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: disposition %q, error kind %q, status %d; want a self-reference block",
+				entry.Method, entry.URL, entry.Disposition, entry.ErrorKind, entry.StatusCode)
+		}
+	}
+}
+
+func TestSelfAddrsMatches(t *testing.T) {
+	s := newSelfAddrs("127.0.0.1:8080", ":9090")
+	for _, tc := range []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:8080", true},
+		{"localhost:9090", true},
+		{"LOCALHOST.:8080", true},
+		{"app.localhost:8080", true},
+		{"[::1]:9090", true},
+		{"0.0.0.0:8080", true},
+		{"127.0.0.1:8081", false},
+		{"example.com:8080", false},
+		{"localhost", false},
+	} {
+		if got := s.matches(tc.addr); got != tc.want {
+			t.Errorf("matches(%q) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	shutdownTimeout = 10 * time.Second
+)
+
+// Start listens on Options.Addr (or serves Options.Listener) and the admin
+// address if configured. It returns once the listeners are ready; the
+// servers run in the background until ctx is canceled or Stop is called.
+func (p *Proxy) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.server != nil {
+		return errors.New("proxy already started")
+	}
+
+	listener := p.opts.Listener
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", p.opts.Addr); err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", p.opts.Addr, err)
+		}
+	}
+	p.listener = listener
+	p.server = p.newServer(p)
+	listener = trackedListener{listener}
+	p.server.ConnContext = p.connContext
+	enableH2C(p.server)
+	go serve(p.server, listener, "Proxy")
+
+	adminAddr := ""
+	if p.opts.AdminAddr != "" {
+		adminListener, err := net.Listen("tcp", p.opts.AdminAddr)
+		if err != nil {
+			p.server.Close()
+			return fmt.Errorf("failed to listen on admin address %s: %w", p.opts.AdminAddr, err)
+		}
+		p.adminListener = adminListener
+		p.adminServer = p.newServer(p.AdminHandler())
+		go serve(p.adminServer, adminListener, "Admin")
+		adminAddr = adminListener.Addr().String()
+	}
+	// Port 0 picks the ports only now
+	p.self.Store(newSelfAddrs(listener.Addr().String(), adminAddr))
+
+	go func() {
+		<-ctx.Done()
+		p.Stop()
+	}()
+
+	return nil
+}
+
+// newServer returns a server for handler with the configured client timeouts
+func (p *Proxy) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: serverTimeout(p.opts.ReadHeaderTimeout),
+		ReadTimeout:       serverTimeout(p.opts.ReadTimeout),
+		WriteTimeout:      serverTimeout(p.opts.WriteTimeout),
+		IdleTimeout:       serverTimeout(p.opts.IdleTimeout),
+	}
+}
+
+// serverTimeout maps a disabled (negative) timeout to http.Server's zero
+func serverTimeout(timeout time.Duration) time.Duration {
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// serve runs an HTTP server until it is shut down
+func serve(server *http.Server, listener net.Listener, name string) {
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		fmt.Printf("%s server error: %v\n", name, err)
+	}
+}
+
+// Addr returns the address the proxy is listening on, or "" before Start
+func (p *Proxy) Addr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.listener == nil {
+		return ""
+	}
+	return p.listener.Addr().String()
+}
+
+// AdminAddr returns the address the admin endpoints are listening on, or ""
+// before Start or without Options.AdminAddr
+func (p *Proxy) AdminAddr() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.adminListener == nil {
+		return ""
+	}
+	return p.adminListener.Addr().String()
+}
+
+// Stop gracefully shuts down the servers started by Start, waits for
+// in-flight captures (including intercepted and tunneled connections, which
+// the HTTP server does not track), then prints the summary and closes the
+// log. The whole sequence shares shutdownTimeout. It is safe to call more
+// than once.
+func (p *Proxy) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return nil
+	}
+	p.stopped = true
+	server, adminServer := p.server, p.adminServer
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Printf("Server shutdown error: %v\n", err)
+		}
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			fmt.Printf("Admin server shutdown error: %v\n", err)
+		}
+	}
+
+	return p.close(ctx)
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServerTimeouts(t *testing.T) {
+	for _, tc := range []struct {
+		name                          string
+		env                           map[string]string
+		readHeader, read, write, idle time.Duration
+	}{
+		{
+			name:       "defaults",
+			readHeader: defaultReadHeaderTimeout, idle: defaultIdleTimeout,
+		},
+		{
+			name: "configured",
+			env: map[string]string{
+				"FLOWSPEC_READ_HEADER_TIMEOUT": "3s",
+				"FLOWSPEC_READ_TIMEOUT":        "1m",
+				"FLOWSPEC_WRITE_TIMEOUT":       "2m",
+				"FLOWSPEC_IDLE_TIMEOUT":        "30s",
+			},
+			readHeader: 3 * time.Second, read: time.Minute, write: 2 * time.Minute, idle: 30 * time.Second,
+		},
+		{
+			name:       "disabled",
+			env:        map[string]string{"FLOWSPEC_READ_HEADER_TIMEOUT": "0", "FLOWSPEC_IDLE_TIMEOUT": "0s"},
+			readHeader: 0, idle: 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+			opts, err := OptionsFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts.AdminAddr = "127.0.0.1:0"
+			p, _ := startTestProxy(t, opts)
+
+			// The admin server gets the same timeouts
+			for name, server := range map[string]*http.Server{"proxy": p.server, "admin": p.adminServer} {
+				got := []time.Duration{server.ReadHeaderTimeout, server.ReadTimeout, server.WriteTimeout, server.IdleTimeout}
+				want := []time.Duration{tc.readHeader, tc.read, tc.write, tc.idle}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s server timeouts (read header, read, write, idle) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
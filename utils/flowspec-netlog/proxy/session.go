@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LogSchemaVersion is the version of the log format written by this build.
+// Bump it whenever RequestLog or SessionRecord fields are added, removed, or
+// change meaning.
+const LogSchemaVersion = 38
+
+// sessionRecordType marks the header record written as the first line of each log file
+const sessionRecordType = "session"
+
+// SessionRecord describes the capture session a log file belongs to. It is
+// the first line of every log file; parsers must skip it when counting requests.
+type SessionRecord struct {
+	Type          string            `json:"type"`
+	SchemaVersion int               `json:"schema_version"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	Started       string            `json:"started"`
+
+	// MetadataOnly marks a capture made with FLOWSPEC_METADATA_ONLY, which
+	// holds no bodies or credentials
+	MetadataOnly bool `json:"metadata_only,omitempty"`
+}
+
+// isSessionRecord reports whether a JSONL line is the session header record
+func isSessionRecord(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(line), []byte(`{"type":"`+sessionRecordType+`"`))
+}
+
+// checkSchemaVersion warns when path was written with a newer log schema
+// than this build understands
+func checkSchemaVersion(path string, version int) {
+	if version > LogSchemaVersion {
+		fmt.Fprintf(os.Stderr, "Warning: %s uses log schema v%d, newer than the supported v%d; unknown fields are ignored\n",
+			path, version, LogSchemaVersion)
+	}
+}
+
+// parseTags parses comma-separated key=value pairs
+func parseTags(items []string) (map[string]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	tags := make(map[string]string, len(items))
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q: want key=value", item)
+		}
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags, nil
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSessionTags(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	// An earlier session in the same directory
+	dir := t.TempDir()
+	earlier := IndexEntry{Started: "2025-12-25T12:00:00Z", LogFiles: []string{"network.20251225-120000.jsonl"}, Requests: 7}
+	data, err := json.Marshal([]IndexEntry{earlier})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, indexFileName), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := map[string]string{"branch": "main", "suite": "e2e"}
+	p, err := NewProxy(Options{LogDir: dir, SessionTags: tags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(p)
+	proxyURL, _ := url.Parse(server.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	server.Close()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(p.GetLogPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	var record SessionRecord
+	for scanner.Scan() {
+		if lines == 0 {
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lines++
+	}
+	if record.Type != sessionRecordType || !reflect.DeepEqual(record.Tags, tags) {
+		t.Errorf("first line = %+v, want the session record with tags %v", record, tags)
+	}
+
+	// The session record is not counted as a request
+	summary := p.Summary()
+	if lines != 3 || summary.Total != 2 {
+		t.Errorf("%d lines, summary total %d; want 3 lines and 2 requests", lines, summary.Total)
+	}
+	if !reflect.DeepEqual(summary.Tags, tags) {
+		t.Errorf("summary tags = %v, want %v", summary.Tags, tags)
+	}
+
+	index, err := ReadIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 2 || !reflect.DeepEqual(index[0], earlier) {
+		t.Fatalf("index = %+v, want the earlier session followed by this one", index)
+	}
+	entry := index[1]
+	if entry.Started != record.Started || !reflect.DeepEqual(entry.Tags, tags) || entry.Requests != 2 {
+		t.Errorf("index entry = %+v, want started %s, tags %v, and 2 requests", entry, record.Started, tags)
+	}
+	if want := []string{filepath.Base(p.GetLogPath())}; !reflect.DeepEqual(entry.LogFiles, want) {
+		t.Errorf("index log files = %v, want %v", entry.LogFiles, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, entry.SummaryFile)); entry.SummaryFile == "" || err != nil {
+		t.Errorf("index summary file %q: %v", entry.SummaryFile, err)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	// A current capture converts without a warning and keeps its version
+	p, client := newTestProxy(t, Options{LogFormat: logFormatGob})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	warnings := captureStderr(t, func() {
+		if err := ConvertToJSONL(&out, p.GetLogPath()); err != nil {
+			t.Fatal(err)
+		}
+	})
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	var record SessionRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || record.Type != sessionRecordType || record.SchemaVersion != LogSchemaVersion {
+		t.Errorf("converted %q, want the session record with schema_version %d and one entry", lines, LogSchemaVersion)
+	}
+	if warnings != "" {
+		t.Errorf("converting a current capture warned: %s", warnings)
+	}
+
+	// A newer one converts unchanged, with a warning from convert and summarize
+	newer := fmt.Sprintf(`{"type":"session","schema_version":%d,"started":"2025-12-25T12:00:00Z"}`, LogSchemaVersion+1) + "\n" +
+		`{"timestamp":"2025-12-25T12:00:00Z","method":"GET","url":"https://api.example.com/","host":"api.example.com","status_code":200,"future_field":true}` + "\n"
+	path := filepath.Join(t.TempDir(), "network.newer.jsonl")
+	if err := os.WriteFile(path, []byte(newer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	warnings = captureStderr(t, func() {
+		if err := ConvertToJSONL(&out, path); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if out.String() != newer {
+		t.Errorf("converted %q, want %q", out.String(), newer)
+	}
+	if want := fmt.Sprintf("log schema v%d, newer than the supported v%d", LogSchemaVersion+1, LogSchemaVersion); !strings.Contains(warnings, want) {
+		t.Errorf("convert warning = %q, want %q", warnings, want)
+	}
+
+	var summary *SessionSummary
+	warnings = captureStderr(t, func() {
+		if summary, err = SummarizeFiles(path); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if summary.SchemaVersion != LogSchemaVersion+1 || summary.Total != 1 || !strings.Contains(warnings, "newer than") {
+		t.Errorf("summary schema v%d, total %d, warning %q; want v%d, 1, and a warning",
+			summary.SchemaVersion, summary.Total, warnings, LogSchemaVersion+1)
+	}
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Sink receives every entry the Logger writes. The Logger serializes calls,
+// so implementations need no locking of their own.
+type Sink interface {
+	Write(log *RequestLog) error
+	Close() error
+}
+
+// rotatingSink is a Sink that starts new files at rotation boundaries
+type rotatingSink interface {
+	rotate(timestamp string) error
+}
+
+// filesSink is a Sink that writes log files read back by the summary
+type filesSink interface {
+	files() []string
+}
+
+// newLogEncoder returns an encoder for log records. Bodies and URLs are
+// written verbatim rather than with <, >, and & escaped. Indented output
+// (FLOWSPEC_PRETTY_LOG) is easier to read but no longer one record per line.
+func newLogEncoder(w io.Writer, pretty bool) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
+}
+
+// FileSink writes entries as JSONL to network.<timestamp>.jsonl in a
+// directory, starting each file with the session record. It is the default
+// output. With FLOWSPEC_LOG_FORMAT=gob it writes network.<timestamp>.gob.
+type FileSink struct {
+	dir     string
+	session *SessionRecord
+	budget  int64
+	maxLogs int
+	pretty  bool
+	format  string
+	file    *os.File
+	encoder logEncoder
+	path    string
+	paths   []string
+
+	// buffered writes go through buf, which the owner must flush
+	buffered bool
+	buf      *bufio.Writer
+}
+
+// NewFileSink creates dir/network.<timestamp>.jsonl. When diskBudget is
+// positive the oldest log files in dir are deleted each time a file is opened
+// to keep their combined size under it. pretty indents each record.
+func NewFileSink(dir, timestamp string, session *SessionRecord, diskBudget int64, pretty bool) (*FileSink, error) {
+	return newFileSink(dir, timestamp, session, diskBudget, 0, pretty, logFormatJSONL, false)
+}
+
+// newFileSink is NewFileSink writing format, logFormatJSONL or logFormatGob.
+// A buffered sink writes through a bufio.Writer the caller must flush. When
+// maxLogs is positive, the oldest log files beyond that many besides the
+// active one are deleted each time a file is opened.
+func newFileSink(dir, timestamp string, session *SessionRecord, diskBudget int64, maxLogs int, pretty bool, format string, buffered bool) (*FileSink, error) {
+	s := &FileSink{dir: dir, session: session, budget: diskBudget, maxLogs: maxLogs, pretty: pretty, format: format, buffered: buffered}
+	if err := s.open(timestamp); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// pathFor returns the path of the file started at timestamp
+func (s *FileSink) pathFor(timestamp string) string {
+	ext := logFormatJSONL
+	if s.format == logFormatGob {
+		ext = logFormatGob
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("network.%s.%s", timestamp, ext))
+}
+
+// open makes network.<timestamp>.jsonl the active file, starting it with the
+// session record
+func (s *FileSink) open(timestamp string) error {
+	path := s.pathFor(timestamp)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %w", err)
+	}
+
+	var w io.Writer = file
+	var buf *bufio.Writer
+	if s.buffered {
+		buf = bufio.NewWriter(file)
+		w = buf
+	}
+	var encoder logEncoder = newLogEncoder(w, s.pretty)
+	if s.format == logFormatGob {
+		if encoder, err = newGobLogEncoder(w); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to start log file: %w", err)
+		}
+	}
+	if s.session != nil {
+		if err := encoder.Encode(s.session); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write session record: %w", err)
+		}
+	}
+
+	s.file = file
+	s.encoder = encoder
+	s.buf = buf
+	s.path = path
+	s.paths = append(s.paths, path)
+
+	// Both limits apply when set, so the stricter one decides
+	if s.maxLogs > 0 {
+		evicted, err := enforceMaxLogFiles(s.dir, s.path, s.maxLogs)
+		if err != nil {
+			fmt.Printf("Warning: log file limit enforcement failed: %v\n", err)
+		}
+		s.forget(evicted)
+	}
+	if s.budget > 0 {
+		evicted, err := enforceDiskBudget(s.dir, s.path, s.budget)
+		if err != nil {
+			fmt.Printf("Warning: disk budget enforcement failed: %v\n", err)
+		}
+		s.forget(evicted)
+	}
+	return nil
+}
+
+// forget drops deleted files from those this sink has written, so the
+// session summary does not look for them
+func (s *FileSink) forget(deleted []string) {
+	if len(deleted) == 0 {
+		return
+	}
+	gone := make(map[string]bool, len(deleted))
+	for _, path := range deleted {
+		gone[path] = true
+	}
+	paths := s.paths[:0]
+	for _, path := range s.paths {
+		if !gone[path] {
+			paths = append(paths, path)
+		}
+	}
+	s.paths = paths
+}
+
+// Write appends log to the active file
+func (s *FileSink) Write(log *RequestLog) error {
+	return s.encoder.Encode(log)
+}
+
+// Close closes the active file
+func (s *FileSink) Close() error {
+	if err := s.flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// flush writes buffered entries to the active file
+func (s *FileSink) flush() error {
+	if s.buf == nil {
+		return nil
+	}
+	return s.buf.Flush()
+}
+
+// Path returns the path of the active file
+func (s *FileSink) Path() string {
+	return s.path
+}
+
+// files returns every file written, including those closed by rotation
+func (s *FileSink) files() []string {
+	return append([]string(nil), s.paths...)
+}
+
+// rotate closes the active file and starts a new one named after timestamp.
+// On failure it keeps writing to the current file rather than losing entries.
+func (s *FileSink) rotate(timestamp string) error {
+	previous := s.file
+	if s.pathFor(timestamp) == s.path {
+		return nil
+	}
+	if err := s.flush(); err != nil {
+		return fmt.Errorf("failed to flush log before rotating: %w", err)
+	}
+	if err := s.open(timestamp); err != nil {
+		return err
+	}
+	if err := previous.Close(); err != nil {
+		return fmt.Errorf("failed to close rotated log: %w", err)
+	}
+	return nil
+}
+
+// writerSink streams entries as JSONL to an io.Writer such as stdout
+type writerSink struct {
+	encoder *json.Encoder
+}
+
+// newWriterSink starts w with the session record
+func newWriterSink(w io.Writer, session *SessionRecord, pretty bool) (*writerSink, error) {
+	encoder := newLogEncoder(w, pretty)
+	if err := encoder.Encode(session); err != nil {
+		return nil, fmt.Errorf("failed to write session record: %w", err)
+	}
+	return &writerSink{encoder: encoder}, nil
+}
+
+// Write encodes log to the writer
+func (s *writerSink) Write(log *RequestLog) error {
+	return s.encoder.Encode(log)
+}
+
+// Close is a no-op; the writer belongs to the caller
+func (s *writerSink) Close() error {
+	return nil
+}
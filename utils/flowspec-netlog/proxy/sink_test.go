@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// memorySink keeps the entries written to it
+type memorySink struct {
+	entries []*RequestLog
+	err     error
+	closed  bool
+}
+
+func (s *memorySink) Write(log *RequestLog) error {
+	s.entries = append(s.entries, log)
+	return s.err
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSinks(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	// A failing sink does not keep entries from the others
+	first := &memorySink{err: errors.New("sink unavailable")}
+	second := &memorySink{}
+	p, client := newTestProxy(t, Options{Sinks: []Sink{first, second}})
+	for _, path := range []string{"/a", "/b", "/c"} {
+		resp, err := client.Get(upstream.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	entries := closeAndRead(t, p)
+
+	if len(entries) != 3 {
+		t.Fatalf("log file has %d entries, want 3", len(entries))
+	}
+	for name, sink := range map[string]*memorySink{"first": first, "second": second} {
+		if len(sink.entries) != len(entries) {
+			t.Errorf("%s sink got %d entries, want %d", name, len(sink.entries), len(entries))
+			continue
+		}
+		for i, entry := range sink.entries {
+			if entry.URL != entries[i].URL {
+				t.Errorf("%s sink entry %d = %s, want %s", name, i, entry.URL, entries[i].URL)
+			}
+		}
+		if !sink.closed {
+			t.Errorf("%s sink not closed with the proxy", name)
+		}
+	}
+}
+
+// slowSink takes delay to write each entry
+type slowSink struct {
+	memorySink
+	delay time.Duration
+}
+
+func (s *slowSink) Write(log *RequestLog) error {
+	time.Sleep(s.delay)
+	return s.memorySink.Write(log)
+}
+
+func TestOverheadWithSlowSink(t *testing.T) {
+	const upstreamDelay, sinkDelay = 100 * time.Millisecond, 200 * time.Millisecond
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(upstreamDelay)
+	}))
+	defer upstream.Close()
+
+	slow := &slowSink{delay: sinkDelay}
+	after := &memorySink{}
+	p, client := newTestProxy(t, Options{Sinks: []Sink{slow, after}})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 || len(after.entries) != 1 {
+		t.Fatalf("got %d logged and %d sink entries, want 1 each", len(entries), len(after.entries))
+	}
+	logged, stamped := entries[0], after.entries[0]
+
+	// The slow sink counts as overhead for the sink after it...
+	if stamped.ProxyOverheadMs < float64(sinkDelay.Milliseconds()) {
+		t.Errorf("overhead after the slow sink = %.1fms, want at least %dms", stamped.ProxyOverheadMs, sinkDelay.Milliseconds())
+	}
+	if logged.ProxyOverheadMs >= float64(sinkDelay.Milliseconds()) {
+		t.Errorf("overhead in the log file = %.1fms, want it without the slow sink", logged.ProxyOverheadMs)
+	}
+	// ...while the duration still only times the upstream
+	if logged.Duration < upstreamDelay.Milliseconds() || logged.Duration >= sinkDelay.Milliseconds() {
+		t.Errorf("duration = %dms, want about the upstream's %dms", logged.Duration, upstreamDelay.Milliseconds())
+	}
+	if stamped.Duration != logged.Duration {
+		t.Errorf("sink duration = %dms, want the logged %dms", stamped.Duration, logged.Duration)
+	}
+}
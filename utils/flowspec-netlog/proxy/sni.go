@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+const (
+	tlsRecordHeaderLen = 5
+	tlsMaxRecordLen    = 16384 // largest plaintext record, which a ClientHello is
+
+	tlsHandshakeClientHello = 0x01
+	tlsExtensionServerName  = 0x0000
+	tlsServerNameHost       = 0x00
+)
+
+// peekSNI reads the server name from the client's TLS ClientHello without
+// consuming it, so the tunnel still relays every byte. It returns the
+// connection to relay, which replays the peeked bytes, and "" when the
+// client sent no ClientHello in time or it carries no SNI.
+func peekSNI(client net.Conn) (net.Conn, string) {
+	client.SetReadDeadline(time.Now().Add(connectSniffTimeout))
+	defer client.SetReadDeadline(time.Time{})
+
+	reader := bufio.NewReaderSize(client, tlsRecordHeaderLen+tlsMaxRecordLen)
+	conn := &sniffedConn{Conn: client, reader: reader}
+	header, err := reader.Peek(tlsRecordHeaderLen)
+	if err != nil || header[0] != tlsRecordHandshake {
+		return conn, ""
+	}
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	if length > tlsMaxRecordLen {
+		return conn, ""
+	}
+	record, err := reader.Peek(tlsRecordHeaderLen + length)
+	if err != nil {
+		return conn, ""
+	}
+	return conn, clientHelloServerName(record[tlsRecordHeaderLen:])
+}
+
+// clientHelloServerName returns the host_name of the server_name extension
+// in a ClientHello handshake message, or "" if it has none. A ClientHello
+// spanning several records is read as far as the first one goes.
+func clientHelloServerName(msg []byte) string {
+	b := tlsBytes(msg)
+	if typ, ok := b.uint8(); !ok || typ != tlsHandshakeClientHello {
+		return ""
+	}
+	if !b.skip(3 + 2 + 32) { // length, client_version, random
+		return ""
+	}
+	if !b.skipVector(1) || !b.skipVector(2) || !b.skipVector(1) { // session_id, cipher_suites, compression_methods
+		return ""
+	}
+	extensions, ok := b.vector(2)
+	if !ok {
+		// The ClientHello continues in the next record; b is past the
+		// extensions length, so parse the extensions it holds
+		extensions = b
+	}
+	for len(extensions) > 0 {
+		typ, ok := extensions.uint16()
+		if !ok {
+			return ""
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return ""
+		}
+		if typ != tlsExtensionServerName {
+			continue
+		}
+		names, ok := data.vector(2)
+		if !ok {
+			return ""
+		}
+		for len(names) > 0 {
+			nameType, ok := names.uint8()
+			if !ok {
+				return ""
+			}
+			name, ok := names.vector(2)
+			if !ok {
+				return ""
+			}
+			if nameType == tlsServerNameHost {
+				return string(name)
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// tlsBytes reads the big-endian fields of a TLS message, consuming them
+type tlsBytes []byte
+
+func (b *tlsBytes) skip(n int) bool {
+	if len(*b) < n {
+		return false
+	}
+	*b = (*b)[n:]
+	return true
+}
+
+func (b *tlsBytes) uint8() (int, bool) {
+	if len(*b) < 1 {
+		return 0, false
+	}
+	v := int((*b)[0])
+	*b = (*b)[1:]
+	return v, true
+}
+
+func (b *tlsBytes) uint16() (int, bool) {
+	if len(*b) < 2 {
+		return 0, false
+	}
+	v := int(binary.BigEndian.Uint16(*b))
+	*b = (*b)[2:]
+	return v, true
+}
+
+// vector consumes a value prefixed by its length in lenBytes bytes
+func (b *tlsBytes) vector(lenBytes int) (tlsBytes, bool) {
+	var n int
+	var ok bool
+	if lenBytes == 1 {
+		n, ok = b.uint8()
+	} else {
+		n, ok = b.uint16()
+	}
+	if !ok || len(*b) < n {
+		return nil, false
+	}
+	v := (*b)[:n]
+	*b = (*b)[n:]
+	return v, true
+}
+
+func (b *tlsBytes) skipVector(lenBytes int) bool {
+	_, ok := b.vector(lenBytes)
+	return ok
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTunnelSNI(t *testing.T) {
+	upstream := httptest.NewTLSServer(nil)
+	defer upstream.Close()
+	target := strings.TrimPrefix(upstream.URL, "https://")
+
+	for _, tc := range []struct {
+		name       string
+		serverName string
+		want       string
+	}{
+		{"known SNI", "api.example.test", "api.example.test"},
+		// Go sends no SNI when the server name is an IP
+		{"no SNI", "127.0.0.1", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Only other hosts are intercepted, so the CONNECT is tunneled
+			p, addr := startTestProxy(t, Options{TunnelSNI: true, MITMHosts: []string{"example.com"}})
+			conn := connectTLS(t, addr, target, &tls.Config{ServerName: tc.serverName, InsecureSkipVerify: true})
+			conn.Close()
+
+			entries := closeAndRead(t, p)
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			if entry := entries[0]; !entry.Tunnel || entry.SNI != tc.want {
+				t.Errorf("entry tunnel %v, SNI %q; want a tunnel with SNI %q", entry.Tunnel, entry.SNI, tc.want)
+			}
+		})
+	}
+}
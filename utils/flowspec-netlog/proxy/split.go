@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	maxOpenHostFiles = 32 // per-host log files kept open at once
+)
+
+// hostFile is an open per-host log file
+type hostFile struct {
+	host    string
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// hostFiles routes entries to one network.<host>.<timestamp>.jsonl file per
+// host. Files are opened lazily; when more than maxOpen are open the least
+// recently written one is closed and reopened for append on its next entry.
+// Callers serialize access (Logger.mu).
+type hostFiles struct {
+	dir       string
+	timestamp string
+	pretty    bool
+	maxOpen   int
+	lru       *list.List // of *hostFile, most recently used first
+	open      map[string]*list.Element
+	paths     map[string]string
+	rotated   []string
+	session   *SessionRecord
+}
+
+// newHostFiles creates a router writing files into dir, each starting with
+// the session record
+func newHostFiles(dir, timestamp string, session *SessionRecord, pretty bool) *hostFiles {
+	return &hostFiles{
+		dir:       dir,
+		timestamp: timestamp,
+		pretty:    pretty,
+		maxOpen:   maxOpenHostFiles,
+		lru:       list.New(),
+		open:      make(map[string]*list.Element),
+		paths:     make(map[string]string),
+		session:   session,
+	}
+}
+
+// checkSplitByHost rejects the options per-host files do not support:
+// retention limits, the gob format, and asynchronous writes apply to the
+// combined log file only
+func checkSplitByHost(opts Options) error {
+	if !opts.SplitByHost {
+		return nil
+	}
+	for _, conflict := range []struct {
+		set  bool
+		name string
+	}{
+		{opts.DiskBudget > 0, "FLOWSPEC_DISK_BUDGET"},
+		{opts.MaxLogFiles > 0, "FLOWSPEC_MAX_LOG_FILES"},
+		{opts.LogFormat == logFormatGob, "FLOWSPEC_LOG_FORMAT=gob"},
+		{opts.AsyncWrites, "FLOWSPEC_ASYNC_WRITES"},
+	} {
+		if conflict.set {
+			return fmt.Errorf("FLOWSPEC_SPLIT_BY_HOST cannot be combined with %s", conflict.name)
+		}
+	}
+	return nil
+}
+
+// hostFileName makes a host safe to embed in a file name, e.g.
+// "api.example.com:8443" becomes "api.example.com_8443". Hosts with any other
+// character outside [a-z0-9.-] get a short hash of the original appended, so
+// "a_80" and "a:80" do not share a file
+func hostFileName(host string) string {
+	host = strings.ToLower(host)
+	if host == "" {
+		return "unknown"
+	}
+	port := strings.LastIndexByte(host, ':')
+	mangled := false
+	var name strings.Builder
+	for i, r := range host {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			name.WriteRune(r)
+			continue
+		}
+		if i != port {
+			mangled = true
+		}
+		name.WriteByte('_')
+	}
+	if !mangled {
+		return name.String()
+	}
+	sum := sha256.Sum256([]byte(host))
+	return name.String() + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Write appends log to its host's file
+func (h *hostFiles) Write(log *RequestLog) error {
+	f, err := h.get(hostFileName(log.Host))
+	if err != nil {
+		return err
+	}
+	return f.encoder.Encode(log)
+}
+
+// get returns the open file for host, opening it and evicting the least
+// recently used file if needed
+func (h *hostFiles) get(host string) (*hostFile, error) {
+	if elem, ok := h.open[host]; ok {
+		h.lru.MoveToFront(elem)
+		return elem.Value.(*hostFile), nil
+	}
+
+	path, reopen := h.paths[host]
+	if !reopen {
+		path = filepath.Join(h.dir, fmt.Sprintf("network.%s.%s.jsonl", host, h.timestamp))
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log file: %w", err)
+	}
+
+	f := &hostFile{host: host, file: file, encoder: newLogEncoder(file, h.pretty)}
+	if !reopen && h.session != nil {
+		if err := f.encoder.Encode(h.session); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write session record: %w", err)
+		}
+	}
+	h.paths[host] = path
+
+	for h.lru.Len() >= h.maxOpen {
+		h.evict(h.lru.Back())
+	}
+	h.open[host] = h.lru.PushFront(f)
+	return f, nil
+}
+
+// evict closes an open file
+func (h *hostFiles) evict(elem *list.Element) error {
+	f := h.lru.Remove(elem).(*hostFile)
+	delete(h.open, f.host)
+	return f.file.Close()
+}
+
+// files returns the paths of every file written so far, sorted
+func (h *hostFiles) files() []string {
+	paths := append([]string(nil), h.rotated...)
+	for _, path := range h.paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// rotate closes every host file; later entries go to files named with timestamp
+func (h *hostFiles) rotate(timestamp string) error {
+	err := h.Close()
+	for _, path := range h.paths {
+		h.rotated = append(h.rotated, path)
+	}
+	h.paths = make(map[string]string)
+	h.timestamp = timestamp
+	return err
+}
+
+// Close closes all open files
+func (h *hostFiles) Close() error {
+	var firstErr error
+	for h.lru.Len() > 0 {
+		if err := h.evict(h.lru.Front()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
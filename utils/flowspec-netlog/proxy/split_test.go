@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitByHostConflicts(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"FLOWSPEC_DISK_BUDGET", Options{DiskBudget: 1 << 20}},
+		{"FLOWSPEC_MAX_LOG_FILES", Options{MaxLogFiles: 3}},
+		{"FLOWSPEC_LOG_FORMAT=gob", Options{LogFormat: logFormatGob}},
+		{"FLOWSPEC_ASYNC_WRITES", Options{AsyncWrites: true}},
+	} {
+		tc.opts.SplitByHost = true
+		tc.opts.LogDir = t.TempDir()
+		_, err := NewLogger(tc.opts)
+		if err == nil || !strings.Contains(err.Error(), tc.name) {
+			t.Errorf("%s: NewLogger error = %v", tc.name, err)
+		}
+	}
+
+	logger, err := NewLogger(Options{SplitByHost: true, LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("split by host alone: %v", err)
+	}
+	logger.Close()
+}
+
+func TestSplitByHostFiles(t *testing.T) {
+	p, client := newTestProxy(t, Options{SplitByHost: true})
+
+	var hosts []string
+	for i := 0; i < 3; i++ {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer upstream.Close()
+		hosts = append(hosts, strings.TrimPrefix(upstream.URL, "http://"))
+		for j := 0; j <= i; j++ {
+			resp, err := client.Get(fmt.Sprintf("%s/%d", upstream.URL, j))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(p.opts.LogDir, "network.*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(hosts) {
+		t.Fatalf("files = %v, want one per host %v", files, hosts)
+	}
+	for i, host := range hosts {
+		path := filepath.Join(p.opts.LogDir, "network."+hostFileName(host)+".")
+		var entries []*RequestLog
+		for _, file := range files {
+			if strings.HasPrefix(file, path) {
+				if entries, err = readEntries(file); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if len(entries) != i+1 {
+			t.Errorf("%s: %d entries, want %d", host, len(entries), i+1)
+		}
+		for _, entry := range entries {
+			if entry.Host != host {
+				t.Errorf("%s file holds an entry for %s", host, entry.Host)
+			}
+		}
+	}
+}
+
+func TestHostFileName(t *testing.T) {
+	for _, tc := range []struct{ host, want string }{
+		{"", "unknown"},
+		{"API.Example.com", "api.example.com"},
+		{"api.example.com:8443", "api.example.com_8443"},
+	} {
+		if got := hostFileName(tc.host); got != tc.want {
+			t.Errorf("hostFileName(%q) = %q, want %q", tc.host, got, tc.want)
+		}
+	}
+
+	// Hosts that differ only in disallowed characters keep separate files
+	seen := make(map[string]string)
+	for _, host := range []string{"a:80", "a_80", "a/80", "[::1]:80", "[::1]_80"} {
+		name := hostFileName(host)
+		if other, ok := seen[name]; ok {
+			t.Errorf("hostFileName(%q) = hostFileName(%q) = %q", host, other, name)
+		}
+		seen[name] = host
+	}
+}
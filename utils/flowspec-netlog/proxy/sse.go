@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSSEEvents = 100 // Server-Sent Events captured per stream
+)
+
+// isEventStream reports whether a content type is text/event-stream
+func isEventStream(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// sseTap forwards a Server-Sent Events stream unchanged while recording its
+// first maxEvents events. An event is the block of lines up to a blank line;
+// at most maxBytes of event text is kept in total. onDone runs once when the
+// stream ends or is closed.
+type sseTap struct {
+	mu        sync.Mutex
+	body      io.ReadCloser
+	line      []byte
+	event     []byte
+	events    []string
+	maxEvents int
+	maxBytes  int
+	captured  int
+	done      bool
+	onDone    func(events []string)
+}
+
+// newSSETap wraps an event stream body
+func newSSETap(body io.ReadCloser, maxEvents, maxBytes int, onDone func([]string)) *sseTap {
+	return &sseTap{
+		body:      body,
+		maxEvents: maxEvents,
+		maxBytes:  maxBytes,
+		onDone:    onDone,
+	}
+}
+
+// Read implements io.Reader
+func (t *sseTap) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	t.feed(p[:n])
+	if err == io.EOF {
+		t.finish()
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (t *sseTap) Close() error {
+	err := t.body.Close()
+	t.finish()
+	return err
+}
+
+// feed splits the stream into lines and lines into events
+func (t *sseTap) feed(p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(p) > 0 && len(t.events) < t.maxEvents {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.line = appendCapped(t.line, p, t.maxBytes)
+			return
+		}
+		t.line = appendCapped(t.line, p[:i], t.maxBytes)
+		p = p[i+1:]
+
+		line := bytes.TrimSuffix(t.line, []byte("\r"))
+		t.line = t.line[:0]
+		if len(line) > 0 {
+			t.event = t.keep(t.event, line)
+			t.event = t.keep(t.event, []byte("\n"))
+			continue
+		}
+
+		// A blank line dispatches the event
+		if len(t.event) > 0 {
+			t.events = append(t.events, strings.TrimSuffix(string(t.event), "\n"))
+			t.event = t.event[:0]
+		}
+	}
+}
+
+// appendCapped appends b to dst without growing it past limit bytes
+func appendCapped(dst, b []byte, limit int) []byte {
+	if room := limit - len(dst); room < len(b) {
+		if room <= 0 {
+			return dst
+		}
+		b = b[:room]
+	}
+	return append(dst, b...)
+}
+
+// keep appends b to dst while the total captured size stays within maxBytes
+func (t *sseTap) keep(dst, b []byte) []byte {
+	room := t.maxBytes - t.captured
+	if room <= 0 {
+		return dst
+	}
+	if len(b) > room {
+		b = b[:room]
+	}
+	t.captured += len(b)
+	return append(dst, b...)
+}
+
+// finish runs the completion callback exactly once. A trailing event that
+// was never terminated by a blank line is discarded, as a client would.
+func (t *sseTap) finish() {
+	t.mu.Lock()
+	if t.done {
+		t.mu.Unlock()
+		return
+	}
+	t.done = true
+	events := t.events
+	t.mu.Unlock()
+
+	if t.onDone != nil {
+		t.onDone(events)
+	}
+}
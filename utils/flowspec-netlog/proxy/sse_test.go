@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSECapture(t *testing.T) {
+	const total = 5
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; i < total; i++ {
+			fmt.Fprintf(w, "event: tick\ndata: %d\n\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-next:
+			case <-time.After(5 * time.Second):
+				return
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{SSEEvents: 2})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Each event reaches the client before the upstream sends the next one
+	reader := bufio.NewReader(resp.Body)
+	for i := 0; i < total; i++ {
+		var event []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("event %d: %v", i, err)
+			}
+			if line == "\n" {
+				break
+			}
+			event = append(event, strings.TrimSuffix(line, "\n"))
+		}
+		if want := fmt.Sprintf("data: %d", i); len(event) != 2 || event[1] != want {
+			t.Fatalf("event %d = %q, want %q", i, event, want)
+		}
+		next <- struct{}{}
+	}
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	want := []string{"event: tick\ndata: 0", "event: tick\ndata: 1"}
+	if !reflect.DeepEqual(entries[0].Events, want) {
+		t.Errorf("Events = %q, want %q", entries[0].Events, want)
+	}
+}
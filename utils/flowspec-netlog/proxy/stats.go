@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// statsLatencyWindow is the number of latest durations /stats computes
+// percentiles over
+const statsLatencyWindow = 10000
+
+// Stats is the /stats snapshot of the entries logged since the proxy
+// started or the counters were last reset
+type Stats struct {
+	Since         string         `json:"since"`
+	Total         int            `json:"total"`
+	Errors        int            `json:"errors"`
+	Methods       map[string]int `json:"methods"`
+	StatusClasses map[string]int `json:"status_classes"`
+	TopHosts      []HostCount    `json:"top_hosts"`
+	ErrorsByKind  map[string]int `json:"errors_by_kind"`
+	Latency       LatencyStats   `json:"latency_ms"`
+}
+
+// HostCount is the request count of a host
+type HostCount struct {
+	Host  string `json:"host"`
+	Count int    `json:"count"`
+}
+
+// statsCounter keeps the /stats counters in memory as entries are written
+type statsCounter struct {
+	mu           sync.Mutex
+	since        time.Time
+	total        int
+	errors       int
+	methods      map[string]int
+	statuses     map[string]int
+	hosts        map[string]int
+	errorsByKind map[string]int
+	durations    []int64 // ring of the latest statsLatencyWindow
+	next         int
+}
+
+// newStatsCounter returns zeroed counters starting now
+func newStatsCounter() *statsCounter {
+	s := &statsCounter{}
+	s.reset()
+	return s
+}
+
+// reset zeroes the counters; s.mu must be held or s unshared
+func (s *statsCounter) reset() {
+	s.since = time.Now()
+	s.total, s.errors = 0, 0
+	s.methods = make(map[string]int)
+	s.statuses = make(map[string]int)
+	s.hosts = make(map[string]int)
+	s.errorsByKind = make(map[string]int)
+	s.durations = s.durations[:0]
+	s.next = 0
+}
+
+// add counts a written entry the way the session summary does
+func (s *statsCounter) add(log *RequestLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.total++
+	if log.Error != "" {
+		s.errors++
+	}
+	if kind := errorKind(log); kind != "" {
+		s.errorsByKind[kind]++
+	}
+	if log.StatusCode > 0 {
+		s.statuses[fmt.Sprintf("%dxx", log.StatusCode/100)]++
+		if len(s.durations) < statsLatencyWindow {
+			s.durations = append(s.durations, log.Duration)
+		} else {
+			s.durations[s.next] = log.Duration
+			s.next = (s.next + 1) % statsLatencyWindow
+		}
+	}
+	s.methods[log.Method]++
+	s.hosts[log.Host]++
+}
+
+// snapshot returns the current counters, zeroing them after with reset
+func (s *statsCounter) snapshot(reset bool) *Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	durations := append([]int64(nil), s.durations...)
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats := &Stats{
+		Since:         s.since.Format(time.RFC3339),
+		Total:         s.total,
+		Errors:        s.errors,
+		Methods:       s.methods,
+		StatusClasses: s.statuses,
+		TopHosts:      topHosts(s.hosts, summaryTopN),
+		ErrorsByKind:  s.errorsByKind,
+		Latency: LatencyStats{
+			Count: len(durations),
+			P50:   percentile(durations, 50),
+			P90:   percentile(durations, 90),
+			P95:   percentile(durations, 95),
+			P99:   percentile(durations, 99),
+			Max:   percentile(durations, 100),
+		},
+	}
+	if reset {
+		s.reset()
+	} else {
+		stats.Methods = copyCounts(s.methods)
+		stats.StatusClasses = copyCounts(s.statuses)
+		stats.ErrorsByKind = copyCounts(s.errorsByKind)
+	}
+	return stats
+}
+
+// copyCounts returns a copy of counts, which the counter keeps updating
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for key, count := range counts {
+		copied[key] = count
+	}
+	return copied
+}
+
+// topHosts returns the n busiest hosts, ties broken by host
+func topHosts(counts map[string]int, n int) []HostCount {
+	top := make([]HostCount, 0, len(counts))
+	for host, count := range counts {
+		top = append(top, HostCount{Host: host, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Host < top[j].Host
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
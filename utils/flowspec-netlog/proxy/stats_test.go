@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// getStats fetches /stats from p's admin handler
+func getStats(t *testing.T, p *Proxy, query string) *Stats {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	p.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stats"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/stats%s: status %d", query, rec.Code)
+	}
+	var stats Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	return &stats
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := l.Addr().String()
+	l.Close()
+
+	p, client := newTestProxy(t, Options{})
+	for _, req := range []struct{ method, url string }{
+		{"GET", upstream.URL + "/a"},
+		{"GET", upstream.URL + "/b"},
+		{"GET", upstream.URL + "/c"},
+		{"POST", upstream.URL + "/missing"},
+		{"GET", "http://" + refused + "/"},
+	} {
+		r, err := http.NewRequest(req.method, req.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	stats := getStats(t, p, "")
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+	if stats.Total != 5 || stats.Errors != 1 {
+		t.Errorf("total %d, errors %d; want 5 and 1", stats.Total, stats.Errors)
+	}
+	if want := map[string]int{"GET": 4, "POST": 1}; !reflect.DeepEqual(stats.Methods, want) {
+		t.Errorf("methods = %v, want %v", stats.Methods, want)
+	}
+	// The failed request has no status, so no latency either
+	if want := map[string]int{"2xx": 3, "4xx": 1}; !reflect.DeepEqual(stats.StatusClasses, want) {
+		t.Errorf("status classes = %v, want %v", stats.StatusClasses, want)
+	}
+	if stats.Latency.Count != 4 {
+		t.Errorf("latency count = %d, want 4", stats.Latency.Count)
+	}
+	if want := []HostCount{{upstreamHost, 4}, {refused, 1}}; !reflect.DeepEqual(stats.TopHosts, want) {
+		t.Errorf("top hosts = %v, want %v", stats.TopHosts, want)
+	}
+	if want := map[string]int{"connection_refused": 1, "4xx": 1}; !reflect.DeepEqual(stats.ErrorsByKind, want) {
+		t.Errorf("errors by kind = %v, want %v", stats.ErrorsByKind, want)
+	}
+
+	// A reset answers with the counters, then zeroes them
+	if reset := getStats(t, p, "?reset=true"); reset.Total != 5 {
+		t.Errorf("reset answered total %d, want 5", reset.Total)
+	}
+	after := getStats(t, p, "")
+	if after.Total != 0 || after.Errors != 0 || len(after.Methods) != 0 || len(after.StatusClasses) != 0 ||
+		len(after.TopHosts) != 0 || len(after.ErrorsByKind) != 0 || after.Latency.Count != 0 {
+		t.Errorf("after reset: %+v, want all zero", after)
+	}
+}
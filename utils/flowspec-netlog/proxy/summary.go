@@ -0,0 +1,613 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SessionSummary aggregates the entries of a capture session
+type SessionSummary struct {
+	LogFile       string            `json:"log_file"`
+	LogFiles      []string          `json:"log_files,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	GeneratedAt   string            `json:"generated_at"`
+	Total         int               `json:"total"`
+	Errors        int               `json:"errors"`
+	Bypassed      int               `json:"bypassed"`
+	Tunnels       int               `json:"tunnels"`
+	Dispositions  map[string]int    `json:"dispositions,omitempty"`
+	Dropped       map[string]int    `json:"dropped,omitempty"`
+	NoiseFiltered int64             `json:"noise_filtered,omitempty"`
+	PausedSkipped int64             `json:"paused_skipped,omitempty"`
+	WriteDropped  int64             `json:"write_dropped,omitempty"`
+	ParseErrors   int               `json:"parse_errors,omitempty"`
+	Methods       map[string]int    `json:"methods"`
+	Hosts         map[string]int    `json:"hosts"`
+	Sources       map[string]int    `json:"sources,omitempty"`
+	UserAgents    map[string]int    `json:"user_agents,omitempty"`
+	ErrorsByKind  map[string]int    `json:"errors_by_kind"`
+	StatusClasses map[string]int    `json:"status_classes"`
+	TopStatuses   []StatusCount     `json:"top_statuses"`
+	TopPaths      []PathCount       `json:"top_paths"`
+	Latency       LatencyStats      `json:"latency_ms"`
+
+	// MultipleIPs lists the hosts that resolved to more than one distinct
+	// address during the session, with the addresses, to spot DNS flapping
+	MultipleIPs map[string][]string `json:"multiple_ips,omitempty"`
+
+	// Failures counts the FLOWSPEC_FAIL_ON conditions that occurred
+	Failures map[string]int `json:"failures,omitempty"`
+
+	// HostLimit is how many hosts Print lists before rolling the rest up
+	// as others; zero lists summaryTopN. The JSON form keeps every host.
+	HostLimit int `json:"-"`
+
+	// Full counts while scanning; only the top entries are reported
+	paths    map[string]int
+	statuses map[int]int
+	ips      map[string][]string
+}
+
+// summaryTopN is the number of paths and status codes listed in the summary
+const summaryTopN = 10
+
+// PathCount is the request count of a normalized host and path
+type PathCount struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// StatusCount is the response count of a status code
+type StatusCount struct {
+	Status int `json:"status"`
+	Count  int `json:"count"`
+}
+
+// LatencyStats holds duration percentiles in milliseconds
+type LatencyStats struct {
+	Count int   `json:"count"`
+	P50   int64 `json:"p50"`
+	P90   int64 `json:"p90"`
+	P95   int64 `json:"p95"`
+	P99   int64 `json:"p99"`
+	Max   int64 `json:"max"`
+}
+
+// errorKind classifies an entry's failure for the summary breakdown
+func errorKind(log *RequestLog) string {
+	if log.ErrorKind != "" {
+		return log.ErrorKind
+	}
+	if log.Error != "" {
+		msg := strings.ToLower(log.Error)
+		switch {
+		case strings.Contains(msg, "timeout") || strings.Contains(msg, "deadline exceeded"):
+			return "timeout"
+		case strings.Contains(msg, "connection refused"):
+			return "connection_refused"
+		case strings.Contains(msg, "no such host"):
+			return "dns"
+		case strings.Contains(msg, "tls") || strings.Contains(msg, "x509"):
+			return "tls"
+		case strings.Contains(msg, "canceled"):
+			return "canceled"
+		}
+		return "other"
+	}
+	switch {
+	case log.Incomplete:
+		return "incomplete"
+	case log.ResponseTruncated:
+		return "truncated"
+	case log.StatusCode >= 500:
+		return "5xx"
+	case log.StatusCode >= 400:
+		return "4xx"
+	}
+	return ""
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(float64(len(sorted))*p/100+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// Summarize computes a summary of the session's log files
+func (l *Logger) Summarize() (*SessionSummary, error) {
+	summary, err := SummarizeFiles(l.logFiles()...)
+	if summary != nil {
+		summary.Tags = l.session.Tags
+		summary.HostLimit = l.summaryHosts
+		// Drops after a host's last written entry are only known in memory
+		if l.sampler != nil {
+			for host, count := range l.sampler.pending() {
+				summary.addDropped(host, count)
+			}
+		}
+		summary.NoiseFiltered = l.filtered.Load()
+		for _, sink := range l.sinks {
+			if async, ok := sink.(*asyncFileSink); ok {
+				summary.WriteDropped += async.dropped.Load()
+			}
+		}
+	}
+	return summary, err
+}
+
+// SummarizeFiles computes a summary of one or more log files. Session tags
+// and the schema version are taken from the files' session records; files
+// written with a newer schema than LogSchemaVersion produce a warning.
+// Files that no longer exist, such as those evicted by FLOWSPEC_DISK_BUDGET
+// or FLOWSPEC_MAX_LOG_FILES, are skipped unless none is left.
+func SummarizeFiles(paths ...string) (*SessionSummary, error) {
+	existing := make([]string, 0, len(paths))
+	var missing error
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			missing = err
+			continue
+		}
+		existing = append(existing, path)
+	}
+	if len(existing) == 0 && missing != nil {
+		return nil, missing
+	}
+	paths = existing
+
+	summary := &SessionSummary{
+		GeneratedAt:   time.Now().Format(time.RFC3339),
+		Dispositions:  make(map[string]int),
+		Methods:       make(map[string]int),
+		Hosts:         make(map[string]int),
+		Sources:       make(map[string]int),
+		UserAgents:    make(map[string]int),
+		ErrorsByKind:  make(map[string]int),
+		StatusClasses: make(map[string]int),
+		paths:         make(map[string]int),
+		statuses:      make(map[int]int),
+		ips:           make(map[string][]string),
+	}
+	if len(paths) == 1 {
+		summary.LogFile = paths[0]
+	} else {
+		summary.LogFiles = paths
+	}
+
+	var durations []int64
+	for _, path := range paths {
+		if err := summarizeFile(path, summary, &durations); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	summary.Latency = LatencyStats{
+		Count: len(durations),
+		P50:   percentile(durations, 50),
+		P90:   percentile(durations, 90),
+		P95:   percentile(durations, 95),
+		P99:   percentile(durations, 99),
+		Max:   percentile(durations, 100),
+	}
+	summary.TopPaths = topPaths(summary.paths, summaryTopN)
+	summary.TopStatuses = topStatuses(summary.statuses, summaryTopN)
+	for host, ips := range summary.ips {
+		if len(ips) > 1 {
+			if summary.MultipleIPs == nil {
+				summary.MultipleIPs = make(map[string][]string)
+			}
+			sort.Strings(ips)
+			summary.MultipleIPs[host] = ips
+		}
+	}
+
+	return summary, nil
+}
+
+// addResolved records the addresses host resolved to
+func (s *SessionSummary) addResolved(host string, ips []string) {
+	host = hostOnly(host)
+	for _, ip := range ips {
+		if !slices.Contains(s.ips[host], ip) {
+			s.ips[host] = append(s.ips[host], ip)
+		}
+	}
+}
+
+// topPaths returns the n most requested paths, ties broken by path
+func topPaths(counts map[string]int, n int) []PathCount {
+	top := make([]PathCount, 0, len(counts))
+	for path, count := range counts {
+		top = append(top, PathCount{Path: path, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Path < top[j].Path
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// byCount returns the keys of counts ordered by count, highest first, ties
+// broken by key, so printed breakdowns are the same from run to run
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// topStatuses returns the n most frequent status codes, ties broken by code
+func topStatuses(counts map[int]int, n int) []StatusCount {
+	top := make([]StatusCount, 0, len(counts))
+	for status, count := range counts {
+		top = append(top, StatusCount{Status: status, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Status < top[j].Status
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// summaryPath normalizes an entry's URL for the top paths: the query is
+// dropped and ID-like segments (numbers, UUIDs, long hex) become {id}, so
+// /users/42 and /users/43 count together
+func summaryPath(log *RequestLog) string {
+	u, err := url.Parse(log.URL)
+	if err != nil {
+		return ""
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isIDSegment(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.ToLower(log.Host) + strings.Join(segments, "/")
+}
+
+// isIDSegment reports whether a path segment looks like an identifier
+func isIDSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	digits, hex := true, true
+	for _, r := range segment {
+		isDigit := r >= '0' && r <= '9'
+		isHex := isDigit || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r == '-'
+		digits = digits && isDigit
+		hex = hex && isHex
+	}
+	return digits || hex && len(segment) >= 16
+}
+
+// summarizeFile adds the entries of one log file to summary
+func summarizeFile(path string, summary *SessionSummary, durations *[]int64) error {
+	// Reopen file for reading
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return readLogRecords(file, func(line []byte) {
+		if isSessionRecord(line) {
+			var session SessionRecord
+			if err := json.Unmarshal(line, &session); err != nil {
+				summary.ParseErrors++
+				return
+			}
+			checkSchemaVersion(path, session.SchemaVersion)
+			if session.SchemaVersion > summary.SchemaVersion {
+				summary.SchemaVersion = session.SchemaVersion
+			}
+			if summary.Tags == nil {
+				summary.Tags = session.Tags
+			}
+			return
+		}
+
+		var log RequestLog
+		if err := json.Unmarshal(line, &log); err != nil {
+			// Log parse errors to alert users about malformed log entries
+			summary.ParseErrors++
+			return
+		}
+
+		if log.Pause != nil {
+			summary.PausedSkipped += log.Pause.Skipped
+			return
+		}
+
+		summary.Total++
+		if log.Error != "" {
+			summary.Errors++
+		}
+		if log.Bypassed {
+			summary.Bypassed++
+		}
+		if log.Tunnel {
+			summary.Tunnels++
+		}
+		if log.Disposition != "" {
+			summary.Dispositions[log.Disposition]++
+		}
+		if kind := errorKind(&log); kind != "" {
+			summary.ErrorsByKind[kind]++
+		}
+		if log.StatusCode > 0 {
+			*durations = append(*durations, log.Duration)
+			summary.StatusClasses[fmt.Sprintf("%dxx", log.StatusCode/100)]++
+			summary.statuses[log.StatusCode]++
+		}
+		if !log.Tunnel {
+			summary.paths[summaryPath(&log)]++
+		}
+		summary.Methods[log.Method]++
+		summary.Hosts[log.Host]++
+		if log.Source != "" {
+			summary.Sources[log.Source]++
+		}
+		if log.UserAgentFamily != "" {
+			summary.UserAgents[log.UserAgentFamily]++
+		}
+		summary.addDropped(log.Host, log.Dropped)
+		summary.addResolved(log.Host, log.ResolvedIPs)
+	})
+}
+
+// addDropped counts entries dropped for host by FLOWSPEC_PER_HOST_RATE
+func (s *SessionSummary) addDropped(host string, count int) {
+	if count <= 0 {
+		return
+	}
+	if s.Dropped == nil {
+		s.Dropped = make(map[string]int)
+	}
+	s.Dropped[strings.ToLower(host)] += count
+}
+
+// readLogRecords calls fn with each record of a log file as one compact
+// line. Lines may be any length, since entries with large bodies run to
+// megabytes. Indented files (FLOWSPEC_PRETTY_LOG) are decoded as a stream of
+// JSON values and compacted; a malformed value ends such a file, with the
+// rest of it passed to fn as a single line, while a malformed line of a
+// compact file, including one cut short by a crash, is passed to fn like
+// any other. Gob files (FLOWSPEC_LOG_FORMAT=gob) are converted to JSON lines.
+func readLogRecords(r io.Reader, fn func(line []byte)) error {
+	reader := bufio.NewReader(r)
+	if start, _ := reader.Peek(len(gobMagic)); string(start) == gobMagic {
+		reader.Discard(len(gobMagic))
+		return readGobRecords(reader, fn)
+	}
+	if start, _ := reader.Peek(2); string(start) != "{\n" {
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				line = bytes.TrimSuffix(line, []byte("\n"))
+				fn(bytes.TrimSuffix(line, []byte("\r")))
+			}
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	decoder := json.NewDecoder(reader)
+	var line bytes.Buffer
+	for {
+		var record json.RawMessage
+		if err := decoder.Decode(&record); err == io.EOF || err == io.ErrUnexpectedEOF {
+			// A record cut short by a crash ends the file
+			return nil
+		} else if err != nil {
+			// So does a malformed one; the rest is passed on as one bad line
+			rest, err := io.ReadAll(io.MultiReader(decoder.Buffered(), reader))
+			if err != nil {
+				return err
+			}
+			fn(rest)
+			return nil
+		}
+		line.Reset()
+		if err := json.Compact(&line, record); err != nil {
+			return err
+		}
+		fn(line.Bytes())
+	}
+}
+
+// Print writes the human-readable summary to stdout
+func (s *SessionSummary) Print() {
+	fmt.Println("\n=== Network Capture Summary ===")
+	if len(s.Tags) > 0 {
+		keys := make([]string, 0, len(s.Tags))
+		for key := range s.Tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for i, key := range keys {
+			keys[i] = key + "=" + s.Tags[key]
+		}
+		fmt.Printf("Session: %s\n", strings.Join(keys, ", "))
+	}
+	fmt.Printf("Total requests: %d\n", s.Total)
+	fmt.Printf("Errors: %d\n", s.Errors)
+	fmt.Printf("Bypassed: %d\n", s.Bypassed)
+	fmt.Printf("Tunnels: %d\n", s.Tunnels)
+	if len(s.Dispositions) > 0 {
+		dispositions := make([]string, 0, len(s.Dispositions))
+		for disposition, count := range s.Dispositions {
+			dispositions = append(dispositions, fmt.Sprintf("%s=%d", disposition, count))
+		}
+		sort.Strings(dispositions)
+		fmt.Printf("Dispositions: %s\n", strings.Join(dispositions, " "))
+	}
+	if len(s.Dropped) > 0 {
+		hosts := make([]string, 0, len(s.Dropped))
+		for host, count := range s.Dropped {
+			hosts = append(hosts, fmt.Sprintf("%s=%d", host, count))
+		}
+		sort.Strings(hosts)
+		fmt.Printf("Dropped over rate: %s\n", strings.Join(hosts, " "))
+	}
+	if s.NoiseFiltered > 0 {
+		fmt.Printf("Noise filtered: %d\n", s.NoiseFiltered)
+	}
+	if s.WriteDropped > 0 {
+		fmt.Printf("Dropped by a full write buffer: %d\n", s.WriteDropped)
+	}
+	if s.PausedSkipped > 0 {
+		fmt.Printf("Skipped while paused: %d\n", s.PausedSkipped)
+	}
+	if len(s.MultipleIPs) > 0 {
+		hosts := make([]string, 0, len(s.MultipleIPs))
+		for host, ips := range s.MultipleIPs {
+			hosts = append(hosts, fmt.Sprintf("%s=%s", host, strings.Join(ips, ",")))
+		}
+		sort.Strings(hosts)
+		fmt.Printf("Hosts resolving to multiple IPs: %s\n", strings.Join(hosts, " "))
+	}
+	if s.ParseErrors > 0 {
+		fmt.Printf("Parse errors: %d (malformed log entries)\n", s.ParseErrors)
+	}
+	fmt.Println("\nRequests by method:")
+	for _, method := range byCount(s.Methods) {
+		fmt.Printf("  %s: %d\n", method, s.Methods[method])
+	}
+	if len(s.Sources) > 0 {
+		fmt.Println("\nRequests by source:")
+		for _, source := range byCount(s.Sources) {
+			fmt.Printf("  %s: %d\n", source, s.Sources[source])
+		}
+	}
+	if len(s.UserAgents) > 0 {
+		fmt.Println("\nRequests by client:")
+		for _, family := range byCount(s.UserAgents) {
+			fmt.Printf("  %s: %d\n", family, s.UserAgents[family])
+		}
+	}
+	fmt.Println("\nTop hosts:")
+	limit := s.HostLimit
+	if limit <= 0 {
+		limit = summaryTopN
+	}
+	hosts := byCount(s.Hosts)
+	others := 0
+	for i, host := range hosts {
+		if i < limit {
+			fmt.Printf("  %s: %d\n", host, s.Hosts[host])
+		} else {
+			others += s.Hosts[host]
+		}
+	}
+	if len(hosts) > limit {
+		fmt.Printf("  others (%d hosts): %d\n", len(hosts)-limit, others)
+	}
+	if len(s.TopPaths) > 0 {
+		fmt.Println("\nTop paths:")
+		for _, path := range s.TopPaths {
+			fmt.Printf("  %s: %d\n", path.Path, path.Count)
+		}
+	}
+	if len(s.TopStatuses) > 0 {
+		classes := make([]string, 0, len(s.StatusClasses))
+		for class, count := range s.StatusClasses {
+			classes = append(classes, fmt.Sprintf("%s=%d", class, count))
+		}
+		sort.Strings(classes)
+		fmt.Printf("\nStatus codes: %s\n", strings.Join(classes, " "))
+		for _, status := range s.TopStatuses {
+			fmt.Printf("  %d: %d\n", status.Status, status.Count)
+		}
+	}
+	if len(s.Failures) > 0 {
+		conditions := make([]string, 0, len(s.Failures))
+		for condition, count := range s.Failures {
+			conditions = append(conditions, fmt.Sprintf("%s=%d", condition, count))
+		}
+		sort.Strings(conditions)
+		fmt.Printf("\nFailed on: %s\n", strings.Join(conditions, " "))
+	}
+	if s.Latency.Count > 0 {
+		fmt.Printf("\nLatency (ms): p50=%d p90=%d p99=%d max=%d\n",
+			s.Latency.P50, s.Latency.P90, s.Latency.P99, s.Latency.Max)
+	}
+	if len(s.LogFiles) > 0 {
+		fmt.Println("\nLog files:")
+		for _, path := range s.LogFiles {
+			fmt.Printf("  %s\n", path)
+		}
+	} else {
+		fmt.Printf("\nLog file: %s\n", s.LogFile)
+	}
+}
+
+// Summary prints a summary of the log file
+func (l *Logger) Summary() error {
+	summary, err := l.Summarize()
+	if summary != nil {
+		summary.Print()
+	}
+	return err
+}
+
+// WriteSummaryFile writes the summary as summary.<timestamp>.json in the log
+// directory and returns its path
+func (l *Logger) WriteSummaryFile(summary *SessionSummary) (string, error) {
+	path := filepath.Join(l.logDir, fmt.Sprintf("summary.%s.json", time.Now().Format("20060102-150405")))
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode summary: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("failed to write summary: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FuzzSummarize feeds arbitrary log files to the summarizer, which must not
+// fail on damaged content and must keep its counts consistent. Seeds from
+// realistic captures are in testdata/fuzz/FuzzSummarize.
+func FuzzSummarize(f *testing.F) {
+	f.Add([]byte(`{"type":"session","schema_version":37,"started":"2025-12-25T12:00:00Z"}` + "\n" +
+		`{"timestamp":"2025-12-25T12:00:00Z","method":"GET","url":"https://api.example.com/users/42","host":"api.example.com","status_code":200,"duration_ms":12}` + "\n"))
+	f.Add([]byte(`{"method":"POST","url":"https://api.example.com/login","host":"api.exa`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "network.fuzz.jsonl")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		summary, err := SummarizeFiles(path)
+		if err != nil {
+			// Only a damaged gob stream is an error; JSON is skipped
+			if bytes.HasPrefix(data, []byte(gobMagic)) {
+				return
+			}
+			t.Fatalf("SummarizeFiles: %v", err)
+		}
+
+		if summary.Total < 0 || summary.ParseErrors < 0 {
+			t.Fatalf("negative counts: total %d, parse errors %d", summary.Total, summary.ParseErrors)
+		}
+		// A compact file has at most one record per line
+		if !bytes.HasPrefix(data, []byte(gobMagic)) && !bytes.HasPrefix(data, []byte("{\n")) {
+			if lines := bytes.Count(data, []byte("\n")) + 1; summary.Total+summary.ParseErrors > lines {
+				t.Fatalf("%d entries and %d parse errors from %d lines", summary.Total, summary.ParseErrors, lines)
+			}
+		}
+		for name, counts := range map[string]map[string]int{"methods": summary.Methods, "hosts": summary.Hosts} {
+			sum := 0
+			for _, n := range counts {
+				sum += n
+			}
+			if sum != summary.Total {
+				t.Fatalf("%s add up to %d, want total %d", name, sum, summary.Total)
+			}
+		}
+		if summary.Latency.Count > summary.Total {
+			t.Fatalf("latency count %d over total %d", summary.Latency.Count, summary.Total)
+		}
+		for host, n := range summary.Dropped {
+			if n <= 0 {
+				t.Fatalf("dropped count %d for %s", n, host)
+			}
+		}
+	})
+}
+
+// FuzzRequestLogUnmarshal checks that any entry that unmarshals can be
+// summarized and written back out
+func FuzzRequestLogUnmarshal(f *testing.F) {
+	f.Add([]byte(`{"method":"GET","url":"https://api.example.com/a?b=c","host":"api.example.com","status_code":502,"error":"connection refused","timings":{"dns_ms":1}}`))
+	f.Add([]byte(`{"pause":{"skipped":3},"cache":{"max_age":0},"grpc_status":0}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var log RequestLog
+		if err := json.Unmarshal(data, &log); err != nil {
+			return
+		}
+		errorKind(&log)
+		summaryPath(&log)
+		if _, err := json.Marshal(&log); err != nil {
+			t.Fatalf("Marshal: %v", err)
+		}
+	})
+}
+
+func TestSummaryCountsAsyncEntries(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{AsyncWrites: true})
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	summary := p.Summary()
+	if summary == nil {
+		t.Fatal("no summary after close")
+	}
+	if summary.Total != requests {
+		t.Errorf("summary total = %d, want %d", summary.Total, requests)
+	}
+}
+
+func TestSummaryFileMatchesLog(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	for _, path := range []string{"/a", "/b", "/missing"} {
+		resp, err := client.Get(upstream.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	resp, err := client.Post(upstream.URL+"/a", "text/plain", strings.NewReader("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	entries := closeAndRead(t, p)
+
+	files, err := filepath.Glob(filepath.Join(p.opts.LogDir, "summary.*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("summary files %q, err %v; want one", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary SessionSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	methods := make(map[string]int)
+	statuses := make(map[string]int)
+	for _, entry := range entries {
+		methods[entry.Method]++
+		statuses[fmt.Sprintf("%dxx", entry.StatusCode/100)]++
+	}
+	if summary.Total != len(entries) || len(entries) != 4 {
+		t.Errorf("summary total %d, log has %d entries; want 4", summary.Total, len(entries))
+	}
+	if !reflect.DeepEqual(summary.Methods, methods) {
+		t.Errorf("summary methods %v, log has %v", summary.Methods, methods)
+	}
+	if !reflect.DeepEqual(summary.StatusClasses, statuses) {
+		t.Errorf("summary status classes %v, log has %v", summary.StatusClasses, statuses)
+	}
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	if summary.Hosts[host] != 4 || summary.ErrorsByKind["4xx"] != 1 {
+		t.Errorf("summary hosts %v, errors by kind %v; want 4 for %s and one 4xx", summary.Hosts, summary.ErrorsByKind, host)
+	}
+	if summary.LogFile != p.GetLogPath() {
+		t.Errorf("summary log file %q, want %q", summary.LogFile, p.GetLogPath())
+	}
+}
+
+func TestSummaryBreakdowns(t *testing.T) {
+	lines := []string{
+		`{"type":"session","schema_version":38,"started":"2025-12-25T12:00:00Z"}`,
+		`{"method":"GET","url":"https://api.example.com/users/42","host":"api.example.com","status_code":200}`,
+		`{"method":"GET","url":"https://api.example.com/users/43?page=2","host":"api.example.com","status_code":200}`,
+		`{"method":"GET","url":"https://api.example.com/users/550e8400-e29b-41d4-a716-446655440000","host":"api.example.com","status_code":404}`,
+		`{"method":"GET","url":"https://api.example.com/health","host":"api.example.com","status_code":200}`,
+		`{"method":"GET","url":"https://API.example.com/health","host":"API.example.com","status_code":503}`,
+		`{"method":"POST","url":"https://cdn.example.com","host":"cdn.example.com","status_code":301}`,
+		`{"method":"GET","url":"https://cdn.example.com/assets/app.js","host":"cdn.example.com","status_code":500}`,
+		`{"method":"GET","url":"https://down.example.com/x","host":"down.example.com","status_code":0,"error":"connection refused"}`,
+	}
+	path := filepath.Join(t.TempDir(), "network.fixture.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := SummarizeFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IDs are collapsed, queries dropped, and hosts lowercased; ties are
+	// ordered by path
+	wantPaths := []PathCount{
+		{"api.example.com/users/{id}", 3},
+		{"api.example.com/health", 2},
+		{"cdn.example.com/", 1},
+		{"cdn.example.com/assets/app.js", 1},
+		{"down.example.com/x", 1},
+	}
+	if !reflect.DeepEqual(summary.TopPaths, wantPaths) {
+		t.Errorf("top paths = %v, want %v", summary.TopPaths, wantPaths)
+	}
+
+	// A failed request has no status
+	wantStatuses := []StatusCount{{200, 3}, {301, 1}, {404, 1}, {500, 1}, {503, 1}}
+	if !reflect.DeepEqual(summary.TopStatuses, wantStatuses) {
+		t.Errorf("top statuses = %v, want %v", summary.TopStatuses, wantStatuses)
+	}
+	wantClasses := map[string]int{"2xx": 3, "3xx": 1, "4xx": 1, "5xx": 2}
+	if !reflect.DeepEqual(summary.StatusClasses, wantClasses) {
+		t.Errorf("status classes = %v, want %v", summary.StatusClasses, wantClasses)
+	}
+
+	// Only the top N are kept
+	counts := make(map[string]int)
+	for i := 0; i < summaryTopN+5; i++ {
+		counts[fmt.Sprintf("h/%02d", i)] = i
+	}
+	if top := topPaths(counts, summaryTopN); len(top) != summaryTopN || top[0].Count != summaryTopN+4 {
+		t.Errorf("topPaths kept %d paths starting with %v, want %d starting with count %d",
+			len(top), top[0], summaryTopN, summaryTopN+4)
+	}
+}
+
+func TestSummaryPrintOrder(t *testing.T) {
+	summary := &SessionSummary{
+		Methods:   map[string]int{"PUT": 1, "POST": 2, "GET": 5, "DELETE": 2},
+		Hosts:     map[string]int{"c.example.com": 1, "b.example.com": 3, "e.example.com": 5, "a.example.com": 3, "d.example.com": 2},
+		HostLimit: 3,
+		LogFile:   "network.jsonl",
+	}
+	// Map order varies, so print a few times
+	for i := 0; i < 5; i++ {
+		out := captureStdout(t, summary.Print)
+		for _, want := range []string{
+			"\nRequests by method:\n  GET: 5\n  DELETE: 2\n  POST: 2\n  PUT: 1\n",
+			"\nTop hosts:\n  e.example.com: 5\n  a.example.com: 3\n  b.example.com: 3\n  others (2 hosts): 3\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("output missing %q:\n%s", want, out)
+			}
+		}
+	}
+}
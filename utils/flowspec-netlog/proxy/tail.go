@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tailPoll is how often Tail checks for appended entries and rotation
+const tailPoll = 250 * time.Millisecond
+
+// TailFilter selects the entries Tail prints; empty fields match everything
+type TailFilter struct {
+	Host   string // host, or a domain suffix when starting with "."
+	Method string
+	Status string // code such as "404", or class such as "5xx"
+}
+
+// match reports whether log passes the filter
+func (f TailFilter) match(log *RequestLog) bool {
+	if f.Host != "" {
+		host := hostOnly(log.Host)
+		if strings.HasPrefix(f.Host, ".") {
+			if !strings.HasSuffix("."+host, f.Host) {
+				return false
+			}
+		} else if !strings.EqualFold(host, f.Host) {
+			return false
+		}
+	}
+	if f.Method != "" && !strings.EqualFold(log.Method, f.Method) {
+		return false
+	}
+	if f.Status != "" {
+		status := strconv.Itoa(log.StatusCode)
+		if class, ok := strings.CutSuffix(strings.ToLower(f.Status), "xx"); ok {
+			return len(class) == 1 && strings.HasPrefix(status, class) && len(status) == 3
+		}
+		return status == f.Status
+	}
+	return true
+}
+
+// hostOnly strips the port from a Host value
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// Tail follows path, a log file or a log directory, writing the entries
+// appended to it to w until ctx is done. For a directory the newest log file
+// is followed, switching to newer files as the log rotates. Entries are
+// written as one-line summaries, or verbatim with raw. Records must be one
+// per line, so FLOWSPEC_PRETTY_LOG output is not supported.
+func Tail(ctx context.Context, path string, filter TailFilter, raw bool, w io.Writer) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	t := &tailer{filter: filter, raw: raw, w: w}
+	if info.IsDir() {
+		t.dir = path
+	} else {
+		t.path = path
+	}
+	defer t.close()
+
+	// Only entries written from now on are shown
+	if err := t.open(t.current(), io.SeekEnd); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(tailPoll)
+	defer ticker.Stop()
+	for {
+		if err := t.poll(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// tailer holds the state of a Tail
+type tailer struct {
+	dir    string // set when following the newest file in a directory
+	path   string
+	file   *os.File
+	offset int64
+	buf    []byte // partial last line
+	filter TailFilter
+	raw    bool
+	w      io.Writer
+}
+
+// current returns the file to follow: the newest log file in the directory,
+// or the given file
+func (t *tailer) current() string {
+	if t.dir == "" {
+		return t.path
+	}
+	files, err := listLogFiles(t.dir)
+	if err != nil {
+		return t.path
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		if strings.HasSuffix(files[i].path, ".jsonl") {
+			return files[i].path
+		}
+	}
+	return t.path
+}
+
+// open starts following path from whence (io.SeekStart or io.SeekEnd). An
+// empty path, a directory with no log file yet, is retried on the next poll.
+func (t *tailer) open(path string, whence int) error {
+	t.close()
+	t.path = path
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	offset, err := file.Seek(0, whence)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.file, t.offset, t.buf = file, offset, nil
+	return nil
+}
+
+// close closes the followed file
+func (t *tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// poll prints what was appended since the last poll, then moves to a newer
+// file if the log rotated. A file that was truncated is read from the start.
+func (t *tailer) poll() error {
+	if t.file == nil {
+		if path := t.current(); path != "" {
+			return t.open(path, io.SeekStart)
+		}
+		return nil
+	}
+
+	if info, err := t.file.Stat(); err == nil && info.Size() < t.offset {
+		if err := t.open(t.path, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if err := t.read(); err != nil {
+		return err
+	}
+
+	if next := t.current(); next != t.path {
+		return t.open(next, io.SeekStart)
+	}
+	return nil
+}
+
+// read prints the complete lines appended to the file
+func (t *tailer) read() error {
+	chunk, err := io.ReadAll(t.file)
+	if err != nil {
+		return err
+	}
+	t.offset += int64(len(chunk))
+	t.buf = append(t.buf, chunk...)
+
+	for {
+		i := bytes.IndexByte(t.buf, '\n')
+		if i < 0 {
+			return nil
+		}
+		line := t.buf[:i]
+		t.buf = t.buf[i+1:]
+		if err := t.print(line); err != nil {
+			return err
+		}
+	}
+}
+
+// print writes one log line if it is an entry that passes the filter
+func (t *tailer) print(line []byte) error {
+	if len(bytes.TrimSpace(line)) == 0 || isSessionRecord(line) {
+		return nil
+	}
+	var log RequestLog
+	if err := json.Unmarshal(line, &log); err != nil || !t.filter.match(&log) {
+		return nil
+	}
+	if t.raw {
+		_, err := fmt.Fprintf(t.w, "%s\n", line)
+		return err
+	}
+	_, err := fmt.Fprintln(t.w, formatTailLine(&log))
+	return err
+}
+
+// formatTailLine summarizes an entry as "time method status duration url"
+func formatTailLine(log *RequestLog) string {
+	clock := log.Timestamp
+	if ts, err := time.Parse(time.RFC3339, log.Timestamp); err == nil {
+		clock = ts.Format("15:04:05")
+	}
+
+	if log.Pause != nil {
+		return fmt.Sprintf("%s capture paused for %dms, %d entries skipped", clock, log.Duration, log.Pause.Skipped)
+	}
+
+	status := "---"
+	switch {
+	case log.StatusCode != 0:
+		status = strconv.Itoa(log.StatusCode)
+	case log.Bypassed:
+		status = "BYP"
+	case log.Tunnel:
+		status = "TUN"
+	}
+
+	line := fmt.Sprintf("%s %-7s %s %6dms %s", clock, log.Method, status, log.Duration, log.URL)
+	if log.Error != "" {
+		line += "  error: " + log.Error
+	}
+	return line
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tailOutput collects what Tail writes
+type tailOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *tailOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *tailOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// appendLines appends lines to the file at path
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForOutput waits until out contains want
+func waitForOutput(t *testing.T, out *tailOutput, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("output never contained %q:\n%s", want, out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTailFilters(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "network.a.jsonl")
+	appendLines(t, first,
+		`{"type":"session","schema_version":38,"started":"2025-12-25T12:00:00Z"}`,
+		`{"timestamp":"2025-12-25T12:00:01Z","method":"GET","url":"https://api.example.com/old","host":"api.example.com","status_code":500}`,
+	)
+
+	out := &tailOutput{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Tail(ctx, dir, TailFilter{Host: ".example.com", Method: "get", Status: "5xx"}, false, out)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// Tail starts at the end of the file; keep appending a matching line
+	// until it is seen following. Those lines are left out of the check.
+	for i := 0; !strings.Contains(out.String(), "/ready"); i++ {
+		if i == 100 {
+			t.Fatal("tail never picked up appended lines")
+		}
+		appendLines(t, first, `{"timestamp":"2025-12-25T12:00:02Z","method":"GET","url":"https://api.example.com/ready","host":"api.example.com","status_code":503}`)
+		time.Sleep(50 * time.Millisecond)
+	}
+	if strings.Contains(out.String(), "/old") {
+		t.Errorf("tail printed an entry written before it started:\n%s", out.String())
+	}
+
+	appendLines(t, first,
+		`{"timestamp":"2025-12-25T12:00:03Z","method":"GET","url":"https://api.example.com/match","host":"api.example.com:443","status_code":502,"duration_ms":12}`,
+		`{"timestamp":"2025-12-25T12:00:04Z","method":"GET","url":"https://other.net/host","host":"other.net","status_code":500}`,
+		`{"timestamp":"2025-12-25T12:00:05Z","method":"POST","url":"https://api.example.com/method","host":"api.example.com","status_code":500}`,
+		`{"timestamp":"2025-12-25T12:00:06Z","method":"GET","url":"https://api.example.com/status","host":"api.example.com","status_code":200}`,
+	)
+	waitForOutput(t, out, "/match")
+
+	// A newer file in the directory is followed from its start
+	second := filepath.Join(dir, "network.b.jsonl")
+	appendLines(t, second,
+		`{"type":"session","schema_version":38,"started":"2025-12-25T13:00:00Z"}`,
+		`{"timestamp":"2025-12-25T13:00:01Z","method":"GET","url":"https://example.com/rotated","host":"example.com","status_code":504}`,
+	)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(second, future, future); err != nil {
+		t.Fatal(err)
+	}
+	waitForOutput(t, out, "/rotated")
+
+	var got string
+	for _, line := range strings.SplitAfter(out.String(), "\n") {
+		if !strings.Contains(line, "/ready") {
+			got += line
+		}
+	}
+	want := strings.Join([]string{
+		formatTailLine(&RequestLog{Timestamp: "2025-12-25T12:00:03Z", Method: "GET", URL: "https://api.example.com/match", StatusCode: 502, Duration: 12}),
+		formatTailLine(&RequestLog{Timestamp: "2025-12-25T13:00:01Z", Method: "GET", URL: "https://example.com/rotated", StatusCode: 504}),
+	}, "\n") + "\n"
+	if got != want {
+		t.Errorf("tail printed:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Timings breaks down where the upstream round trip spent its time.
+// Phases that did not happen (e.g. DNS on a reused connection) are omitted.
+// Reused is set when the request went out on a pooled upstream connection.
+// QueuedMs is the time spent waiting for a connection this request did not
+// dial: a pooled one, or one dialed for another request, such as when
+// FLOWSPEC_MAX_CONNS_PER_HOST connections are all busy.
+type Timings struct {
+	DNSMs     float64 `json:"dns_ms,omitempty"`
+	ConnectMs float64 `json:"connect_ms,omitempty"`
+	TLSMs     float64 `json:"tls_ms,omitempty"`
+	TTFBMs    float64 `json:"ttfb_ms,omitempty"`
+	QueuedMs  float64 `json:"queued_ms,omitempty"`
+	Reused    bool    `json:"reused,omitempty"`
+}
+
+// requestTrace collects httptrace events for a single forwarded request.
+// Callbacks may fire on transport goroutines, so access is synchronized.
+type requestTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	getConn      time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	dialed       bool // this request started the dial of its connection
+	timings      Timings
+	resolved     []string // distinct addresses from DNS, across retries
+}
+
+// newRequestTrace creates a trace measuring from start
+func newRequestTrace(start time.Time) *requestTrace {
+	return &requestTrace{start: start}
+}
+
+// millisSince returns the elapsed time since t in fractional milliseconds
+func millisSince(t time.Time) float64 {
+	return float64(time.Since(t).Microseconds()) / 1000
+}
+
+// clientTrace returns the httptrace hooks that feed this trace
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.timings.DNSMs = millisSince(t.dnsStart)
+			for _, addr := range info.Addrs {
+				if ip := addr.IP.String(); !slices.Contains(t.resolved, ip) {
+					t.resolved = append(t.resolved, ip)
+				}
+			}
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			t.connectStart = time.Now()
+			t.dialed = true
+			t.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			t.timings.ConnectMs = millisSince(t.connectStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.timings.TLSMs = millisSince(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.getConn = time.Now()
+			t.dialed = false
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.timings.Reused = info.Reused
+			// The wait for a connection this request dialed is the dial,
+			// already broken down, plus scheduling noise; only a connection
+			// from the pool or another request's dial means it queued.
+			// Below a millisecond it is bookkeeping, not waiting.
+			if info.Reused || !t.dialed {
+				if queued := millisSince(t.getConn); queued >= 1 {
+					t.timings.QueuedMs = queued
+				}
+			}
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.timings.TTFBMs = millisSince(t.start)
+			t.mu.Unlock()
+		},
+	}
+}
+
+// record sets log's timings and resolved addresses from the events
+// collected so far, unless log was already written
+func (t *requestTrace) record(log *RequestLog) {
+	if log.written() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timings := t.timings
+	log.Timings = &timings
+	log.ResolvedIPs = append([]string(nil), t.resolved...)
+}
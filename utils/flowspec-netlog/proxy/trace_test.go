@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueuedMs(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		dial   bool
+		reused bool
+		queued bool
+	}{
+		{"own dial", true, false, false},
+		{"pooled connection", false, true, true},
+		{"another request's dial", false, false, true},
+	} {
+		trace := newRequestTrace(time.Now())
+		hooks := trace.clientTrace()
+		hooks.GetConn("example.com:80")
+		if tc.dial {
+			hooks.ConnectStart("tcp", "192.0.2.1:80")
+		}
+		time.Sleep(5 * time.Millisecond)
+		if tc.dial {
+			hooks.ConnectDone("tcp", "192.0.2.1:80", nil)
+		}
+		hooks.GotConn(httptrace.GotConnInfo{Reused: tc.reused})
+
+		if got := trace.timings.QueuedMs > 0; got != tc.queued {
+			t.Errorf("%s: QueuedMs = %v, want queued %v", tc.name, trace.timings.QueuedMs, tc.queued)
+		}
+	}
+}
+
+func TestQueuedMsConnsPerHost(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	// One connection per host makes the second request wait for the first
+	p, client := newTestProxy(t, Options{MaxConnsPerHost: 1})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(upstream.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	queued := 0
+	for _, entry := range entries {
+		if entry.Timings != nil && entry.Timings.QueuedMs > 0 {
+			queued++
+		}
+	}
+	if queued != 1 {
+		t.Errorf("%d entries with queued_ms, want 1", queued)
+	}
+}
+
+func TestTimingsRecorded(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{InsecureUpstream: true})
+	resp, err := skipVerify(client).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	timings := entries[0].Timings
+	if timings == nil {
+		t.Fatal("no timings recorded")
+	}
+	if timings.ConnectMs <= 0 || timings.TLSMs <= 0 {
+		t.Errorf("connect_ms %v, tls_ms %v; want both set for a new connection", timings.ConnectMs, timings.TLSMs)
+	}
+	if timings.TTFBMs < timings.ConnectMs+timings.TLSMs {
+		t.Errorf("ttfb_ms %v below connect_ms %v plus tls_ms %v", timings.TTFBMs, timings.ConnectMs, timings.TLSMs)
+	}
+	if timings.TTFBMs < 20 {
+		t.Errorf("ttfb_ms %v, want at least the upstream's 20ms", timings.TTFBMs)
+	}
+	if timings.Reused {
+		t.Error("first request marked as reusing a connection")
+	}
+}
+
+func TestResolvedIPsRecorded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(upstream.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// localhost resolves through the hosts file; an IP needs no lookup
+	p, client := newTestProxy(t, Options{})
+	for _, target := range []string{"http://localhost:" + port, upstream.URL} {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if !slices.Contains(entries[0].ResolvedIPs, "127.0.0.1") {
+		t.Errorf("localhost resolved IPs = %v, want 127.0.0.1 among them", entries[0].ResolvedIPs)
+	}
+	if entries[1].ResolvedIPs != nil {
+		t.Errorf("IP literal resolved IPs = %v, want none", entries[1].ResolvedIPs)
+	}
+}
@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elazarl/goproxy"
+)
+
+const (
+	tunnelDialTimeout = 30 * time.Second
+
+	// connectSniffTimeout is how long to wait for a client's first bytes
+	// before assuming a server-speaks-first protocol (SMTP, MySQL, ...)
+	connectSniffTimeout = time.Second
+
+	tlsRecordHandshake = 0x16 // first byte of a TLS ClientHello record
+
+	connectEstablished = "HTTP/1.1 200 Connection established\r\n\r\n"
+)
+
+// sniffedKey marks a CONNECT request handed back to goproxy after its first
+// bytes were found to be TLS
+type sniffedKey struct{}
+
+// handleConnect intercepts CONNECT requests for MITM hosts and tunnels the
+// rest. Intercepted hosts are sniffed first, so CONNECTs carrying plain TCP
+// (SSH, databases) are tunneled instead of failing the TLS handshake.
+func (p *Proxy) handleConnect(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
+	if ctx.Req != nil && ctx.Req.Context().Value(sniffedKey{}) != nil {
+		// Requests decrypted from the tunnel get this UserData, which marks
+		// them as intercepted and carries the client connection's ID (zero
+		// when unknown)
+		id, _ := ctx.Req.Context().Value(connIDKey{}).(connectionID)
+		ctx.UserData = id
+		return p.mitm, host
+	}
+	host = connectTarget(ctx.Req, host)
+	if host == "" {
+		ctx.Resp = goproxy.NewResponse(ctx.Req, goproxy.ContentTypeText, http.StatusBadRequest,
+			"flowspec-netlog: CONNECT needs a host:port target\n")
+		return &goproxy.ConnectAction{Action: goproxy.ConnectReject}, host
+	}
+	if ctx.Req != nil && p.self.Load().matches(host) {
+		p.logger.logBlocked(ctx.Req, host, host, "self_reference")
+		ctx.Resp = selfReferenceResponse(ctx.Req)
+		return &goproxy.ConnectAction{Action: goproxy.ConnectReject}, host
+	}
+	if ctx.Req != nil && !p.clientAllowed(ctx.Req.RemoteAddr) {
+		p.logger.LogForbidden(ctx.Req, host)
+		ctx.Resp = forbiddenResponse(ctx.Req)
+		return &goproxy.ConnectAction{Action: goproxy.ConnectReject}, host
+	}
+
+	rules := p.logger.hostRules()
+	rule, bypassed := rules.bypass(host)
+	intercept := false
+	if !bypassed && p.mitm != nil {
+		rule, intercept = rules.intercept(host)
+	}
+
+	return &goproxy.ConnectAction{
+		Action: goproxy.ConnectHijack,
+		Hijack: func(req *http.Request, client net.Conn, ctx *goproxy.ProxyCtx) {
+			if intercept {
+				p.sniffConnect(req, host, rule, client)
+				return
+			}
+			p.tunnel(req, host, client, rule, bypassed, false)
+		},
+	}, host
+}
+
+// connectTarget returns the authority a CONNECT asks for as a lowercase
+// host:port, port 443 when none is given, so entries and host rules see
+// the same target however the client wrote it. host is goproxy's target,
+// empty when the request-target was not in authority form; req.Host is
+// used then. It returns "" when there is no host at all.
+func connectTarget(req *http.Request, host string) string {
+	if host == "" && req != nil {
+		host = req.Host
+	}
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), "443"
+	}
+	if name == "" {
+		return ""
+	}
+	return net.JoinHostPort(strings.ToLower(name), port)
+}
+
+// sniffConnect accepts the CONNECT and peeks at the client's first bytes. A
+// TLS ClientHello is handed back to goproxy for interception; anything else
+// is tunneled opaquely.
+func (p *Proxy) sniffConnect(req *http.Request, host, rule string, client net.Conn) {
+	if _, err := io.WriteString(client, connectEstablished); err != nil {
+		client.Close()
+		return
+	}
+
+	client.SetReadDeadline(time.Now().Add(connectSniffTimeout))
+	reader := bufio.NewReader(client)
+	first, err := reader.Peek(1)
+	client.SetReadDeadline(time.Time{})
+
+	var netErr net.Error
+	switch {
+	case err == nil && first[0] == tlsRecordHandshake:
+		conn := &sniffedConn{Conn: client, reader: reader, skipReply: true}
+		req = req.WithContext(context.WithValue(req.Context(), sniffedKey{}, true))
+		p.ProxyHttpServer.ServeHTTP(&hijackedWriter{conn: conn}, req)
+	case err == nil:
+		p.tunnel(req, host, &sniffedConn{Conn: client, reader: reader}, rule, false, true)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		// The client is waiting for the server to speak first; nothing was buffered
+		p.tunnel(req, host, client, rule, false, true)
+	default:
+		client.Close()
+	}
+}
+
+// tunnel relays bytes between the client and host without decrypting them,
+// then logs a single entry with the byte counts for each direction. req is
+// the CONNECT; rule is the host rule that applied; established reports
+// whether the CONNECT was already answered.
+func (p *Proxy) tunnel(req *http.Request, host string, client net.Conn, rule string, bypassed, established bool) {
+	startTime := time.Now()
+	p.logger.inflight.add()
+	defer p.logger.inflight.done()
+	defer client.Close()
+
+	var sni string
+	logTunnel := func(sent, received int64, err error) {
+		log := tunnelLog(host, startTime, sent, received, bypassed, rule, err)
+		log.SNI = sni
+		if req != nil {
+			log.ClientProtocol = clientProtocol(req)
+			if id, ok := req.Context().Value(connIDKey{}).(connectionID); ok {
+				log.ConnectionID = uint64(id)
+			}
+		}
+		p.logger.Write(log)
+	}
+
+	target, err := p.dialTunnel(host)
+	if err != nil {
+		if !established {
+			io.WriteString(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		}
+		logTunnel(0, 0, err)
+		return
+	}
+	defer target.Close()
+
+	if !established {
+		if _, err := io.WriteString(client, connectEstablished); err != nil {
+			logTunnel(0, 0, err)
+			return
+		}
+		// A tunnel answered by sniffConnect was not TLS, so has no SNI
+		if p.opts.TunnelSNI {
+			client, sni = peekSNI(client)
+		}
+	}
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent = copyHalf(target, client)
+	}()
+	go func() {
+		defer wg.Done()
+		received = copyHalf(client, target)
+	}()
+	wg.Wait()
+
+	logTunnel(sent, received, nil)
+}
+
+// dialTunnel connects to the tunnel target, honoring goproxy's upstream proxy dialer
+func (p *Proxy) dialTunnel(host string) (net.Conn, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "443")
+	}
+	if path, ok := p.unix.socket(host); ok {
+		return net.DialTimeout("unix", path, tunnelDialTimeout)
+	}
+	if p.ConnectDial != nil {
+		return p.ConnectDial("tcp", host)
+	}
+	return net.DialTimeout("tcp", host, tunnelDialTimeout)
+}
+
+// copyHalf copies src to dst and signals EOF to dst when src is exhausted.
+// Connections that cannot half-close are closed so the other direction unblocks.
+func copyHalf(dst, src net.Conn) int64 {
+	n, _ := io.Copy(dst, src)
+	if hc, ok := dst.(interface{ CloseWrite() error }); ok {
+		hc.CloseWrite()
+	} else {
+		dst.Close()
+		src.Close()
+	}
+	return n
+}
+
+// sniffedConn is a client connection whose first bytes were peeked
+type sniffedConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	// skipReply drops goproxy's own CONNECT reply, which sniffConnect has
+	// already sent
+	skipReply bool
+}
+
+// Read reads the peeked bytes before the rest of the connection
+func (c *sniffedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// Write drops the first write if it is goproxy's CONNECT reply
+func (c *sniffedConn) Write(b []byte) (int, error) {
+	if c.skipReply {
+		c.skipReply = false
+		if bytes.HasPrefix(b, []byte("HTTP/1.0 200")) {
+			return len(b), nil
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+// CloseWrite half-closes the underlying connection when it supports it
+func (c *sniffedConn) CloseWrite() error {
+	if hc, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return hc.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// hijackedWriter lets goproxy hijack a connection that was already hijacked
+type hijackedWriter struct {
+	conn net.Conn
+}
+
+func (w *hijackedWriter) Header() http.Header         { return http.Header{} }
+func (w *hijackedWriter) Write(b []byte) (int, error) { return w.conn.Write(b) }
+func (w *hijackedWriter) WriteHeader(int)             {}
+
+// Hijack returns the connection
+func (w *hijackedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
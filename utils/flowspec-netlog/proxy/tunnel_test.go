@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestTunnelByteCounts(t *testing.T) {
+	target := startEchoServer(t)
+
+	// Only other hosts are intercepted, so the CONNECT is tunneled
+	p, addr := startTestProxy(t, Options{MITMHosts: []string{"example.com"}})
+	conn := connectTunnel(t, addr, target)
+	const message = "hello through the tunnel"
+	if _, err := io.WriteString(conn, message); err != nil {
+		t.Fatal(err)
+	}
+	conn.CloseWrite()
+	echoed, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(echoed) != message {
+		t.Errorf("echoed %q, want %q", echoed, message)
+	}
+	conn.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if !entry.Tunnel || entry.Disposition != dispositionTunnel || entry.Method != "CONNECT" {
+		t.Errorf("entry tunnel %v, disposition %q, method %q; want a tunnel", entry.Tunnel, entry.Disposition, entry.Method)
+	}
+	if entry.BytesSent != int64(len(message)) || entry.BytesReceived != int64(len(message)) {
+		t.Errorf("bytes sent %d, received %d; want %d each", entry.BytesSent, entry.BytesReceived, len(message))
+	}
+}
+
+func TestConnectPlainTCP(t *testing.T) {
+	// Every host is intercepted, but a CONNECT carrying plain TCP is tunneled
+	p, addr := startTestProxy(t, Options{})
+
+	// The client speaks first
+	conn := connectTunnel(t, addr, startEchoServer(t))
+	const message = "not a TLS ClientHello"
+	if _, err := io.WriteString(conn, message); err != nil {
+		t.Fatal(err)
+	}
+	conn.CloseWrite()
+	if echoed, err := io.ReadAll(conn); err != nil || string(echoed) != message {
+		t.Errorf("echoed %q, %v; want %q", echoed, err, message)
+	}
+	conn.Close()
+
+	// The server speaks first, like SSH or SMTP
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	const banner = "SSH-2.0-test\r\n"
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, banner)
+		io.Copy(conn, conn)
+	}()
+	conn = connectTunnel(t, addr, listener.Addr().String())
+	reader := bufio.NewReader(conn)
+	if got, err := reader.ReadString('\n'); err != nil || got != banner {
+		t.Errorf("banner %q, %v; want %q", got, err, banner)
+	}
+	io.WriteString(conn, "ping")
+	conn.CloseWrite()
+	if echoed, err := io.ReadAll(reader); err != nil || string(echoed) != "ping" {
+		t.Errorf("echoed %q, %v; want ping", echoed, err)
+	}
+	conn.Close()
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for i, want := range []struct{ sent, received int64 }{
+		{int64(len(message)), int64(len(message))},
+		{4, int64(len(banner)) + 4},
+	} {
+		entry := entries[i]
+		if !entry.Tunnel || entry.Disposition != dispositionTunnel {
+			t.Errorf("entry %d: tunnel %v, disposition %q; want a tunnel", i, entry.Tunnel, entry.Disposition)
+		}
+		if entry.BytesSent != want.sent || entry.BytesReceived != want.received {
+			t.Errorf("entry %d: bytes sent %d, received %d; want %d and %d",
+				i, entry.BytesSent, entry.BytesReceived, want.sent, want.received)
+		}
+	}
+}
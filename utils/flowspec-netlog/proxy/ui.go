@@ -0,0 +1,17 @@
+package proxy
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// uiPage is the request browser served at /ui. It reads entries from /recent.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+// handleUI serves the request browser
+func (p *Proxy) handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUI(t *testing.T) {
+	p, _ := newTestProxy(t, Options{})
+	rec := httptest.NewRecorder()
+	p.AdminHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/ui", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("content type %q, want text/html", ct)
+	}
+	// The page loads its entries from the /recent endpoint
+	body := rec.Body.String()
+	if !strings.Contains(body, "<html") || !strings.Contains(body, `"recent"`) {
+		t.Errorf("page does not reference /recent:\n%.200s", body)
+	}
+}
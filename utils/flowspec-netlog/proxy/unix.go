@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// unixDialTimeout bounds connecting to an upstream's unix socket
+const unixDialTimeout = 30 * time.Second
+
+// unixUpstreams maps upstream hosts, with or without a port, to the unix
+// sockets their connections are dialed on (FLOWSPEC_UNIX_UPSTREAMS)
+type unixUpstreams map[string]string
+
+// parseUnixUpstreams parses host=/path/to.sock items
+func parseUnixUpstreams(items []string) (map[string]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	sockets := make(map[string]string, len(items))
+	for _, item := range items {
+		host, path, ok := strings.Cut(item, "=")
+		host, path = strings.TrimSpace(host), strings.TrimSpace(path)
+		if !ok || host == "" || path == "" {
+			return nil, fmt.Errorf("invalid unix upstream %q: want host=/path/to.sock", item)
+		}
+		sockets[strings.ToLower(host)] = path
+	}
+	return sockets, nil
+}
+
+// socket returns the socket for addr, a host:port, matching the mapping
+// with the port first and then the bare host
+func (u unixUpstreams) socket(addr string) (string, bool) {
+	if len(u) == 0 {
+		return "", false
+	}
+	addr = strings.ToLower(addr)
+	if path, ok := u[addr]; ok {
+		return path, true
+	}
+	path, ok := u[hostOnly(addr)]
+	return path, ok
+}
+
+// requestSocket returns the socket req is forwarded over, if any
+func (u unixUpstreams) requestSocket(req *http.Request) (string, bool) {
+	return u.socket(canonicalAddr(req.URL.Host, req.URL.Scheme))
+}
+
+// route makes tr dial mapped hosts over their sockets, directly rather
+// than through an upstream proxy
+func (u unixUpstreams) route(tr *http.Transport) {
+	dial := tr.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: unixDialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if path, ok := u.socket(addr); ok {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		return dial(ctx, network, addr)
+	}
+
+	if proxy := tr.Proxy; proxy != nil {
+		tr.Proxy = func(req *http.Request) (*url.URL, error) {
+			if _, ok := u.requestSocket(req); ok {
+				return nil, nil
+			}
+			return proxy(req)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixUpstream(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("over the socket: " + r.Host + r.URL.Path))
+	}))
+	upstream.Listener.Close()
+	upstream.Listener = l
+	upstream.Start()
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{UnixUpstreams: map[string]string{
+		"backend.internal":  socket,
+		"api.internal:8080": socket,
+	}})
+	for _, tc := range []struct{ url, want string }{
+		{"http://backend.internal/users", "over the socket: backend.internal/users"},
+		{"http://api.internal:8080/orders", "over the socket: api.internal:8080/orders"},
+	} {
+		resp, err := client.Get(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != tc.want {
+			t.Errorf("%s: got %d %q, want 200 %q", tc.url, resp.StatusCode, body, tc.want)
+		}
+	}
+
+	entries := closeAndRead(t, p)
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.UnixSocket != socket || entry.StatusCode != http.StatusOK {
+			t.Errorf("%s: unix socket %q, status %d; want %q and 200", entry.URL, entry.UnixSocket, entry.StatusCode, socket)
+		}
+	}
+}
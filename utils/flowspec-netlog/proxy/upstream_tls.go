@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/elazarl/goproxy"
+)
+
+// upstreamTLSConfig returns the TLS config used to dial upstreams. goproxy's
+// default skips verification, which would let a real man-in-the-middle
+// between the proxy and the upstream go unnoticed.
+func upstreamTLSConfig(insecure bool) *tls.Config {
+	return &tls.Config{InsecureSkipVerify: insecure}
+}
+
+// recordUpstreamCert records the upstream leaf certificate of a TLS response
+// and whether its chain was verified
+func recordUpstreamCert(log *RequestLog, resp *http.Response) {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return
+	}
+	leaf := resp.TLS.PeerCertificates[0]
+	log.UpstreamCertVerified = len(resp.TLS.VerifiedChains) > 0
+	log.UpstreamCertSubject = leaf.Subject.String()
+	log.UpstreamCertIssuer = leaf.Issuer.String()
+}
+
+// recordRejectedCert records the leaf certificate an upstream presented when
+// it failed verification
+func recordRejectedCert(log *RequestLog, err error) {
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) && len(verifyErr.UnverifiedCertificates) > 0 {
+		leaf := verifyErr.UnverifiedCertificates[0]
+		log.UpstreamCertSubject = leaf.Subject.String()
+		log.UpstreamCertIssuer = leaf.Issuer.String()
+	}
+}
+
+// isCertVerificationError reports whether err is an upstream certificate
+// that failed verification, as opposed to a transient connection failure
+func isCertVerificationError(err error) bool {
+	var verifyErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &verifyErr) ||
+		errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid)
+}
+
+// badGatewayResponse answers a request whose upstream failed verification
+func badGatewayResponse(req *http.Request, err error) *http.Response {
+	return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusBadGateway,
+		"flowspec-netlog: upstream certificate verification failed: "+err.Error()+"\n")
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamVerification(t *testing.T) {
+	// httptest's certificate is self-signed, so only an insecure proxy accepts it
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		insecure bool
+		status   int
+		kind     string
+	}{
+		{false, http.StatusBadGateway, "tls"},
+		{true, http.StatusOK, ""},
+	} {
+		p, client := newTestProxy(t, Options{InsecureUpstream: tc.insecure})
+		resp, err := skipVerify(client).Get(upstream.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("insecure %v: status %d, want %d", tc.insecure, resp.StatusCode, tc.status)
+		}
+
+		entries := closeAndRead(t, p)
+		if len(entries) != 1 {
+			t.Fatalf("insecure %v: got %d entries, want 1", tc.insecure, len(entries))
+		}
+		entry := entries[0]
+		if entry.ErrorKind != tc.kind || entry.StatusCode != tc.status {
+			t.Errorf("insecure %v: entry status %d, error kind %q; want %d and %q",
+				tc.insecure, entry.StatusCode, entry.ErrorKind, tc.status, tc.kind)
+		}
+		// Either way the presented certificate is recorded, unverified
+		if entry.UpstreamCertVerified || entry.UpstreamCertSubject == "" {
+			t.Errorf("insecure %v: upstream cert verified %v, subject %q",
+				tc.insecure, entry.UpstreamCertVerified, entry.UpstreamCertSubject)
+		}
+	}
+}
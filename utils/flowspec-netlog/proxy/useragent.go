@@ -0,0 +1,41 @@
+package proxy
+
+import "strings"
+
+// unknownUserAgent is the family of requests with no usable User-Agent
+const unknownUserAgent = "unknown"
+
+// userAgentFamily returns the leading product token of a User-Agent with
+// its version, e.g. "curl/8.4.0" or "python-requests/2.31.0", so requests
+// group by client library rather than by full string. Browsers all report
+// "Mozilla/5.0". A missing or malformed User-Agent is "unknown".
+func userAgentFamily(ua string) string {
+	fields := strings.Fields(ua)
+	if len(fields) == 0 {
+		return unknownUserAgent
+	}
+	product, version, hasVersion := strings.Cut(fields[0], "/")
+	if !isToken(product) || (hasVersion && !isToken(version)) {
+		return unknownUserAgent
+	}
+	if !hasVersion {
+		return product
+	}
+	return product + "/" + version
+}
+
+// isToken reports whether s is a non-empty HTTP token (RFC 9110)
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
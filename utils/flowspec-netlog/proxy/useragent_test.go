@@ -0,0 +1,27 @@
+package proxy
+
+import "testing"
+
+func TestUserAgentFamily(t *testing.T) {
+	for _, tc := range []struct {
+		ua   string
+		want string
+	}{
+		{"curl/8.4.0", "curl/8.4.0"},
+		{"python-requests/2.31.0", "python-requests/2.31.0"},
+		{"Go-http-client/1.1", "Go-http-client/1.1"},
+		{"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", "Mozilla/5.0"},
+		{"okhttp/4.12.0 extra", "okhttp/4.12.0"},
+		{"my-agent", "my-agent"},
+		{"", unknownUserAgent},
+		{"   ", unknownUserAgent},
+		{"(compatible; bot)", unknownUserAgent},
+		{"curl/", unknownUserAgent},
+		{"/1.0", unknownUserAgent},
+		{"curl/8.4/extra", unknownUserAgent},
+	} {
+		if got := userAgentFamily(tc.ua); got != tc.want {
+			t.Errorf("userAgentFamily(%q) = %q, want %q", tc.ua, got, tc.want)
+		}
+	}
+}
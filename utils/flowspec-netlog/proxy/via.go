@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// viaPseudonym names the proxy in the Via entries it adds
+const viaPseudonym = "flowspec-netlog"
+
+// appendVia adds the proxy to the Via chain of a request it forwards, as
+// RFC 9110 asks of intermediaries, so upstream proxies and servers see the
+// hop. The received protocol is the version the client spoke: 1.1 for
+// HTTP/1.1 and decrypted HTTPS alike, 2 for HTTP/2.
+func appendVia(req *http.Request) {
+	protocol := "1.1"
+	switch {
+	case req.ProtoMajor >= 2:
+		protocol = strconv.Itoa(req.ProtoMajor)
+	case req.ProtoMajor == 1:
+		protocol = "1." + strconv.Itoa(req.ProtoMinor)
+	}
+	req.Header.Add("Via", protocol+" "+viaPseudonym)
+}
+
+// viaChain returns the entries of the Via headers in h, the client's side
+// first, e.g. ["1.0 fred", "1.1 p.example.net (Apache/1.1)"]. Commas
+// inside comments do not split entries.
+func viaChain(h http.Header) []string {
+	var chain []string
+	for _, value := range h.Values("Via") {
+		depth, start := 0, 0
+		for i := 0; i <= len(value); i++ {
+			if i < len(value) {
+				switch value[i] {
+				case '(':
+					depth++
+					continue
+				case ')':
+					if depth > 0 {
+						depth--
+					}
+					continue
+				case ',':
+					if depth > 0 {
+						continue
+					}
+				default:
+					continue
+				}
+			}
+			if entry := strings.TrimSpace(value[start:i]); entry != "" {
+				chain = append(chain, entry)
+			}
+			start = i + 1
+		}
+	}
+	return chain
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestViaAppendedAndCaptured(t *testing.T) {
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Values("Via")
+	}))
+	defer upstream.Close()
+
+	p, client := newTestProxy(t, Options{})
+	req, err := http.NewRequest("GET", upstream.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Via", "1.0 fred, 1.1 p.example.net (Apache/1.1, mod_proxy)")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	want := []string{"1.0 fred", "1.1 p.example.net (Apache/1.1, mod_proxy)", "1.1 flowspec-netlog"}
+	if got := viaChain(http.Header{"Via": forwarded}); !reflect.DeepEqual(got, want) {
+		t.Errorf("forwarded Via chain = %q, want %q", got, want)
+	}
+	entries := closeAndRead(t, p)
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if !reflect.DeepEqual(entries[0].Via, want) {
+		t.Errorf("captured via = %q, want %q", entries[0].Via, want)
+	}
+}
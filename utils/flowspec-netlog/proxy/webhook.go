@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	webhookQueueSize   = 256
+	webhookMaxAttempts = 4
+	webhookTimeout     = 10 * time.Second
+	webhookBackoff     = 500 * time.Millisecond
+	// webhookCloseTimeout bounds how long Close waits for pending deliveries
+	webhookCloseTimeout = 5 * time.Second
+)
+
+// webhookCondition is a single comparison such as "status>=500"
+type webhookCondition struct {
+	field string
+	op    string
+	value string
+}
+
+// webhookNotifier POSTs matching log entries to a URL from a background worker
+type webhookNotifier struct {
+	url        string
+	conditions []webhookCondition
+	client     *http.Client
+	queue      chan *RequestLog
+	wg         sync.WaitGroup
+
+	// ctx is cancelled when Close gives up waiting, aborting deliveries
+	ctx          context.Context
+	cancel       context.CancelFunc
+	closeTimeout time.Duration
+	dropped      atomic.Int64 // entries dropped because the queue was full
+	abandoned    int          // entries left undelivered at shutdown; owned by run
+}
+
+// parseWebhookRule parses a comma-separated list of conditions that must all
+// match, e.g. "status>=500,host=api.example.com". An empty rule matches everything.
+func parseWebhookRule(rule string) ([]webhookCondition, error) {
+	var conditions []webhookCondition
+	for _, part := range strings.Split(rule, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		idx := strings.IndexAny(part, "=!<>")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid webhook condition %q", part)
+		}
+		field := strings.TrimSpace(part[:idx])
+		rest := part[idx:]
+
+		var op string
+		for _, candidate := range []string{">=", "<=", "!=", "=", ">", "<"} {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, fmt.Errorf("invalid operator in webhook condition %q", part)
+		}
+		value := strings.TrimSpace(rest[len(op):])
+
+		switch field {
+		case "status":
+			if _, err := strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid status in webhook condition %q", part)
+			}
+		case "host", "method":
+			if op != "=" && op != "!=" {
+				return nil, fmt.Errorf("operator %s not supported for %s", op, field)
+			}
+		default:
+			return nil, fmt.Errorf("unknown field %q in webhook condition", field)
+		}
+
+		conditions = append(conditions, webhookCondition{field: field, op: op, value: value})
+	}
+	return conditions, nil
+}
+
+// matches reports whether the entry satisfies the condition
+func (c webhookCondition) matches(log *RequestLog) bool {
+	switch c.field {
+	case "status":
+		want, _ := strconv.Atoi(c.value)
+		switch c.op {
+		case "=":
+			return log.StatusCode == want
+		case "!=":
+			return log.StatusCode != want
+		case ">=":
+			return log.StatusCode >= want
+		case "<=":
+			return log.StatusCode <= want
+		case ">":
+			return log.StatusCode > want
+		case "<":
+			return log.StatusCode < want
+		}
+	case "host":
+		return strings.EqualFold(hostOnly(log.Host), c.value) == (c.op == "=")
+	case "method":
+		return strings.EqualFold(log.Method, c.value) == (c.op == "=")
+	}
+	return false
+}
+
+// newWebhookNotifier creates a notifier and starts its delivery worker
+func newWebhookNotifier(url, rule string) (*webhookNotifier, error) {
+	conditions, err := parseWebhookRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &webhookNotifier{
+		url:          url,
+		conditions:   conditions,
+		client:       &http.Client{Timeout: webhookTimeout},
+		queue:        make(chan *RequestLog, webhookQueueSize),
+		ctx:          ctx,
+		cancel:       cancel,
+		closeTimeout: webhookCloseTimeout,
+	}
+	n.wg.Add(1)
+	go n.run()
+	return n, nil
+}
+
+// Write queues the entry if it matches the rule. It never blocks: entries
+// are dropped when the queue is full so the capture path is unaffected, and
+// the drops are reported once on Close.
+func (n *webhookNotifier) Write(log *RequestLog) error {
+	// A resume marker is not a request
+	if log.Pause != nil {
+		return nil
+	}
+	for _, c := range n.conditions {
+		if !c.matches(log) {
+			return nil
+		}
+	}
+
+	select {
+	case n.queue <- log:
+	default:
+		n.dropped.Add(1)
+	}
+	return nil
+}
+
+// run delivers queued entries until the queue is closed
+func (n *webhookNotifier) run() {
+	defer n.wg.Done()
+	for log := range n.queue {
+		if n.ctx.Err() != nil {
+			n.abandoned++
+			continue
+		}
+		if err := n.send(log); err != nil {
+			if n.ctx.Err() != nil {
+				n.abandoned++
+				continue
+			}
+			fmt.Printf("Warning: webhook delivery failed: %v\n", err)
+		}
+	}
+}
+
+// send POSTs the entry, retrying with exponential backoff
+func (n *webhookNotifier) send(log *RequestLog) error {
+	payload, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, n.url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := n.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("webhook returned %s", resp.Status)
+		}
+		if attempt >= webhookMaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-n.ctx.Done():
+			return n.ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// Close stops accepting entries and waits up to closeTimeout for pending
+// deliveries, dropping whatever is still queued after that
+func (n *webhookNotifier) Close() error {
+	close(n.queue)
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(n.closeTimeout):
+		n.cancel()
+		<-done
+	}
+	n.cancel()
+
+	if dropped := n.dropped.Load(); dropped > 0 {
+		fmt.Printf("Warning: webhook queue full, dropped %d notifications\n", dropped)
+	}
+	if n.abandoned > 0 {
+		fmt.Printf("Warning: webhook shutdown timed out, dropped %d pending notifications\n", n.abandoned)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookServerErrors(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	var notified []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var log RequestLog
+		if err := json.NewDecoder(r.Body).Decode(&log); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		notified = append(notified, log.URL)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	p, client := newTestProxy(t, Options{WebhookURL: receiver.URL, WebhookRule: "status>=500"})
+	for _, path := range []string{"/fail1", "/ok", "/fail2", "/ok"} {
+		resp, err := client.Get(upstream.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// Closing waits for pending deliveries
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(notified)
+	want := []string{upstream.URL + "/fail1", upstream.URL + "/fail2"}
+	if len(notified) != len(want) || notified[0] != want[0] || notified[1] != want[1] {
+		t.Errorf("webhook got %q, want %q", notified, want)
+	}
+}
+
+func TestWebhookCloseHangingReceiver(t *testing.T) {
+	release := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer receiver.Close()
+	defer close(release)
+
+	n, err := newWebhookNotifier(receiver.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.closeTimeout = 200 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		n.Write(&RequestLog{URL: "http://example.com/", StatusCode: http.StatusInternalServerError})
+	}
+
+	start := time.Now()
+	n.Close()
+	if elapsed := time.Since(start); elapsed > n.closeTimeout+time.Second {
+		t.Errorf("Close took %v with a hanging receiver, want about %v", elapsed, n.closeTimeout)
+	}
+	if n.abandoned != 3 {
+		t.Errorf("abandoned %d deliveries, want 3", n.abandoned)
+	}
+}
+
+func TestWebhookHostCondition(t *testing.T) {
+	conditions, err := parseWebhookRule("host=API.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]bool{
+		"api.example.com":      true,
+		"api.example.com:8443": true,
+		"eu.api.example.com":   false,
+		"example.com":          false,
+	} {
+		if got := conditions[0].matches(&RequestLog{Host: host}); got != want {
+			t.Errorf("host=API.example.com matches %q = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestWebhookSkipsPauseMarker(t *testing.T) {
+	var mu sync.Mutex
+	var notified []RequestLog
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var log RequestLog
+		if err := json.NewDecoder(r.Body).Decode(&log); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		notified = append(notified, log)
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	// Neither an empty rule nor status<500 may match the marker
+	for _, rule := range []string{"", "status<500"} {
+		p, _ := newTestProxy(t, Options{WebhookURL: receiver.URL, WebhookRule: rule})
+		p.logger.Pause()
+		p.logger.Resume()
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(notified) != 0 {
+		t.Errorf("webhook got %d notifications for resume markers, want none: %+v", len(notified), notified)
+	}
+}
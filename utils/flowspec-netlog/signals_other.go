@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package main
+
+import "github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
+
+// notifyPauseSignals does nothing where SIGUSR1 and SIGUSR2 do not exist;
+// use the admin /pause and /resume endpoints instead
+func notifyPauseSignals(p *proxy.Proxy) {}
@@ -0,0 +1,26 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
+)
+
+// notifyPauseSignals pauses capture on SIGUSR1 and resumes it on SIGUSR2
+func notifyPauseSignals(p *proxy.Proxy) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range sigChan {
+			if sig == syscall.SIGUSR1 {
+				p.Pause()
+			} else {
+				p.Resume()
+			}
+		}
+	}()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
+)
+
+// startupInfo is the startup banner emitted with FLOWSPEC_JSON_STARTUP=true
+// so orchestrators can discover where the proxy listens and logs
+type startupInfo struct {
+	Version         string `json:"version"`
+	Commit          string `json:"commit,omitempty"`
+	Listen          string `json:"listen"`
+	AdminAddr       string `json:"admin_addr,omitempty"`
+	LogPath         string `json:"log_path"`
+	CertPath        string `json:"cert_path"`
+	CertFingerprint string `json:"cert_fingerprint"`
+}
+
+// newStartupInfo describes a started proxy
+func newStartupInfo(p *proxy.Proxy) startupInfo {
+	rev, _ := buildInfo()
+	return startupInfo{
+		Version:         version,
+		Commit:          rev,
+		Listen:          p.Addr(),
+		AdminAddr:       p.AdminAddr(),
+		LogPath:         p.GetLogPath(),
+		CertPath:        p.GetCertPath(),
+		CertFingerprint: p.GetCertFingerprint(),
+	}
+}
+
+// printStartupJSON writes info as a single line of JSON
+func printStartupJSON(w io.Writer, info startupInfo) error {
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		return fmt.Errorf("failed to write startup info: %w", err)
+	}
+	return nil
+}
+
+// printStartupBanner writes the human-readable startup banner
+func printStartupBanner(w io.Writer, info startupInfo, opts proxy.Options) {
+	ext := "jsonl"
+	if opts.LogFormat == "gob" {
+		ext = "gob"
+	}
+	fmt.Fprintf(w, "flowspec-netlog v%s starting on %s\n", info.Version, info.Listen)
+	fmt.Fprintf(w, "Logging to: %s/network.*.%s\n", opts.LogDir, ext)
+	if info.AdminAddr != "" {
+		fmt.Fprintf(w, "Admin endpoints on http://%s\n", info.AdminAddr)
+	}
+	fmt.Fprintf(w, "Press Ctrl+C to stop\n")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jpoley/flowspec/utils/flowspec-netlog/proxy"
+)
+
+func TestStartupJSON(t *testing.T) {
+	opts := proxy.Options{LogDir: t.TempDir(), Addr: "127.0.0.1:0", AdminAddr: "127.0.0.1:0"}
+	p, err := proxy.NewProxy(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	var buf bytes.Buffer
+	if err := printStartupJSON(&buf, newStartupInfo(p)); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+		t.Errorf("banner is %d lines, want 1:\n%s", lines, buf.String())
+	}
+	var banner map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &banner); err != nil {
+		t.Fatal(err)
+	}
+
+	// Port 0 is reported as the port actually picked
+	if strings.HasSuffix(p.AdminAddr(), ":0") {
+		t.Errorf("admin address %s, want the listening port", p.AdminAddr())
+	}
+	for key, want := range map[string]string{
+		"version":    version,
+		"listen":     p.Addr(),
+		"admin_addr": p.AdminAddr(),
+		"log_path":   p.GetLogPath(),
+		"cert_path":  p.GetCertPath(),
+	} {
+		if got, ok := banner[key].(string); !ok || got != want {
+			t.Errorf("%s = %v, want %q", key, banner[key], want)
+		}
+	}
+	if fingerprint, _ := banner["cert_fingerprint"].(string); fingerprint == "" {
+		t.Errorf("cert_fingerprint = %v, want the CA fingerprint", banner["cert_fingerprint"])
+	}
+	for _, key := range []string{"log_path", "cert_path"} {
+		if _, err := os.Stat(banner[key].(string)); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
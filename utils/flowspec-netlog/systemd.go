@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+const (
+	// sdListenFDsStart is the first file descriptor passed by systemd
+	sdListenFDsStart = 3
+)
+
+// listenFDs parses the systemd socket activation environment and returns the
+// number of inherited file descriptors. It returns 0 when the process was not
+// socket-activated (LISTEN_PID missing or addressed to another process).
+func listenFDs(getenv func(string) string, pid int) (int, error) {
+	pidStr := getenv("LISTEN_PID")
+	fdsStr := getenv("LISTEN_FDS")
+	if pidStr == "" || fdsStr == "" {
+		return 0, nil
+	}
+
+	listenPID, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LISTEN_PID %q: %w", pidStr, err)
+	}
+	if listenPID != pid {
+		return 0, nil
+	}
+
+	fds, err := strconv.Atoi(fdsStr)
+	if err != nil || fds < 0 {
+		return 0, fmt.Errorf("invalid LISTEN_FDS %q", fdsStr)
+	}
+	return fds, nil
+}
+
+// systemdListener returns the listener inherited via socket activation, or
+// nil when the process was started normally
+func systemdListener() (net.Listener, error) {
+	fds, err := listenFDs(os.Getenv, os.Getpid())
+	if err != nil || fds == 0 {
+		return nil, err
+	}
+
+	// Don't pass the activation environment on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if fds > 1 {
+		fmt.Printf("Warning: %d sockets passed by systemd, using the first\n", fds)
+	}
+
+	file := os.NewFile(uintptr(sdListenFDsStart), "LISTEN_FD_3")
+	defer file.Close()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use inherited socket: %w", err)
+	}
+	return listener, nil
+}
+
+// sdNotify sends a state update to systemd when NOTIFY_SOCKET is set
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// A leading '@' denotes a Linux abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
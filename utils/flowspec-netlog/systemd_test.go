@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestListenFDs(t *testing.T) {
+	const pid = 4242
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		want    int
+		wantErr bool
+	}{
+		{"not activated", nil, 0, false},
+		{"only LISTEN_PID", map[string]string{"LISTEN_PID": "4242"}, 0, false},
+		{"only LISTEN_FDS", map[string]string{"LISTEN_FDS": "1"}, 0, false},
+		{"one socket", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "1"}, 1, false},
+		{"two sockets", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "2"}, 2, false},
+		{"another process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}, 0, false},
+		{"invalid LISTEN_PID", map[string]string{"LISTEN_PID": "self", "LISTEN_FDS": "1"}, 0, true},
+		{"invalid LISTEN_FDS", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "one"}, 0, true},
+		{"negative LISTEN_FDS", map[string]string{"LISTEN_PID": "4242", "LISTEN_FDS": "-1"}, 0, true},
+	} {
+		getenv := func(name string) string { return tc.env[name] }
+		got, err := listenFDs(getenv, pid)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+		if got != tc.want {
+			t.Errorf("%s: listenFDs() = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Build metadata, injected at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "0.1.0"
+	commit    = ""
+	buildDate = ""
+)
+
+// buildInfo returns the commit and build date, falling back to the VCS
+// stamp Go embeds in binaries built from a checkout
+func buildInfo() (string, string) {
+	rev, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if rev == "" {
+					rev = setting.Value
+					if len(rev) > 12 {
+						rev = rev[:12]
+					}
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if commit == "" && rev != "" && modified {
+			rev += "-dirty"
+		}
+	}
+	return rev, date
+}
+
+// versionString formats the version line, e.g.
+// "flowspec-netlog 0.1.0 (commit 1a2b3c4, built 2025-12-25T12:00:00Z)"
+func versionString(version, commit, date string) string {
+	if commit == "" {
+		commit = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return fmt.Sprintf("flowspec-netlog %s (commit %s, built %s)", version, commit, date)
+}
+
+// printVersion prints the version line of this build
+func printVersion() {
+	rev, date := buildInfo()
+	fmt.Println(versionString(version, rev, date))
+}
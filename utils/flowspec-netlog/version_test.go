@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestVersionString(t *testing.T) {
+	for _, tc := range []struct {
+		version, commit, date string
+		want                  string
+	}{
+		{"1.2.3", "1a2b3c4", "2025-12-25T12:00:00Z", "flowspec-netlog 1.2.3 (commit 1a2b3c4, built 2025-12-25T12:00:00Z)"},
+		{"1.2.3", "", "2025-12-25T12:00:00Z", "flowspec-netlog 1.2.3 (commit unknown, built 2025-12-25T12:00:00Z)"},
+		{"1.2.3", "1a2b3c4", "", "flowspec-netlog 1.2.3 (commit 1a2b3c4, built unknown)"},
+		{"0.1.0", "", "", "flowspec-netlog 0.1.0 (commit unknown, built unknown)"},
+	} {
+		if got := versionString(tc.version, tc.commit, tc.date); got != tc.want {
+			t.Errorf("versionString(%q, %q, %q) = %q, want %q", tc.version, tc.commit, tc.date, got, tc.want)
+		}
+	}
+}
+
+func TestBuildInfoInjected(t *testing.T) {
+	savedCommit, savedDate := commit, buildDate
+	defer func() { commit, buildDate = savedCommit, savedDate }()
+
+	// Values set with -ldflags win over the embedded VCS stamp
+	commit, buildDate = "feedface", "2025-12-25T12:00:00Z"
+	if rev, date := buildInfo(); rev != commit || date != buildDate {
+		t.Errorf("buildInfo() = %q, %q; want %q, %q", rev, date, commit, buildDate)
+	}
+}